@@ -0,0 +1,183 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// Limits on the number of audit entries returned by ListAudit
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditEntry records a single change to a beast. Before is null for creations and After for deletions.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	BeastName string          `json:"beast_name"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	RequestID string          `json:"request_id,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// recordChange writes an audit entry for a change to a beast within the transaction making the change
+func recordChange(c *gin.Context, tx pgx.Tx, action, key string, before, after *Beast) error {
+	beforeJSON, err := marshalSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := marshalSnapshot(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c.Request.Context(), `
+		INSERT INTO audit_log (beast_name, actor, action, before, after, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		key, actorOf(c), action, beforeJSON, afterJSON, nullIfEmpty(c.GetString(requestIDKey)))
+	return err
+}
+
+// actorOf names the caller making a change: the subject of their token, or anonymous
+func actorOf(c *gin.Context) string {
+	if principal := CurrentPrincipal(c); principal != nil && principal.Subject != "" {
+		return principal.Subject
+	}
+	return RoleAnonymous
+}
+
+// recordChangeAndCommit records the change with recordBeastChange and commits the transaction. It writes
+// the error response and returns false if any step fails, in which case the change is rolled back.
+func recordChangeAndCommit(c *gin.Context, tx pgx.Tx, action, key string, before, after *Beast) bool {
+	if !recordBeastChange(c, tx, action, key, before, after) {
+		return false
+	}
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		requestLogger(c).Error("Error committing transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	return true
+}
+
+// recordBeastChange records the change, saves the new version of the beast as a revision and publishes
+// the change event within the transaction making it. It writes the error response and returns false if
+// any step fails.
+func recordBeastChange(c *gin.Context, tx pgx.Tx, action, key string, before, after *Beast) bool {
+	if err := recordChange(c, tx, action, key, before, after); err != nil {
+		requestLogger(c).Error("Error writing audit log", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	if after != nil {
+		if err := saveRevision(c, tx, key, after); err != nil {
+			requestLogger(c).Error("Error saving revision", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+	}
+	if err := recordEvent(c, tx, action, key, before, after); err != nil {
+		requestLogger(c).Error("Error recording event", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	return true
+}
+
+// marshalSnapshot encodes a beast for the audit log, or nil for a missing one so it is stored as NULL
+func marshalSnapshot(beast *Beast) ([]byte, error) {
+	if beast == nil {
+		return nil, nil
+	}
+	return json.Marshal(beast)
+}
+
+// ListAudit returns audit entries, newest first, optionally filtered by beast, actor and a since timestamp
+func ListAudit(c *gin.Context) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(column string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s $%d", column, len(args)))
+	}
+
+	if beast := c.Query("beast"); beast != "" {
+		addCondition("beast_name =", beast)
+	}
+	if actor := c.Query("actor"); actor != "" {
+		addCondition("actor =", actor)
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid since, expected an RFC 3339 timestamp")
+			return
+		}
+		addCondition("created_at >=", t)
+	}
+
+	limit := defaultAuditLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid limit, expected 1 to %d", maxAuditLimit))
+			return
+		}
+		limit = n
+	}
+
+	query := "SELECT id, beast_name, actor, action, before, after, COALESCE(request_id, ''), created_at FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := dbPool.Query(c.Request.Context(), query, args...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after []byte
+		err = rows.Scan(&entry.ID, &entry.BeastName, &entry.Actor, &entry.Action, &before, &after,
+			&entry.RequestID, &entry.Timestamp)
+		if err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		entry.Before, entry.After = before, after
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var auditRowColumns = []string{"id", "beast_name", "actor", "action", "before", "after", "request_id", "created_at"}
+
+func TestListAudit(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_log WHERE beast_name = $1 AND actor = $2 AND created_at >= $3 ORDER BY id DESC LIMIT $4")).
+		WithArgs("Owlbear", "dm-1", since, 10).
+		WillReturnRows(mock.NewRows(auditRowColumns).
+			AddRow(int64(2), "Owlbear", "dm-1", AuditUpdate, []byte(`{"CR":"3"}`), []byte(`{"CR":"4"}`), "req-2", since.Add(time.Hour)).
+			AddRow(int64(1), "Owlbear", "dm-1", AuditCreate, []byte(nil), []byte(`{"CR":"3"}`), "", since))
+
+	router := gin.Default()
+	router.GET("/audit", ListAudit)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/audit?beast=Owlbear&actor=dm-1&since=2024-05-01T12:00:00Z&limit=10", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[
+		{"id":2,"beast_name":"Owlbear","actor":"dm-1","action":"update","before":{"CR":"3"},"after":{"CR":"4"},"request_id":"req-2","timestamp":"2024-05-01T13:00:00Z"},
+		{"id":1,"beast_name":"Owlbear","actor":"dm-1","action":"create","before":null,"after":{"CR":"3"},"timestamp":"2024-05-01T12:00:00Z"}
+	]`, w.Body.String())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListAudit_InvalidQuery(t *testing.T) {
+	router := gin.Default()
+	router.GET("/audit", ListAudit)
+
+	for _, query := range []string{"since=yesterday", "limit=0", "limit=5000", "limit=ten"} {
+		t.Run(query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/audit?"+query, nil)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestAudit_FailureRollsBackChange(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO beasts").WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(),
+		pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(),
+		pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(auditInsert).
+		WithArgs("Owlbear", "dm-1", AuditCreate, []byte(nil), pgxmock.AnyArg(), "req-7").
+		WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+
+	router := gin.New()
+	router.Use(RequestID(), AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.POST("/beasts", PutItem)
+
+	body, _ := json.Marshal(Beast{BeastName: "Owlbear"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/beasts", bytes.NewBuffer(body))
+	req.Header.Set(RequestIDHeader, "req-7")
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
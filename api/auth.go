@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+)
+
+// principalKey is the gin context key holding the authenticated *auth.Principal
+const principalKey = "principal"
+
+// TokenVerifier validates a bearer token and returns the principal it belongs to
+type TokenVerifier interface {
+	Verify(token string) (*auth.Principal, error)
+}
+
+// Authenticate verifies the bearer token of each request, if any, and stores the principal in the context.
+// Requests without an Authorization header continue anonymously.
+func Authenticate(verifier TokenVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_request"`)
+			abortWithProblem(c, http.StatusUnauthorized, "Malformed Authorization header")
+			return
+		}
+
+		principal, err := verifier.Verify(strings.TrimSpace(token))
+		if err != nil {
+			msg := "Invalid token"
+			if errors.Is(err, auth.ErrTokenExpired) {
+				msg = "Token expired"
+			}
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			abortWithProblem(c, http.StatusUnauthorized, msg)
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// AssumePrincipal attaches the same principal to every request. It stands in for Authenticate when
+// authentication is disabled.
+func AssumePrincipal(principal *auth.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// CurrentPrincipal returns the authenticated principal of the request, or nil for anonymous requests
+func CurrentPrincipal(c *gin.Context) *auth.Principal {
+	if v, ok := c.Get(principalKey); ok {
+		if p, ok := v.(*auth.Principal); ok {
+			return p
+		}
+	}
+	return nil
+}
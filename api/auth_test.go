@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVerifier accepts a fixed set of tokens
+type fakeVerifier map[string]*auth.Principal
+
+func (f fakeVerifier) Verify(token string) (*auth.Principal, error) {
+	if token == "expired" {
+		return nil, auth.ErrTokenExpired
+	}
+	if p, ok := f[token]; ok {
+		return p, nil
+	}
+	return nil, auth.ErrInvalidToken
+}
+
+func TestAuthenticate(t *testing.T) {
+	verifier := fakeVerifier{"good": {Subject: "dm-1", Roles: []string{"editor"}}}
+
+	router := gin.Default()
+	router.Use(Authenticate(verifier))
+	router.GET("/whoami", func(c *gin.Context) {
+		subject := "anonymous"
+		if p := CurrentPrincipal(c); p != nil {
+			subject = p.Subject
+		}
+		c.JSON(http.StatusOK, gin.H{"subject": subject})
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		code   int
+		body   string
+	}{
+		{"Anonymous", "", http.StatusOK, `{"subject":"anonymous"}`},
+		{"ValidToken", "Bearer good", http.StatusOK, `{"subject":"dm-1"}`},
+		{"InvalidToken", "Bearer forged", http.StatusUnauthorized, `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"Invalid token"}`},
+		{"ExpiredToken", "Bearer expired", http.StatusUnauthorized, `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"Token expired"}`},
+		{"WrongScheme", "Basic Zm9vOmJhcg==", http.StatusUnauthorized, `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"Malformed Authorization header"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/whoami", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			assert.JSONEq(t, tt.body, w.Body.String())
+			if tt.code == http.StatusUnauthorized {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/pdf"
+)
+
+const (
+	// maxBookBeasts caps the number of beasts in a book, to keep requests reasonable
+	maxBookBeasts = 500
+	// maxBookTitle caps the length of book titles
+	maxBookTitle = 200
+)
+
+// BookRequest asks for a printable bestiary of the named beasts, or of the beasts matching the
+// filter when none are named. Named beasts must match the filter as well.
+type BookRequest struct {
+	Title  string   `json:"title"`
+	Beasts []string `json:"beasts"`
+	BeastFilter
+}
+
+// renderStatBlock lays out a single beast, followed by the credits of its source
+func renderStatBlock(beast Beast, source *Source) *pdf.Document {
+	l := newBookLayout(beast.BeastName)
+	l.statBlock(beast, source)
+	if source != nil {
+		l.credits([]Source{*source})
+	}
+	if l.doc.Pages() > 1 {
+		l.numberPages(1)
+	}
+	return l.doc
+}
+
+// renderBook lays out a title page, the stat blocks of the beasts in the order given, the credits of
+// their sources and an index of the pages the beasts start on. Every page but the title page is numbered.
+func renderBook(title string, beasts []Beast, sources []Source) *pdf.Document {
+	l := newBookLayout(title)
+	y := 480.0
+	for _, line := range pdf.Wrap(pdf.Bold, 28, title, pdf.PageWidth-2*pageMargin, 0) {
+		l.page.Text((pdf.PageWidth-pdf.Width(pdf.Bold, 28, line))/2, y, pdf.Bold, 28, statBlockRed, line)
+		y -= 34
+	}
+	l.page.Line(pdf.PageWidth/2-100, y+14, pdf.PageWidth/2+100, y+14, 1.5, statBlockRed)
+	subtitle := fmt.Sprintf("%d creatures", len(beasts))
+	if len(beasts) == 1 {
+		subtitle = "1 creature"
+	}
+	l.page.Text((pdf.PageWidth-pdf.Width(pdf.Italic, 12, subtitle))/2, y-10, pdf.Italic, 12, pdf.Black, subtitle)
+
+	l.newPage()
+	entries := make([]indexEntry, 0, len(beasts))
+	for _, beast := range beasts {
+		page := l.statBlock(beast, sourceOf(sources, beast.Source))
+		entries = append(entries, indexEntry{Name: beast.BeastName, Page: page})
+	}
+	l.credits(sources)
+
+	l.newPage()
+	slices.SortStableFunc(entries, func(a, b indexEntry) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	l.index(entries)
+	l.numberPages(2)
+	return l.doc
+}
+
+// writePDF sends a document as a PDF file with the given file name
+func writePDF(c *gin.Context, doc *pdf.Document, filename string) {
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		requestLogger(c).Error("Error writing PDF", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// getBeastPDF returns the stat block of a beast as a PDF
+func getBeastPDF(c *gin.Context, key string) {
+	beast, ok := loadBeast(c, key)
+	if !ok {
+		return
+	}
+	sources, ok := exportSources(c, []Beast{beast})
+	if !ok {
+		return
+	}
+	writePDF(c, renderStatBlock(beast, sourceOf(sources, beast.Source)), beast.BeastName+".pdf")
+}
+
+// CreateBook returns a PDF book of the beasts visible to the caller that are named in the request,
+// or match its filter, in alphabetical order with an index. Every named beast has to be found.
+func CreateBook(c *gin.Context) {
+	var req BookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		req.Title = "Bestiary"
+	}
+	if len([]rune(req.Title)) > maxBookTitle {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Title too long, expected at most %d characters", maxBookTitle))
+		return
+	}
+	slices.Sort(req.Beasts)
+	req.Beasts = slices.Compact(req.Beasts)
+	if len(req.Beasts) > maxBookBeasts {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Too many beasts, expected at most %d", maxBookBeasts))
+		return
+	}
+
+	beasts, ok := findBeasts(c, req.BeastFilter, req.Beasts...)
+	if !ok {
+		return
+	}
+	for _, name := range req.Beasts {
+		if !slices.ContainsFunc(beasts, func(b Beast) bool { return b.BeastName == name }) {
+			respondError(c, http.StatusNotFound, fmt.Sprintf("Beast %q not found", name))
+			return
+		}
+	}
+	if len(beasts) == 0 {
+		respondError(c, http.StatusNotFound, "No beasts match the filter")
+		return
+	}
+	if len(beasts) > maxBookBeasts {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Too many beasts, expected at most %d; narrow down the filter", maxBookBeasts))
+		return
+	}
+
+	sources, ok := exportSources(c, beasts)
+	if !ok {
+		return
+	}
+	writePDF(c, renderBook(req.Title, beasts, sources), req.Title+".pdf")
+}
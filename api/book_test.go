@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pageCountPattern = regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`)
+	pdfStreamPattern = regexp.MustCompile(`(?s)<< /Length (\d+) /Filter /FlateDecode >>\nstream\n(.*?)\nendstream`)
+)
+
+// pdfPages checks that data is a PDF file and returns the inflated contents of its pages
+func pdfPages(t *testing.T, data []byte) []string {
+	t.Helper()
+	require.True(t, bytes.HasPrefix(data, []byte("%PDF-")))
+	require.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+	count := pageCountPattern.FindSubmatch(data)
+	require.NotNil(t, count)
+
+	var pages []string
+	for _, m := range pdfStreamPattern.FindAllSubmatch(data, -1) {
+		require.Equal(t, string(m[1]), fmt.Sprint(len(m[2])))
+		r, err := zlib.NewReader(bytes.NewReader(m[2]))
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		pages = append(pages, string(content))
+	}
+	require.Equal(t, string(count[1]), fmt.Sprint(len(pages)))
+	return pages
+}
+
+func TestRenderBook(t *testing.T) {
+	beasts := []Beast{vttBeasts["mimic"], vttBeasts["owlbear"], vttBeasts["swarm"]}
+	// Enough goblins to fill more than a page
+	for i := 1; i <= 12; i++ {
+		beasts = append(beasts, Beast{BeastName: fmt.Sprintf("Goblin %02d", i), Type: "Humanoid", CR: "1/4", Description: vttBeasts["owlbear"].Description})
+	}
+
+	var buf bytes.Buffer
+	_, err := renderBook("Monsters of the Sword Coast", beasts, []Source{srd}).WriteTo(&buf)
+	require.NoError(t, err)
+	pages := pdfPages(t, buf.Bytes())
+	require.GreaterOrEqual(t, len(pages), 4)
+
+	title, index := pages[0], pages[len(pages)-1]
+	assert.Contains(t, title, "(Monsters of the Sword Coast) Tj")
+	assert.Contains(t, title, "(15 creatures) Tj")
+	assert.NotContains(t, title, "36 Td (1) Tj", "the title page is not numbered")
+	assert.Contains(t, pages[1], "(Mimic) Tj")
+	assert.Contains(t, pages[1], "(Armor Class) Tj")
+	assert.Contains(t, pages[1], "(STR) Tj")
+	assert.Contains(t, pages[1], "(17 \\(+3\\)) Tj")
+	assert.Contains(t, pages[1], "(Actions) Tj")
+	assert.Contains(t, pages[1], "(Source:) Tj")
+	assert.Contains(t, pages[1], fmt.Sprintf(" %g %g Td (Goblin 01) Tj", pageMargin+columnWidth+columnGap, columnTop-14), "the second column is used")
+	assert.Contains(t, strings.Join(pages, ""), "(Credits) Tj")
+
+	assert.Contains(t, index, "(Index) Tj")
+	assert.Contains(t, index, "(G) Tj")
+	assert.Contains(t, index, "(Owlbear) Tj")
+	assert.Regexp(t, `\(Goblin 12\) Tj ET\nBT .* Td \(\d+\) Tj ET\nBT .* Td \(\.+\) Tj`, index)
+	for n := 2; n <= len(pages); n++ {
+		assert.Contains(t, pages[n-1], fmt.Sprintf("36 Td (%d) Tj", n))
+	}
+}
+
+func TestRenderBook_IndexInitials(t *testing.T) {
+	// Names without a leading letter, such as one saved before names were required, are listed under #
+	beasts := []Beast{{BeastName: "", Type: "Ooze", CR: "1"}, {BeastName: "1st Goblin", Type: "Humanoid", CR: "1/4"}, vttBeasts["owlbear"]}
+
+	var buf bytes.Buffer
+	_, err := renderBook("Odd Names", beasts, nil).WriteTo(&buf)
+	require.NoError(t, err)
+	pages := pdfPages(t, buf.Bytes())
+
+	index := pages[len(pages)-1]
+	assert.Equal(t, 1, strings.Count(index, "(#) Tj"))
+	assert.Contains(t, index, "(O) Tj")
+	assert.Contains(t, index, "(1st Goblin) Tj")
+	assert.Equal(t, "#", indexInitial(""))
+	assert.Equal(t, "É", indexInitial("éttercap"))
+}
+
+func TestGetItem_PDF(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND visibility = 'public'")).
+		WithArgs("Owlbear").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{"STR": "20 (+5)"}, vttBeasts["owlbear"].Description, "dm-1", "public", "", 13, "7d10+21", "", "Large", "unaligned", []string{}, "SRD", 249))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT abbreviation, title, license, attribution FROM sources WHERE abbreviation = ANY($1) ORDER BY abbreviation")).
+		WithArgs([]string{"SRD"}).
+		WillReturnRows(mock.NewRows(sourceRowColumns).AddRow(srd.Abbreviation, srd.Title, srd.License, srd.Attribution))
+
+	router := gin.Default()
+	router.GET("/beasts/:key", GetItem)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Owlbear.pdf", nil)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, `inline; filename=Owlbear.pdf`, w.Header().Get("Content-Disposition"))
+	pages := pdfPages(t, w.Body.Bytes())
+	require.Len(t, pages, 1)
+	assert.Contains(t, pages[0], "(Owlbear) Tj")
+	assert.Contains(t, pages[0], "(Large monstrosity, unaligned) Tj")
+	assert.Contains(t, pages[0], "(59 \\(7d10+21\\)) Tj")
+	assert.Contains(t, pages[0], "(System Reference Document 5.1, page 249) Tj")
+	assert.Contains(t, pages[0], "(Credits) Tj")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateBook(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE deleted_at IS NULL AND size = $1 AND beast_name = ANY($2) AND visibility = 'public' ORDER BY beast_name")).
+		WithArgs("Large", []string{"Owlbear"}).
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "dm-1", "public", "", 13, "7d10+21", "", "Large", "unaligned", []string{"forest"}, "", 0))
+
+	router := gin.Default()
+	router.POST("/books", CreateBook)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/books", strings.NewReader(`{"title": "Death House", "beasts": ["Owlbear", "Owlbear"], "size": "Large"}`))
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `inline; filename="Death House.pdf"`, w.Header().Get("Content-Disposition"))
+	pages := pdfPages(t, w.Body.Bytes())
+	require.Len(t, pages, 3)
+	assert.Contains(t, pages[0], "(Death House) Tj")
+	assert.Contains(t, pages[0], "(1 creature) Tj")
+	assert.Contains(t, pages[1], "(Owlbear) Tj")
+	assert.NotContains(t, pages[1], "(Credits) Tj")
+	assert.Regexp(t, `\(Owlbear\) Tj ET\nBT .* Td \(2\) Tj`, pages[2])
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateBook_Rejected(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE deleted_at IS NULL AND beast_name = ANY($1) AND visibility = 'public'")).
+		WithArgs([]string{"Owlbear", "Tarrasque"}).
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "dm-1", "public", "", 13, "7d10+21", "", "Large", "unaligned", []string{}, "", 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE deleted_at IS NULL AND lower(type) = lower($1) AND visibility = 'public'")).
+		WithArgs("Dragon").
+		WillReturnRows(mock.NewRows(beastRowColumns))
+
+	router := gin.Default()
+	router.POST("/books", CreateBook)
+
+	tests := []struct {
+		body   string
+		status int
+		error  string
+	}{
+		{`{"beasts": ["Tarrasque", "Owlbear"]}`, http.StatusNotFound, `Beast \"Tarrasque\" not found`},
+		{`{"type": "Dragon"}`, http.StatusNotFound, "No beasts match the filter"},
+		{`{"size": "Colossal"}`, http.StatusBadRequest, "Invalid size"},
+		{`{"title": "` + strings.Repeat("a", 201) + `"}`, http.StatusBadRequest, "Title too long"},
+		{`{"beasts": "Owlbear"}`, http.StatusBadRequest, "Invalid input"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/books", strings.NewReader(tt.body))
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.status, w.Code, tt.body)
+		assert.Contains(t, w.Body.String(), tt.error, tt.body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
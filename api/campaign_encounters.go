@@ -0,0 +1,369 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// What deleting a beast does to the saved encounters using it
+const (
+	BeastDeleteRestrict = "restrict" // the delete is refused
+	BeastDeleteCascade  = "cascade"  // the beast is removed from the encounters once it is purged from the trash
+)
+
+// beastDeletePolicy is the policy applied when deleting a beast used by saved encounters
+var beastDeletePolicy = BeastDeleteRestrict
+
+// SetBeastDeletePolicy sets what deleting a beast used by saved encounters does
+func SetBeastDeletePolicy(p string) error {
+	if p != BeastDeleteRestrict && p != BeastDeleteCascade {
+		return fmt.Errorf("unknown beast delete policy %q, expected %s or %s", p, BeastDeleteRestrict, BeastDeleteCascade)
+	}
+	beastDeletePolicy = p
+	return nil
+}
+
+// SavedEncounter is an encounter kept in a campaign
+type SavedEncounter struct {
+	ID        int64            `json:"id"`
+	Campaign  string           `json:"campaign"`
+	Name      string           `json:"name"`
+	Notes     string           `json:"notes"`
+	Beasts    []EncounterBeast `json:"beasts"`
+	Owner     string           `json:"owner"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// savedEncounterQuery selects encounters with their beasts in order
+const savedEncounterQuery = `
+	SELECT e.id, e.campaign_id, e.name, e.notes, e.owner, e.created_at, e.updated_at,
+		COALESCE((SELECT json_agg(json_build_object('key', b.beast_name, 'count', b.count) ORDER BY b.position)
+			FROM encounter_beasts b WHERE b.encounter_id = e.id), '[]')
+	FROM encounters e`
+
+func scanSavedEncounter(row pgx.Row, e *SavedEncounter) error {
+	return row.Scan(&e.ID, &e.Campaign, &e.Name, &e.Notes, &e.Owner, &e.CreatedAt, &e.UpdatedAt, &e.Beasts)
+}
+
+// ListCampaignEncounters returns the encounters saved in a campaign
+func ListCampaignEncounters(c *gin.Context) {
+	campaign, ok := loadCampaign(c, dbPool, c.Param("campaign"), false, ActionViewAnyCampaign)
+	if !ok {
+		return
+	}
+
+	rows, err := dbPool.Query(c.Request.Context(), savedEncounterQuery+" WHERE e.campaign_id = $1 ORDER BY e.id", campaign.ID)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	encounters := []SavedEncounter{}
+	for rows.Next() {
+		var e SavedEncounter
+		if err := scanSavedEncounter(rows, &e); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		encounters = append(encounters, e)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, encounters)
+}
+
+// GetCampaignEncounter returns an encounter saved in a campaign
+func GetCampaignEncounter(c *gin.Context) {
+	id, ok := encounterParam(c)
+	if !ok {
+		return
+	}
+	campaign, ok := loadCampaign(c, dbPool, c.Param("campaign"), false, ActionViewAnyCampaign)
+	if !ok {
+		return
+	}
+
+	var e SavedEncounter
+	err := scanSavedEncounter(dbPool.QueryRow(c.Request.Context(), savedEncounterQuery+" WHERE e.id = $1 AND e.campaign_id = $2", id, campaign.ID), &e)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Encounter not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, e)
+}
+
+// CreateCampaignEncounter saves an encounter in a campaign. The owner and members of the campaign may.
+func CreateCampaignEncounter(c *gin.Context) {
+	var e SavedEncounter
+	if !bindSavedEncounter(c, &e) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	campaign, ok := loadCampaign(c, tx, c.Param("campaign"), false, ActionUpdateAnyCampaign)
+	if !ok {
+		return
+	}
+	e.Campaign, e.Owner = campaign.ID, actorOf(c)
+
+	err = tx.QueryRow(ctx,
+		"INSERT INTO encounters (campaign_id, name, notes, owner) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at",
+		e.Campaign, e.Name, e.Notes, e.Owner).Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		requestLogger(c).Error("Error inserting into database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !saveEncounterBeasts(c, tx, e.ID, e.Beasts, nil) {
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		requestLogger(c).Error("Error committing transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusCreated, e)
+}
+
+// UpdateCampaignEncounter replaces the name, notes and beasts of a saved encounter
+func UpdateCampaignEncounter(c *gin.Context) {
+	id, ok := encounterParam(c)
+	if !ok {
+		return
+	}
+	var update SavedEncounter
+	if !bindSavedEncounter(c, &update) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	campaign, ok := loadCampaign(c, tx, c.Param("campaign"), false, ActionUpdateAnyCampaign)
+	if !ok {
+		return
+	}
+
+	var e SavedEncounter
+	err = scanSavedEncounter(tx.QueryRow(ctx, savedEncounterQuery+" WHERE e.id = $1 AND e.campaign_id = $2 FOR UPDATE OF e", id, campaign.ID), &e)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Encounter not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	// Beasts already in the encounter may stay while they are in the trash
+	kept := make(map[string]bool, len(e.Beasts))
+	for _, b := range e.Beasts {
+		kept[b.Key] = true
+	}
+
+	e.Name, e.Notes, e.Beasts = update.Name, update.Notes, update.Beasts
+	err = tx.QueryRow(ctx, "UPDATE encounters SET name=$1, notes=$2, updated_at=now() WHERE id=$3 RETURNING updated_at",
+		e.Name, e.Notes, e.ID).Scan(&e.UpdatedAt)
+	if err != nil {
+		requestLogger(c).Error("Error updating database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM encounter_beasts WHERE encounter_id=$1", e.ID); err != nil {
+		requestLogger(c).Error("Error deleting from database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !saveEncounterBeasts(c, tx, e.ID, e.Beasts, kept) {
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		requestLogger(c).Error("Error committing transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, e)
+}
+
+// DeleteCampaignEncounter deletes a saved encounter
+func DeleteCampaignEncounter(c *gin.Context) {
+	id, ok := encounterParam(c)
+	if !ok {
+		return
+	}
+	campaign, ok := loadCampaign(c, dbPool, c.Param("campaign"), false, ActionUpdateAnyCampaign)
+	if !ok {
+		return
+	}
+
+	tag, err := dbPool.Exec(c.Request.Context(), "DELETE FROM encounters WHERE id=$1 AND campaign_id=$2", id, campaign.ID)
+	if err != nil {
+		requestLogger(c).Error("Error deleting from database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, "Encounter not found")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// bindSavedEncounter reads and checks a saved encounter from the request body, writing a 400 response if
+// it is invalid
+func bindSavedEncounter(c *gin.Context, e *SavedEncounter) bool {
+	if err := c.ShouldBindJSON(e); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return false
+	}
+	if e.Name == "" {
+		respondError(c, http.StatusBadRequest, "Name is required")
+		return false
+	}
+	if e.Beasts == nil {
+		e.Beasts = []EncounterBeast{}
+	}
+	seen := make(map[string]bool, len(e.Beasts))
+	for i, b := range e.Beasts {
+		if b.Count < 1 {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid count for %q, expected at least 1", b.Key))
+			return false
+		}
+		if seen[b.Key] {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Beast %q is listed twice", b.Key))
+			return false
+		}
+		seen[b.Key] = true
+		// Only the key and count are stored
+		e.Beasts[i] = EncounterBeast{Key: b.Key, Count: b.Count}
+	}
+	return true
+}
+
+// saveEncounterBeasts stores the beasts of an encounter in order. The beasts must exist and be visible to the
+// caller, and be out of the trash unless they are kept from before; they are locked until commit so they
+// cannot be deleted meanwhile. It writes the error response and returns false on failure.
+func saveEncounterBeasts(c *gin.Context, tx pgx.Tx, encounterID int64, beasts []EncounterBeast, kept map[string]bool) bool {
+	if len(beasts) == 0 {
+		return true
+	}
+	ctx := c.Request.Context()
+	keys := make([]string, len(beasts))
+	counts := make([]int, len(beasts))
+	for i, b := range beasts {
+		keys[i], counts[i] = b.Key, b.Count
+	}
+
+	filter, args := visibilityFilter(CurrentPrincipal(c), 1)
+	rows, err := tx.Query(ctx, "SELECT beast_name, deleted_at IS NOT NULL FROM beasts WHERE beast_name = ANY($1) AND "+filter+" FOR SHARE",
+		append([]interface{}{keys}, args...)...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	found := make(map[string]bool, len(keys))
+	for rows.Next() {
+		var name string
+		var trashed bool
+		if err := rows.Scan(&name, &trashed); err != nil {
+			rows.Close()
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+		found[name] = !trashed || kept[name]
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	for _, key := range keys {
+		if !found[key] {
+			respondError(c, http.StatusNotFound, fmt.Sprintf("Beast %q not found", key))
+			return false
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO encounter_beasts (encounter_id, beast_name, count, position)
+		SELECT $1, b.name, b.count, b.position FROM unnest($2::text[], $3::int[]) WITH ORDINALITY AS b(name, count, position)`,
+		encounterID, keys, counts)
+	if err != nil {
+		requestLogger(c).Error("Error inserting into database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	return true
+}
+
+// releaseEncounterBeasts applies the beast delete policy to the saved encounters using a beast about to be
+// deleted. It writes the error response and returns false if the delete may not go ahead.
+// Cascading leaves the encounters alone so that restoring the beast brings it back; purging it removes it from them.
+func releaseEncounterBeasts(c *gin.Context, tx pgx.Tx, key string) bool {
+	if beastDeletePolicy == BeastDeleteCascade {
+		return true
+	}
+
+	ctx := c.Request.Context()
+	var uses int
+	if err := tx.QueryRow(ctx, "SELECT count(*) FROM encounter_beasts WHERE beast_name=$1", key).Scan(&uses); err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	if uses > 0 {
+		respondError(c, http.StatusConflict, fmt.Sprintf("Beast is used by %d saved encounters", uses))
+		return false
+	}
+	return true
+}
+
+// encounterParam parses the encounter ID in the path, writing a 400 response if it is invalid
+func encounterParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		respondError(c, http.StatusBadRequest, "Invalid encounter ID")
+		return 0, false
+	}
+	return id, true
+}
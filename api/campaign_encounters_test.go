@@ -0,0 +1,253 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var savedEncounterColumns = []string{"id", "campaign_id", "name", "notes", "owner", "created_at", "updated_at", "beasts"}
+
+var encounterBeastColumns = []string{"beast_name", "trashed"}
+
+var beastsQuery = regexp.QuoteMeta("SELECT beast_name, deleted_at IS NOT NULL FROM beasts WHERE beast_name = ANY($1)")
+
+// expectCampaign expects the campaign curse-of-strahd, owned by dm-1, to be loaded
+func expectCampaign(mock pgxmock.PgxPoolIface) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM campaigns WHERE id=$1")).WithArgs("curse-of-strahd").
+		WillReturnRows(mock.NewRows(campaignRowColumns).
+			AddRow("curse-of-strahd", "Curse of Strahd", "", "dm-1", campaignCreated))
+}
+
+func TestListCampaignEncounters(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	expectCampaign(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM encounters e WHERE e.campaign_id = $1 ORDER BY e.id")).WithArgs("curse-of-strahd").
+		WillReturnRows(mock.NewRows(savedEncounterColumns).
+			AddRow(int64(1), "curse-of-strahd", "Death House", "Basement", "dm-1", campaignCreated, campaignCreated,
+				[]EncounterBeast{{Key: "Mimic", Count: 2}}))
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "player-1", Roles: []string{RoleViewer}, Campaigns: []string{"curse-of-strahd"}}))
+	router.GET("/campaigns/:campaign/encounters", ListCampaignEncounters)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/campaigns/curse-of-strahd/encounters", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"id":1,"campaign":"curse-of-strahd","name":"Death House","notes":"Basement",
+		"beasts":[{"key":"Mimic","count":2}],"owner":"dm-1",
+		"created_at":"2024-05-01T12:00:00Z","updated_at":"2024-05-01T12:00:00Z"}]`, w.Body.String())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateCampaignEncounter(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		found   []string
+		trashed string
+		code    int
+	}{
+		{"Created", `{"name":"Death House","beasts":[{"key":"Mimic","count":2},{"key":"Owlbear","count":1}]}`, []string{"Owlbear", "Mimic"}, "", http.StatusCreated},
+		{"UnknownBeast", `{"name":"Death House","beasts":[{"key":"Mimic","count":2},{"key":"Tarrasque","count":1}]}`, []string{"Mimic"}, "", http.StatusNotFound},
+		{"TrashedBeast", `{"name":"Death House","beasts":[{"key":"Mimic","count":2},{"key":"Owlbear","count":1}]}`, []string{"Owlbear", "Mimic"}, "Owlbear", http.StatusNotFound},
+		{"DuplicateBeast", `{"name":"Death House","beasts":[{"key":"Mimic","count":2},{"key":"Mimic","count":1}]}`, nil, "", http.StatusBadRequest},
+		{"NoName", `{"beasts":[{"key":"Mimic","count":2}]}`, nil, "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			if tt.found != nil {
+				mock.ExpectBegin()
+				expectCampaign(mock)
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO encounters (campaign_id, name, notes, owner)")).
+					WithArgs("curse-of-strahd", "Death House", "", "dm-2").
+					WillReturnRows(mock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(int64(5), campaignCreated, campaignCreated))
+				rows := mock.NewRows(encounterBeastColumns)
+				for _, name := range tt.found {
+					rows.AddRow(name, name == tt.trashed)
+				}
+				mock.ExpectQuery(beastsQuery).WithArgs(pgxmock.AnyArg(), "dm-2", []string{"curse-of-strahd"}).WillReturnRows(rows)
+				if tt.code == http.StatusCreated {
+					mock.ExpectExec(regexp.QuoteMeta("INSERT INTO encounter_beasts (encounter_id, beast_name, count, position)")).
+						WithArgs(int64(5), []string{"Mimic", "Owlbear"}, []int{2, 1}).
+						WillReturnResult(pgxmock.NewResult("INSERT", 2))
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			// Members of the campaign may save encounters in it
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-2", Roles: []string{RoleEditor}, Campaigns: []string{"curse-of-strahd"}}))
+			router.POST("/campaigns/:campaign/encounters", CreateCampaignEncounter)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/campaigns/curse-of-strahd/encounters", bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestUpdateCampaignEncounter_TrashedBeast(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	// The Mimic was trashed after being saved in the encounter, so it may stay there
+	mock.ExpectBegin()
+	expectCampaign(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM encounters e WHERE e.id = $1 AND e.campaign_id = $2 FOR UPDATE OF e")).WithArgs(int64(5), "curse-of-strahd").
+		WillReturnRows(mock.NewRows(savedEncounterColumns).
+			AddRow(int64(5), "curse-of-strahd", "Death House", "", "dm-1", campaignCreated, campaignCreated,
+				[]EncounterBeast{{Key: "Mimic", Count: 2}}))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE encounters SET name=$1, notes=$2, updated_at=now() WHERE id=$3")).
+		WithArgs("Death House", "Basement", int64(5)).
+		WillReturnRows(mock.NewRows([]string{"updated_at"}).AddRow(campaignCreated))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM encounter_beasts WHERE encounter_id=$1")).WithArgs(int64(5)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectQuery(beastsQuery).WithArgs([]string{"Mimic"}, "dm-1", []string(nil)).
+		WillReturnRows(mock.NewRows(encounterBeastColumns).AddRow("Mimic", true))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO encounter_beasts (encounter_id, beast_name, count, position)")).
+		WithArgs(int64(5), []string{"Mimic"}, []int{3}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.PUT("/campaigns/:campaign/encounters/:id", UpdateCampaignEncounter)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/campaigns/curse-of-strahd/encounters/5",
+		bytes.NewBufferString(`{"name":"Death House","notes":"Basement","beasts":[{"key":"Mimic","count":3}]}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteCampaignEncounter(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	expectCampaign(mock)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM encounters WHERE id=$1 AND campaign_id=$2")).WithArgs(int64(5), "curse-of-strahd").
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.DELETE("/campaigns/:campaign/encounters/:id", DeleteCampaignEncounter)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/campaigns/curse-of-strahd/encounters/5", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteItem_UsedByEncounters(t *testing.T) {
+	defer SetBeastDeletePolicy(BeastDeleteRestrict)
+
+	tests := []struct {
+		policy string
+		code   int
+	}{
+		{BeastDeleteRestrict, http.StatusConflict},
+		{BeastDeleteCascade, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			require.NoError(t, SetBeastDeletePolicy(tt.policy))
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(lockQuery).WithArgs("Mimic").
+				WillReturnRows(mock.NewRows(beastRowColumns).
+					AddRow("Mimic", "Monstrosity", "2", map[string]string{}, "", "dm-1", "public", "", 0, "", "", "", "", []string{}, "", 0))
+			if tt.policy == BeastDeleteRestrict {
+				mock.ExpectQuery(encounterUsesQuery).WithArgs("Mimic").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE beasts SET deleted_at = now() WHERE beast_name=$1")).WithArgs("Mimic").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectExec(auditInsert).WithArgs("Mimic", "dm-1", AuditDelete, pgxmock.AnyArg(), []byte(nil), nil).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(eventInsert).WithArgs("Mimic", AuditDelete, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+			router.DELETE("/beasts/:key", DeleteItem)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/beasts/Mimic", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestSetBeastDeletePolicy(t *testing.T) {
+	defer SetBeastDeletePolicy(BeastDeleteRestrict)
+	assert.Error(t, SetBeastDeletePolicy("ignore"))
+	assert.NoError(t, SetBeastDeletePolicy(BeastDeleteCascade))
+}
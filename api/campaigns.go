@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/keremenci/bestiary-crud/auth"
+)
+
+// Campaign groups saved encounters. Its ID is the slug beasts are shared with.
+type Campaign struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Owner       string    `json:"owner"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// campaignIDPattern matches valid campaign IDs, such as "curse-of-strahd"
+var campaignIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// campaignColumns are the columns scanned by scanCampaign
+const campaignColumns = "id, name, description, owner, created_at"
+
+func scanCampaign(row pgx.Row, campaign *Campaign) error {
+	return row.Scan(&campaign.ID, &campaign.Name, &campaign.Description, &campaign.Owner, &campaign.CreatedAt)
+}
+
+// isMember reports whether the principal's token lists the campaign
+func isMember(p *auth.Principal, campaign string) bool {
+	if p == nil {
+		return false
+	}
+	for _, c := range p.Campaigns {
+		if c == campaign {
+			return true
+		}
+	}
+	return false
+}
+
+// canUseCampaign reports whether the principal may see the campaign and manage its encounters:
+// its owner and members may, as may roles allowed the given action on every campaign.
+func canUseCampaign(p *auth.Principal, campaign Campaign, anyAction string) bool {
+	if policy.Allows(p, anyAction) {
+		return true
+	}
+	return p != nil && (campaign.Owner == p.Subject || isMember(p, campaign.ID))
+}
+
+// campaignFilter returns a SQL condition restricting campaigns to the ones the principal may see.
+// Its placeholders are numbered after the first n arguments of the surrounding query.
+func campaignFilter(p *auth.Principal, n int) (string, []interface{}) {
+	if policy.Allows(p, ActionViewAnyCampaign) {
+		return "TRUE", nil
+	}
+	if p == nil {
+		return "FALSE", nil
+	}
+	return fmt.Sprintf("(owner = $%d OR id = ANY($%d))", n+1, n+2), []interface{}{p.Subject, p.Campaigns}
+}
+
+// ListCampaigns returns the campaigns the caller owns or is a member of
+func ListCampaigns(c *gin.Context) {
+	filter, args := campaignFilter(CurrentPrincipal(c), 0)
+	rows, err := dbPool.Query(c.Request.Context(), "SELECT "+campaignColumns+" FROM campaigns WHERE "+filter+" ORDER BY id", args...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	campaigns := []Campaign{}
+	for rows.Next() {
+		var campaign Campaign
+		if err := scanCampaign(rows, &campaign); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaigns)
+}
+
+// CreateCampaign creates a campaign owned by the caller
+func CreateCampaign(c *gin.Context) {
+	var campaign Campaign
+	if err := c.ShouldBindJSON(&campaign); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if !campaignIDPattern.MatchString(campaign.ID) {
+		respondError(c, http.StatusBadRequest, "Invalid id, expected lowercase letters, digits and dashes")
+		return
+	}
+	if campaign.Name == "" {
+		respondError(c, http.StatusBadRequest, "Name is required")
+		return
+	}
+	campaign.Owner = actorOf(c)
+
+	err := dbPool.QueryRow(c.Request.Context(), `
+		INSERT INTO campaigns (id, name, description, owner) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING RETURNING created_at`,
+		campaign.ID, campaign.Name, campaign.Description, campaign.Owner).Scan(&campaign.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusConflict, "Campaign already exists")
+		} else {
+			requestLogger(c).Error("Error inserting into database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// GetCampaign returns a campaign the caller may use
+func GetCampaign(c *gin.Context) {
+	campaign, ok := loadCampaign(c, dbPool, c.Param("campaign"), false, ActionViewAnyCampaign)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+// UpdateCampaign changes the name and description of a campaign. Only its owner or a moderator may.
+func UpdateCampaign(c *gin.Context) {
+	var update Campaign
+	if err := c.ShouldBindJSON(&update); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if update.Name == "" {
+		respondError(c, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	campaign, ok := loadCampaign(c, tx, c.Param("campaign"), true, ActionUpdateAnyCampaign)
+	if !ok {
+		return
+	}
+	if !canModify(CurrentPrincipal(c), campaign.Owner, ActionUpdateAnyCampaign) {
+		abortWithProblem(c, http.StatusForbidden, "Only the owner or a moderator can modify this campaign")
+		return
+	}
+
+	campaign.Name, campaign.Description = update.Name, update.Description
+	if _, err := tx.Exec(ctx, "UPDATE campaigns SET name=$1, description=$2 WHERE id=$3", campaign.Name, campaign.Description, campaign.ID); err != nil {
+		requestLogger(c).Error("Error updating database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		requestLogger(c).Error("Error committing transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// DeleteCampaign deletes a campaign along with its encounters. Only its owner or a moderator may.
+func DeleteCampaign(c *gin.Context) {
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	campaign, ok := loadCampaign(c, tx, c.Param("campaign"), true, ActionDeleteAnyCampaign)
+	if !ok {
+		return
+	}
+	if !canModify(CurrentPrincipal(c), campaign.Owner, ActionDeleteAnyCampaign) {
+		abortWithProblem(c, http.StatusForbidden, "Only the owner or a moderator can delete this campaign")
+		return
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM campaigns WHERE id=$1", campaign.ID); err != nil {
+		requestLogger(c).Error("Error deleting from database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		requestLogger(c).Error("Error committing transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// querier is the part of DBPool and pgx.Tx used to read rows
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// loadCampaign loads a campaign the caller may use, locking it when forUpdate is set. Campaigns the caller
+// may not use are reported as not found. It writes the error response and returns false if there is none.
+func loadCampaign(c *gin.Context, q querier, id string, forUpdate bool, anyAction string) (Campaign, bool) {
+	var campaign Campaign
+	query := "SELECT " + campaignColumns + " FROM campaigns WHERE id=$1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	err := scanCampaign(q.QueryRow(c.Request.Context(), query, id), &campaign)
+	if err == nil && !canUseCampaign(CurrentPrincipal(c), campaign, anyAction) {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Campaign not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return campaign, false
+	}
+	return campaign, true
+}
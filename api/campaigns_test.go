@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var campaignRowColumns = []string{"id", "name", "description", "owner", "created_at"}
+
+var campaignCreated = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestListCampaigns(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		query     string
+		args      []interface{}
+	}{
+		{"Member", &auth.Principal{Subject: "dm-1", Roles: []string{RoleViewer}, Campaigns: []string{"curse-of-strahd"}},
+			"FROM campaigns WHERE (owner = $1 OR id = ANY($2)) ORDER BY id", []interface{}{"dm-1", []string{"curse-of-strahd"}}},
+		{"Moderator", &auth.Principal{Subject: "mod-1", Roles: []string{RoleModerator}}, "FROM campaigns WHERE TRUE ORDER BY id", nil},
+		{"BeastModerator", &auth.Principal{Subject: "mod-1", Roles: []string{RoleEditor}},
+			"FROM campaigns WHERE (owner = $1 OR id = ANY($2)) ORDER BY id", []interface{}{"mod-1", []string(nil)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			// Editors moderating beasts don't moderate campaigns with them
+			beastModerators, _ := DefaultPolicy().With(map[string][]string{ActionViewAnyBeast: {RoleEditor}})
+			SetPolicy(beastModerators)
+			defer SetPolicy(DefaultPolicy())
+
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).WithArgs(tt.args...).
+				WillReturnRows(mock.NewRows(campaignRowColumns).
+					AddRow("curse-of-strahd", "Curse of Strahd", "", "dm-2", campaignCreated))
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(tt.principal))
+			router.GET("/campaigns", ListCampaigns)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/campaigns", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `[{"id":"curse-of-strahd","name":"Curse of Strahd","description":"","owner":"dm-2",
+				"created_at":"2024-05-01T12:00:00Z"}]`, w.Body.String())
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCreateCampaign(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		exists bool
+		code   int
+	}{
+		{"Created", `{"id":"curse-of-strahd","name":"Curse of Strahd"}`, false, http.StatusCreated},
+		{"Exists", `{"id":"curse-of-strahd","name":"Curse of Strahd"}`, true, http.StatusConflict},
+		{"InvalidID", `{"id":"Curse of Strahd","name":"Curse of Strahd"}`, false, http.StatusBadRequest},
+		{"NoName", `{"id":"curse-of-strahd"}`, false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+
+			if tt.code != http.StatusBadRequest {
+				rows := mock.NewRows([]string{"created_at"})
+				if !tt.exists {
+					rows.AddRow(campaignCreated)
+				}
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO campaigns (id, name, description, owner)")).
+					WithArgs("curse-of-strahd", "Curse of Strahd", "", "dm-1").
+					WillReturnRows(rows)
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+			router.POST("/campaigns", CreateCampaign)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/campaigns", bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetCampaign_Access(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		code      int
+	}{
+		{"Owner", &auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}, http.StatusOK},
+		{"Member", &auth.Principal{Subject: "player-1", Roles: []string{RoleViewer}, Campaigns: []string{"curse-of-strahd"}}, http.StatusOK},
+		{"Moderator", &auth.Principal{Subject: "mod-1", Roles: []string{RoleModerator}}, http.StatusOK},
+		{"Outsider", &auth.Principal{Subject: "dm-2", Roles: []string{RoleEditor}}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			mock.ExpectQuery(regexp.QuoteMeta("FROM campaigns WHERE id=$1")).WithArgs("curse-of-strahd").
+				WillReturnRows(mock.NewRows(campaignRowColumns).
+					AddRow("curse-of-strahd", "Curse of Strahd", "", "dm-1", campaignCreated))
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(tt.principal))
+			router.GET("/campaigns/:campaign", GetCampaign)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/campaigns/curse-of-strahd", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestDeleteCampaign(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		code      int
+	}{
+		{"Owner", &auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}, http.StatusNoContent},
+		{"Member", &auth.Principal{Subject: "dm-2", Roles: []string{RoleEditor}, Campaigns: []string{"curse-of-strahd"}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("FROM campaigns WHERE id=$1 FOR UPDATE")).WithArgs("curse-of-strahd").
+				WillReturnRows(mock.NewRows(campaignRowColumns).
+					AddRow("curse-of-strahd", "Curse of Strahd", "", "dm-1", campaignCreated))
+			if tt.code == http.StatusNoContent {
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM campaigns WHERE id=$1")).WithArgs("curse-of-strahd").
+					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(tt.principal))
+			router.DELETE("/campaigns/:campaign", DeleteCampaign)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("DELETE", "/campaigns/curse-of-strahd", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
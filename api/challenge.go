@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/dice"
+	"github.com/keremenci/bestiary-crud/rules"
+)
+
+// CRRequest holds the statistics to rate. Those left out are worked out from HitDice and the
+// attacks in Description, so a beast can be sent as it is.
+type CRRequest struct {
+	HitPoints      int    `json:"HitPoints"`
+	ArmorClass     int    `json:"ArmorClass"`
+	DamagePerRound int    `json:"DamagePerRound"`
+	AttackBonus    int    `json:"AttackBonus"`
+	SaveDC         int    `json:"SaveDC"`
+	HitDice        string `json:"HitDice"`
+	Description    string `json:"Description"`
+}
+
+var multiattackPattern = regexp.MustCompile(`(?m)^\s*Multiattack\.`)
+
+// rateChallenge fills in the statistics missing from the request and rates them, explaining
+// where each one came from before the steps of the rating itself
+func rateChallenge(req CRRequest) (rules.Rating, error) {
+	if req.HitPoints < 0 || req.ArmorClass < 0 || req.DamagePerRound < 0 || req.SaveDC < 0 {
+		return rules.Rating{}, errors.New("statistics can't be negative")
+	}
+	var steps []string
+	if req.HitPoints == 0 {
+		if req.HitDice == "" {
+			return rules.Rating{}, errors.New("missing HitPoints or HitDice")
+		}
+		hd, err := rules.ParseHitDice(req.HitDice)
+		if err != nil {
+			return rules.Rating{}, err
+		}
+		req.HitPoints = hd.Average()
+		steps = append(steps, fmt.Sprintf("Hit points are %d, the average of %s", req.HitPoints, hd))
+	}
+
+	attacks := dice.FindAttacks(req.Description)
+	if req.DamagePerRound == 0 && len(attacks) > 0 {
+		var step string
+		req.DamagePerRound, step = damagePerRound(attacks, multiattackPattern.MatchString(req.Description))
+		steps = append(steps, step)
+	}
+	if req.AttackBonus == 0 && req.SaveDC == 0 {
+		for _, a := range attacks {
+			req.AttackBonus = max(req.AttackBonus, a.ToHit)
+		}
+		if req.AttackBonus > 0 {
+			steps = append(steps, fmt.Sprintf("Attack bonus is %+d, the best of the attacks", req.AttackBonus))
+		} else {
+			for _, dc := range rules.SaveDCs(req.Description) {
+				req.SaveDC = max(req.SaveDC, dc)
+			}
+			if req.SaveDC > 0 {
+				steps = append(steps, fmt.Sprintf("Save DC is %d, the highest in the description", req.SaveDC))
+			}
+		}
+	}
+
+	rating := rules.RateChallenge(
+		rules.Defense{HitPoints: req.HitPoints, ArmorClass: req.ArmorClass},
+		rules.Offense{DamagePerRound: req.DamagePerRound, AttackBonus: req.AttackBonus, SaveDC: req.SaveDC})
+	rating.Steps = append(steps, rating.Steps...)
+	return rating, nil
+}
+
+// damagePerRound adds up the average damage of every attack for creatures with Multiattack
+// and takes the most damaging attack otherwise
+func damagePerRound(attacks []dice.Attack, multiattack bool) (int, string) {
+	var total, best float64
+	var names []string
+	bestName := ""
+	for _, a := range attacks {
+		damage := 0.0
+		for _, d := range a.Damage {
+			damage += d.Dice.Average()
+		}
+		total += damage
+		names = append(names, fmt.Sprintf("%s (%g)", a.Name, damage))
+		if damage > best || bestName == "" {
+			best, bestName = damage, fmt.Sprintf("%s (%g)", a.Name, damage)
+		}
+	}
+	if multiattack {
+		return int(total), fmt.Sprintf("Damage per round is %d, with Multiattack using %s", int(total), strings.Join(names, ", "))
+	}
+	return int(best), fmt.Sprintf("Damage per round is %d, from the most damaging attack %s", int(best), bestName)
+}
+
+// crWarning compares a beast's CR with the one its stat block suggests. It only rates beasts
+// with hit dice and attacks, and returns "" when the two are at most one step apart.
+func crWarning(beast Beast) string {
+	if beast.HitDice == "" || len(dice.FindAttacks(beast.Description)) == 0 {
+		return ""
+	}
+	rating, err := rateChallenge(CRRequest{ArmorClass: beast.ArmorClass, HitDice: beast.HitDice, Description: beast.Description})
+	if err != nil {
+		return ""
+	}
+	if n, err := rules.CRDistance(beast.CR, rating.CR); err != nil || n <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("CR %s is given but the stat block suggests CR %s, see POST /beasts/calculate-cr", beast.CR, rating.CR)
+}
+
+// CalculateCR estimates the challenge rating of the statistics in the request
+func CalculateCR(c *gin.Context) {
+	var req CRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	rating, err := rateChallenge(req)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, rating)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateCR(t *testing.T) {
+	router := gin.Default()
+	router.POST("/beasts/calculate-cr", CalculateCR)
+
+	calculate := func(body string) (int, rules.Rating) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/beasts/calculate-cr", bytes.NewBufferString(body))
+		router.ServeHTTP(w, req)
+		var rating rules.Rating
+		json.Unmarshal(w.Body.Bytes(), &rating)
+		return w.Code, rating
+	}
+
+	code, rating := calculate(`{"HitPoints":150,"ArmorClass":15,"DamagePerRound":40,"AttackBonus":6}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "6", rating.CR)
+	assert.Len(t, rating.Steps, 5)
+
+	owlbear, _ := json.Marshal(Beast{BeastName: "Owlbear", CR: "3", ArmorClass: 13, HitDice: "7d10+21", Description: owlbearDescription})
+	code, rating = calculate(string(owlbear))
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "1/2", rating.DefensiveCR)
+	assert.Equal(t, "3", rating.OffensiveCR)
+	assert.Equal(t, "2", rating.CR)
+	assert.Equal(t, []string{
+		"Hit points are 59, the average of 7d10+21",
+		"Damage per round is 14, from the most damaging attack Claws (14)",
+		"Attack bonus is +7, the best of the attacks",
+	}, rating.Steps[:3])
+
+	multiattack, _ := json.Marshal(CRRequest{HitPoints: 59, Description: "Multiattack. The owlbear makes two attacks.\n" + owlbearDescription})
+	_, rating = calculate(string(multiattack))
+	assert.Equal(t, "Damage per round is 24, with Multiattack using Beak (10.5), Claws (14)", rating.Steps[0])
+
+	_, rating = calculate(`{"HitPoints":120,"Description":"Fire Breath. Each creature must make a DC 15 Dexterity saving throw."}`)
+	assert.Equal(t, "Save DC is 15, the highest in the description", rating.Steps[0])
+
+	for _, body := range []string{`{"ArmorClass":15}`, `{"HitDice":"7d7"}`, `{"HitPoints":-1}`, `[]`} {
+		code, _ = calculate(body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+}
+
+func TestCRWarning(t *testing.T) {
+	owlbear := Beast{CR: "3", ArmorClass: 13, HitDice: "7d10+21", Description: owlbearDescription}
+	assert.Empty(t, crWarning(owlbear))
+
+	owlbear.CR = "10"
+	assert.Equal(t, "CR 10 is given but the stat block suggests CR 2, see POST /beasts/calculate-cr", crWarning(owlbear))
+
+	owlbear.HitDice = ""
+	assert.Empty(t, crWarning(owlbear))
+}
@@ -0,0 +1,682 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/keremenci/bestiary-crud/rules"
+)
+
+// Combat is a combat session: combatants in initiative order and whose turn it is
+type Combat struct {
+	ID         int64       `json:"id"`
+	Name       string      `json:"name"`
+	Owner      string      `json:"owner"`
+	Round      int         `json:"round"`
+	Turn       *int64      `json:"turn"`
+	Combatants []Combatant `json:"combatants,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Combatant is an instance of a beast, or a player character when Beast is empty, taking part in a combat.
+// Hit points of player characters are only tracked when MaxHP is set.
+type Combatant struct {
+	ID          int64    `json:"id"`
+	Beast       string   `json:"beast,omitempty"`
+	Name        string   `json:"name"`
+	Initiative  int      `json:"initiative"`
+	DexModifier int      `json:"dex_modifier"`
+	ArmorClass  int      `json:"armor_class,omitempty"`
+	MaxHP       int      `json:"max_hp,omitempty"`
+	HP          int      `json:"hp"`
+	Conditions  []string `json:"conditions"`
+}
+
+// defeated reports whether the combatant is a beast at 0 hit points, which no longer takes turns.
+// Player characters at 0 hit points still make death saving throws on their turn.
+func (cb Combatant) defeated() bool {
+	return cb.Beast != "" && cb.HP == 0
+}
+
+// CombatantRequest adds count instances of a beast, or a player character when Key is empty.
+// Beasts roll their initiative and hit points unless given.
+type CombatantRequest struct {
+	Key        string `json:"key"`
+	Count      int    `json:"count"`
+	Name       string `json:"name"`
+	Initiative *int   `json:"initiative"`
+	HP         int    `json:"hp"`
+	ArmorClass int    `json:"armor_class"`
+}
+
+// CombatRequest starts a combat. The same seed and beasts give the same rolls.
+type CombatRequest struct {
+	Name       string             `json:"name"`
+	Combatants []CombatantRequest `json:"combatants"`
+	Seed       *uint64            `json:"seed"`
+}
+
+// addCombatantsRequest adds combatants to a running combat. The same seed and beasts give the same rolls.
+type addCombatantsRequest struct {
+	Combatants []CombatantRequest `json:"combatants"`
+	Seed       *uint64            `json:"seed"`
+}
+
+// maxHitPoints bounds the hit points of a combatant and the damage or healing applied at once
+const maxHitPoints = 1_000_000
+
+// combatSessionColumns are the columns scanned by scanCombat
+const combatSessionColumns = "id, name, owner, round, current_combatant, created_at, updated_at"
+
+func scanCombat(row pgx.Row, combat *Combat) error {
+	return row.Scan(&combat.ID, &combat.Name, &combat.Owner, &combat.Round, &combat.Turn, &combat.CreatedAt, &combat.UpdatedAt)
+}
+
+// combatantColumns are the columns scanned into a Combatant, in initiative order
+const combatantColumns = "id, COALESCE(beast_name, ''), name, initiative, dex_modifier, armor_class, max_hp, current_hp, conditions"
+
+// sortCombatants orders combatants by initiative, breaking ties by DEX modifier and then by when they joined
+func sortCombatants(combatants []Combatant) {
+	sort.SliceStable(combatants, func(i, j int) bool {
+		a, b := combatants[i], combatants[j]
+		if a.Initiative != b.Initiative {
+			return a.Initiative > b.Initiative
+		}
+		if a.DexModifier != b.DexModifier {
+			return a.DexModifier > b.DexModifier
+		}
+		return a.ID < b.ID
+	})
+}
+
+// nextTurn returns the combatant acting after current, skipping defeated beasts and the excluded combatant,
+// and whether a new round starts. Without a current combatant the first one able to act is returned.
+func nextTurn(combatants []Combatant, current *int64, exclude int64) (next int64, newRound bool, ok bool) {
+	start := -1
+	if current != nil {
+		for i, cb := range combatants {
+			if cb.ID == *current {
+				start = i
+				break
+			}
+		}
+	}
+	for step := 1; step <= len(combatants); step++ {
+		i := start + step
+		if i >= len(combatants) {
+			i -= len(combatants)
+			if start >= 0 {
+				newRound = true
+			}
+		}
+		if cb := combatants[i]; cb.ID != exclude && !cb.defeated() {
+			return cb.ID, newRound, true
+		}
+	}
+	return 0, false, false
+}
+
+// ListCombats returns the combat sessions of the caller, without their combatants.
+// Moderators see everyone's.
+func ListCombats(c *gin.Context) {
+	query := "SELECT " + combatSessionColumns + " FROM combat_sessions"
+	var args []interface{}
+	if !policy.Allows(CurrentPrincipal(c), ActionRunAnyCombat) {
+		query += " WHERE owner = $1"
+		args = append(args, actorOf(c))
+	}
+	rows, err := dbPool.Query(c.Request.Context(), query+" ORDER BY id", args...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	combats := []Combat{}
+	for rows.Next() {
+		var combat Combat
+		if err := scanCombat(rows, &combat); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		combats = append(combats, combat)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, combats)
+}
+
+// CreateCombat starts a combat session owned by the caller, rolling initiative and hit points for the beasts.
+// The first combatant in initiative order has the first turn.
+func CreateCombat(c *gin.Context) {
+	var req CombatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if req.Name == "" {
+		respondError(c, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if len(req.Combatants) == 0 {
+		respondError(c, http.StatusBadRequest, "The combat has no combatants")
+		return
+	}
+	combatants, ok := spawnCombatants(c, req.Combatants, req.Seed, 0)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	combat := Combat{Name: req.Name, Owner: actorOf(c)}
+	err = tx.QueryRow(ctx, "INSERT INTO combat_sessions (name, owner) VALUES ($1, $2) RETURNING id, round, created_at, updated_at",
+		combat.Name, combat.Owner).Scan(&combat.ID, &combat.Round, &combat.CreatedAt, &combat.UpdatedAt)
+	if err != nil {
+		requestLogger(c).Error("Error inserting into database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !insertCombatants(c, tx, &combat, combatants) {
+		return
+	}
+	if !saveCombat(c, tx, &combat) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, combat)
+}
+
+// GetCombat returns a combat session of the caller with its combatants in initiative order
+func GetCombat(c *gin.Context) {
+	combat, ok := loadCombat(c, dbPool, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, combat)
+}
+
+// DeleteCombat ends a combat session of the caller
+func DeleteCombat(c *gin.Context) {
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	combat, ok := loadCombat(c, tx, true)
+	if !ok {
+		return
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM combat_sessions WHERE id=$1", combat.ID); err != nil {
+		requestLogger(c).Error("Error deleting from database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		requestLogger(c).Error("Error committing transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// NextTurn passes the turn to the next combatant able to act, starting a new round after the last one
+func NextTurn(c *gin.Context) {
+	modifyCombat(c, func(tx pgx.Tx, combat *Combat) bool {
+		next, newRound, ok := nextTurn(combat.Combatants, combat.Turn, 0)
+		if !ok {
+			respondError(c, http.StatusConflict, "No combatant can act")
+			return false
+		}
+		combat.Turn = &next
+		if newRound {
+			combat.Round++
+		}
+		return true
+	})
+}
+
+// AddCombatants adds beasts or player characters to a running combat, keeping the current turn
+func AddCombatants(c *gin.Context) {
+	var req addCombatantsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if len(req.Combatants) == 0 {
+		respondError(c, http.StatusBadRequest, "No combatants to add")
+		return
+	}
+
+	modifyCombat(c, func(tx pgx.Tx, combat *Combat) bool {
+		combatants, ok := spawnCombatants(c, req.Combatants, req.Seed, len(combat.Combatants))
+		if !ok {
+			return false
+		}
+		return insertCombatants(c, tx, combat, combatants)
+	})
+}
+
+// RemoveCombatant removes a combatant from a combat. If it was its turn, the turn passes to the next one.
+func RemoveCombatant(c *gin.Context) {
+	modifyCombat(c, func(tx pgx.Tx, combat *Combat) bool {
+		i, ok := findCombatant(c, combat)
+		if !ok {
+			return false
+		}
+		id := combat.Combatants[i].ID
+		if combat.Turn != nil && *combat.Turn == id {
+			combat.Turn = nil
+			if next, newRound, ok := nextTurn(combat.Combatants, &id, id); ok {
+				combat.Turn = &next
+				if newRound {
+					combat.Round++
+				}
+			}
+		}
+		if _, err := tx.Exec(c.Request.Context(), "DELETE FROM combatants WHERE id=$1", id); err != nil {
+			requestLogger(c).Error("Error deleting from database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+		combat.Combatants = append(combat.Combatants[:i], combat.Combatants[i+1:]...)
+		return true
+	})
+}
+
+// hitPointsRequest is an amount of damage or healing
+type hitPointsRequest struct {
+	Amount int `json:"amount"`
+}
+
+// DamageCombatant lowers the hit points of a combatant, down to 0
+func DamageCombatant(c *gin.Context) {
+	changeHitPoints(c, -1)
+}
+
+// HealCombatant restores the hit points of a combatant, up to its maximum
+func HealCombatant(c *gin.Context) {
+	changeHitPoints(c, 1)
+}
+
+// changeHitPoints applies the requested amount of damage (sign -1) or healing (sign 1) to a combatant
+func changeHitPoints(c *gin.Context, sign int) {
+	var req hitPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if req.Amount < 1 || req.Amount > maxHitPoints {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Amount must be between 1 and %d", maxHitPoints))
+		return
+	}
+
+	modifyCombat(c, func(tx pgx.Tx, combat *Combat) bool {
+		i, ok := findCombatant(c, combat)
+		if !ok {
+			return false
+		}
+		cb := &combat.Combatants[i]
+		if cb.MaxHP == 0 {
+			respondError(c, http.StatusUnprocessableEntity, "The hit points of "+cb.Name+" are not tracked")
+			return false
+		}
+		cb.HP = min(max(cb.HP+sign*req.Amount, 0), cb.MaxHP)
+		if _, err := tx.Exec(c.Request.Context(), "UPDATE combatants SET current_hp=$1 WHERE id=$2", cb.HP, cb.ID); err != nil {
+			requestLogger(c).Error("Error updating database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+		return true
+	})
+}
+
+// AddCondition gives a combatant a condition it does not have yet
+func AddCondition(c *gin.Context) {
+	setCondition(c, true)
+}
+
+// RemoveCondition ends a condition of a combatant
+func RemoveCondition(c *gin.Context) {
+	setCondition(c, false)
+}
+
+// setCondition adds or removes the condition named in the path. Both are idempotent.
+func setCondition(c *gin.Context, present bool) {
+	condition := c.Param("condition")
+	if !rules.IsCondition(condition) {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Unknown condition %q", condition))
+		return
+	}
+
+	modifyCombat(c, func(tx pgx.Tx, combat *Combat) bool {
+		i, ok := findCombatant(c, combat)
+		if !ok {
+			return false
+		}
+		cb := &combat.Combatants[i]
+		conditions := make([]string, 0, len(cb.Conditions)+1)
+		for _, name := range cb.Conditions {
+			if name != condition {
+				conditions = append(conditions, name)
+			}
+		}
+		if present {
+			conditions = append(conditions, condition)
+			sort.Strings(conditions)
+		}
+		cb.Conditions = conditions
+		if _, err := tx.Exec(c.Request.Context(), "UPDATE combatants SET conditions=$1 WHERE id=$2", cb.Conditions, cb.ID); err != nil {
+			requestLogger(c).Error("Error updating database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+		return true
+	})
+}
+
+// modifyCombat locks the combat session in the path, applies change and saves the turn. change writes the
+// error response and returns false to roll back. The updated combat is returned to the caller.
+func modifyCombat(c *gin.Context, change func(tx pgx.Tx, combat *Combat) bool) {
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	combat, ok := loadCombat(c, tx, true)
+	if !ok {
+		return
+	}
+	if !change(tx, &combat) {
+		return
+	}
+	if !saveCombat(c, tx, &combat) {
+		return
+	}
+
+	c.JSON(http.StatusOK, combat)
+}
+
+// saveCombat stores the round and turn of the combat and commits the transaction.
+// It writes the error response and returns false on failure.
+func saveCombat(c *gin.Context, tx pgx.Tx, combat *Combat) bool {
+	ctx := c.Request.Context()
+	err := tx.QueryRow(ctx, "UPDATE combat_sessions SET round=$1, current_combatant=$2, updated_at=now() WHERE id=$3 RETURNING updated_at",
+		combat.Round, combat.Turn, combat.ID).Scan(&combat.UpdatedAt)
+	if err != nil {
+		requestLogger(c).Error("Error updating database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	if err := tx.Commit(ctx); err != nil {
+		requestLogger(c).Error("Error committing transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	return true
+}
+
+// loadCombat loads the combat session in the path along with its combatants, locking it when forUpdate is set.
+// Sessions of other users are reported as not found, except to moderators.
+// It writes the error response and returns false if there is none.
+func loadCombat(c *gin.Context, q querier, forUpdate bool) (Combat, bool) {
+	var combat Combat
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		respondError(c, http.StatusBadRequest, "Invalid combat ID")
+		return combat, false
+	}
+
+	ctx := c.Request.Context()
+	query := "SELECT " + combatSessionColumns + " FROM combat_sessions WHERE id=$1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	err = scanCombat(q.QueryRow(ctx, query, id), &combat)
+	if err == nil && !canModify(CurrentPrincipal(c), combat.Owner, ActionRunAnyCombat) {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Combat not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return combat, false
+	}
+
+	rows, err := q.Query(ctx, "SELECT "+combatantColumns+" FROM combatants WHERE session_id=$1", id)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return combat, false
+	}
+	defer rows.Close()
+
+	combat.Combatants = []Combatant{}
+	for rows.Next() {
+		var cb Combatant
+		if err := rows.Scan(&cb.ID, &cb.Beast, &cb.Name, &cb.Initiative, &cb.DexModifier, &cb.ArmorClass,
+			&cb.MaxHP, &cb.HP, &cb.Conditions); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return combat, false
+		}
+		combat.Combatants = append(combat.Combatants, cb)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return combat, false
+	}
+	sortCombatants(combat.Combatants)
+	return combat, true
+}
+
+// findCombatant returns the index of the combatant in the path. It writes the error response and returns false if there is none.
+func findCombatant(c *gin.Context, combat *Combat) (int, bool) {
+	id, err := strconv.ParseInt(c.Param("combatant"), 10, 64)
+	if err != nil || id < 1 {
+		respondError(c, http.StatusBadRequest, "Invalid combatant ID")
+		return 0, false
+	}
+	for i, cb := range combat.Combatants {
+		if cb.ID == id {
+			return i, true
+		}
+	}
+	respondError(c, http.StatusNotFound, "Combatant not found")
+	return 0, false
+}
+
+// insertCombatants stores new combatants of the combat and sorts them into its initiative order.
+// A combat without a turn yet gives it to the first combatant able to act.
+func insertCombatants(c *gin.Context, tx pgx.Tx, combat *Combat, combatants []Combatant) bool {
+	for i := range combatants {
+		cb := &combatants[i]
+		err := tx.QueryRow(c.Request.Context(), `
+			INSERT INTO combatants (session_id, beast_name, name, initiative, dex_modifier, armor_class, max_hp, current_hp, conditions)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+			combat.ID, nullIfEmpty(cb.Beast), cb.Name, cb.Initiative, cb.DexModifier, cb.ArmorClass, cb.MaxHP, cb.HP, cb.Conditions).Scan(&cb.ID)
+		if err != nil {
+			requestLogger(c).Error("Error inserting into database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+	}
+	combat.Combatants = append(combat.Combatants, combatants...)
+	sortCombatants(combat.Combatants)
+	if combat.Turn == nil {
+		if next, _, ok := nextTurn(combat.Combatants, nil, 0); ok {
+			combat.Turn = &next
+		}
+	}
+	return true
+}
+
+// combatStats are the stats of a beast needed to spawn it into a combat
+type combatStats struct {
+	dexModifier int
+	armorClass  int
+	hitDice     string
+}
+
+// spawnCombatants builds the requested combatants, rolling for beasts visible to the caller with a
+// generator seeded by seed, or a random one. A combat holds at most maxEncounterMonsters combatants,
+// existing ones included. It writes the error response and returns false on failure.
+func spawnCombatants(c *gin.Context, reqs []CombatantRequest, seed *uint64, existing int) ([]Combatant, bool) {
+	var keys []string
+	total := existing
+	for i := range reqs {
+		req := &reqs[i]
+		if req.Key == "" {
+			if req.Name == "" || req.Initiative == nil {
+				respondError(c, http.StatusBadRequest, "Player characters need a name and an initiative")
+				return nil, false
+			}
+			req.Count = 1
+		} else {
+			if req.Count == 0 {
+				req.Count = 1
+			}
+			if req.Count < 1 {
+				respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid count for %q, expected at least 1", req.Key))
+				return nil, false
+			}
+			keys = append(keys, req.Key)
+		}
+		if req.HP < 0 || req.HP > maxHitPoints || req.ArmorClass < 0 || req.ArmorClass > 30 {
+			respondError(c, http.StatusBadRequest, "Invalid hit points or armor class")
+			return nil, false
+		}
+		total += req.Count
+	}
+	if total > maxEncounterMonsters {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Too many combatants, expected at most %d", maxEncounterMonsters))
+		return nil, false
+	}
+
+	stats := map[string]combatStats{}
+	if len(keys) > 0 {
+		var ok bool
+		if stats, ok = loadCombatStats(c, keys); !ok {
+			return nil, false
+		}
+	}
+
+	rng, _ := newRand(seed)
+
+	combatants := make([]Combatant, 0, total-existing)
+	for _, req := range reqs {
+		if req.Key == "" {
+			combatants = append(combatants, Combatant{Name: req.Name, Initiative: *req.Initiative, ArmorClass: req.ArmorClass,
+				MaxHP: req.HP, HP: req.HP, Conditions: []string{}})
+			continue
+		}
+
+		st, found := stats[req.Key]
+		if !found {
+			respondError(c, http.StatusNotFound, fmt.Sprintf("Beast %q not found", req.Key))
+			return nil, false
+		}
+		var hd rules.HitDice
+		if req.HP == 0 {
+			var err error
+			if hd, err = rules.ParseHitDice(st.hitDice); err != nil {
+				respondError(c, http.StatusUnprocessableEntity, fmt.Sprintf("Beast %q has no valid hit dice", req.Key))
+				return nil, false
+			}
+		}
+		name := req.Name
+		if name == "" {
+			name = req.Key
+		}
+		for n := 1; n <= req.Count; n++ {
+			cb := Combatant{Beast: req.Key, Name: name, DexModifier: st.dexModifier, ArmorClass: st.armorClass, Conditions: []string{}}
+			if req.Count > 1 {
+				cb.Name = fmt.Sprintf("%s %d", name, n)
+			}
+			if req.ArmorClass > 0 {
+				cb.ArmorClass = req.ArmorClass
+			}
+			if req.Initiative != nil {
+				cb.Initiative = *req.Initiative
+			} else {
+				cb.Initiative = 1 + rng.IntN(20) + cb.DexModifier
+			}
+			cb.MaxHP = req.HP
+			if cb.MaxHP == 0 {
+				cb.MaxHP = min(hd.Roll(rng), maxHitPoints)
+			}
+			cb.HP = cb.MaxHP
+			combatants = append(combatants, cb)
+		}
+	}
+	return combatants, true
+}
+
+// loadCombatStats returns the combat stats of the beasts visible to the caller among keys. A missing or
+// unreadable DEX score counts as 10. It writes the error response and returns false if the query fails.
+func loadCombatStats(c *gin.Context, keys []string) (map[string]combatStats, bool) {
+	filter, args := visibilityFilter(CurrentPrincipal(c), 1)
+	rows, err := dbPool.Query(c.Request.Context(),
+		"SELECT beast_name, attributes, armor_class, hit_dice FROM beasts WHERE beast_name = ANY($1) AND deleted_at IS NULL AND "+filter,
+		append([]interface{}{keys}, args...)...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	defer rows.Close()
+
+	stats := make(map[string]combatStats, len(keys))
+	for rows.Next() {
+		var name string
+		var attributes map[string]string
+		var st combatStats
+		if err := rows.Scan(&name, &attributes, &st.armorClass, &st.hitDice); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return nil, false
+		}
+		if dex, err := rules.ParseAbilityScore(attributes["DEX"]); err == nil {
+			st.dexModifier = rules.AbilityModifier(dex)
+		}
+		stats[name] = st
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	return stats, true
+}
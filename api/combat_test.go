@@ -0,0 +1,462 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	combatSessionRowColumns = []string{"id", "name", "owner", "round", "current_combatant", "created_at", "updated_at"}
+	combatantRowColumns     = []string{"id", "beast_name", "name", "initiative", "dex_modifier", "armor_class", "max_hp", "current_hp", "conditions"}
+	combatantsQuery         = regexp.QuoteMeta("FROM combatants WHERE session_id=$1")
+	saveCombatQuery         = regexp.QuoteMeta("UPDATE combat_sessions SET round=$1, current_combatant=$2, updated_at=now() WHERE id=$3 RETURNING updated_at")
+)
+
+// expectCombat expects combat 7 of dm-1, in round 2 with the turn of combatant turn, to be locked and loaded
+func expectCombat(mock pgxmock.PgxPoolIface, turn int64) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM combat_sessions WHERE id=$1 FOR UPDATE")).WithArgs(int64(7)).
+		WillReturnRows(mock.NewRows(combatSessionRowColumns).
+			AddRow(int64(7), "Death House", "dm-1", 2, &turn, campaignCreated, campaignCreated))
+	mock.ExpectQuery(combatantsQuery).WithArgs(int64(7)).
+		WillReturnRows(mock.NewRows(combatantRowColumns).
+			AddRow(int64(1), "", "Ireena", 12, 0, 0, 0, 0, []string{}).
+			AddRow(int64(2), "Mimic", "Mimic 1", 15, 1, 12, 58, 40, []string{"grappled"}).
+			AddRow(int64(3), "Mimic", "Mimic 2", 8, 1, 12, 58, 0, []string{}))
+}
+
+func TestNextTurn(t *testing.T) {
+	combatants := []Combatant{{ID: 2, Beast: "Mimic", HP: 40}, {ID: 1}, {ID: 3, Beast: "Mimic", HP: 0}, {ID: 4, Beast: "Owlbear", HP: 10}}
+	id := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name     string
+		current  *int64
+		exclude  int64
+		next     int64
+		newRound bool
+	}{
+		{"Start", nil, 0, 2, false},
+		{"Next", id(2), 0, 1, false},
+		{"SkipsDefeated", id(1), 0, 4, false},
+		{"Wraps", id(4), 0, 2, true},
+		{"Excluded", id(4), 2, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, newRound, ok := nextTurn(combatants, tt.current, tt.exclude)
+			require.True(t, ok)
+			assert.Equal(t, tt.next, next)
+			assert.Equal(t, tt.newRound, newRound)
+		})
+	}
+
+	_, _, ok := nextTurn([]Combatant{{ID: 3, Beast: "Mimic"}}, nil, 0)
+	assert.False(t, ok)
+}
+
+func TestCreateCombat(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT beast_name, attributes, armor_class, hit_dice FROM beasts WHERE beast_name = ANY($1) AND deleted_at IS NULL")).
+		WithArgs([]string{"Owlbear"}, "dm-1", []string(nil)).
+		WillReturnRows(mock.NewRows([]string{"beast_name", "attributes", "armor_class", "hit_dice"}).
+			AddRow("Owlbear", map[string]string{"DEX": "12 (+1)"}, 13, "7d10+21"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO combat_sessions (name, owner) VALUES ($1, $2)")).WithArgs("Death House", "dm-1").
+		WillReturnRows(mock.NewRows([]string{"id", "round", "created_at", "updated_at"}).AddRow(int64(7), 1, campaignCreated, campaignCreated))
+	insertCombatant := regexp.QuoteMeta("INSERT INTO combatants (session_id, beast_name, name, initiative, dex_modifier, armor_class, max_hp, current_hp, conditions)")
+	for i, name := range []string{"Owlbear 1", "Owlbear 2"} {
+		mock.ExpectQuery(insertCombatant).
+			WithArgs(int64(7), "Owlbear", name, pgxmock.AnyArg(), 1, 13, pgxmock.AnyArg(), pgxmock.AnyArg(), []string{}).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(int64(i + 1)))
+	}
+	mock.ExpectQuery(insertCombatant).
+		WithArgs(int64(7), nil, "Ireena", 30, 0, 0, 0, 0, []string{}).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(int64(3)))
+	mock.ExpectQuery(saveCombatQuery).WithArgs(1, pgxmock.AnyArg(), int64(7)).
+		WillReturnRows(mock.NewRows([]string{"updated_at"}).AddRow(campaignCreated))
+	mock.ExpectCommit()
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.POST("/combats", CreateCombat)
+
+	body := `{"name":"Death House","seed":42,"combatants":[{"key":"Owlbear","count":2},{"name":"Ireena","initiative":30}]}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/combats", bytes.NewBufferString(body))
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var combat Combat
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &combat))
+	require.Len(t, combat.Combatants, 3)
+	// A player character with initiative 30 beats any roll of the owlbears
+	assert.Equal(t, "Ireena", combat.Combatants[0].Name)
+	require.NotNil(t, combat.Turn)
+	assert.Equal(t, int64(3), *combat.Turn)
+	for _, cb := range combat.Combatants[1:] {
+		assert.GreaterOrEqual(t, cb.Initiative, 2)
+		assert.LessOrEqual(t, cb.Initiative, 21)
+		assert.GreaterOrEqual(t, cb.MaxHP, 28)
+		assert.LessOrEqual(t, cb.MaxHP, 91)
+		assert.Equal(t, cb.MaxHP, cb.HP)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateCombat_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		rows [][]interface{}
+		code int
+	}{
+		{"NoName", `{"combatants":[{"key":"Owlbear"}]}`, nil, http.StatusBadRequest},
+		{"NoCombatants", `{"name":"Death House"}`, nil, http.StatusBadRequest},
+		{"PlayerWithoutInitiative", `{"name":"Death House","combatants":[{"name":"Ireena"}]}`, nil, http.StatusBadRequest},
+		{"HitPointsTooLarge", `{"name":"Death House","combatants":[{"key":"Owlbear","hp":3000000000}]}`, nil, http.StatusBadRequest},
+		{"UnknownBeast", `{"name":"Death House","combatants":[{"key":"Owlbear"}]}`, [][]interface{}{}, http.StatusNotFound},
+		{"NoHitDice", `{"name":"Death House","combatants":[{"key":"Owlbear"}]}`,
+			[][]interface{}{{"Owlbear", map[string]string{}, 13, ""}}, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			if tt.rows != nil {
+				rows := mock.NewRows([]string{"beast_name", "attributes", "armor_class", "hit_dice"})
+				for _, row := range tt.rows {
+					rows.AddRow(row...)
+				}
+				mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE beast_name = ANY($1)")).
+					WithArgs([]string{"Owlbear"}, "dm-1", []string(nil)).WillReturnRows(rows)
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+			router.POST("/combats", CreateCombat)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/combats", bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetCombat_Access(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		code      int
+	}{
+		{"Owner", &auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}, http.StatusOK},
+		{"Moderator", &auth.Principal{Subject: "mod-1", Roles: []string{RoleModerator}}, http.StatusOK},
+		{"Other", &auth.Principal{Subject: "dm-2", Roles: []string{RoleEditor}}, http.StatusNotFound},
+		{"BeastModerator", &auth.Principal{Subject: "dm-2", Roles: []string{RoleViewer}}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			// Viewers moderating beasts don't run other people's combats with it
+			beastModerators, _ := DefaultPolicy().With(map[string][]string{ActionUpdateAnyBeast: {RoleViewer}})
+			SetPolicy(beastModerators)
+			defer SetPolicy(DefaultPolicy())
+
+			turn := int64(2)
+			mock.ExpectQuery(regexp.QuoteMeta("FROM combat_sessions WHERE id=$1")).WithArgs(int64(7)).
+				WillReturnRows(mock.NewRows(combatSessionRowColumns).
+					AddRow(int64(7), "Death House", "dm-1", 2, &turn, campaignCreated, campaignCreated))
+			if tt.code == http.StatusOK {
+				mock.ExpectQuery(combatantsQuery).WithArgs(int64(7)).
+					WillReturnRows(mock.NewRows(combatantRowColumns).
+						AddRow(int64(1), "", "Ireena", 12, 0, 0, 0, 0, []string{}).
+						AddRow(int64(2), "Mimic", "Mimic", 15, 1, 12, 58, 40, []string{"grappled"}))
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(tt.principal))
+			router.GET("/combats/:id", GetCombat)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/combats/7", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusOK {
+				assert.JSONEq(t, `{"id":7,"name":"Death House","owner":"dm-1","round":2,"turn":2,"combatants":[
+					{"id":2,"beast":"Mimic","name":"Mimic","initiative":15,"dex_modifier":1,"armor_class":12,"max_hp":58,"hp":40,"conditions":["grappled"]},
+					{"id":1,"name":"Ireena","initiative":12,"dex_modifier":0,"hp":0,"conditions":[]}],
+					"created_at":"2024-05-01T12:00:00Z","updated_at":"2024-05-01T12:00:00Z"}`, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestNextTurn_Handler(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	// Ireena is last in round 2 and the second mimic is defeated, so round 3 starts with the first mimic
+	mock.ExpectBegin()
+	expectCombat(mock, 1)
+	mock.ExpectQuery(saveCombatQuery).WithArgs(3, pgxmock.AnyArg(), int64(7)).
+		WillReturnRows(mock.NewRows([]string{"updated_at"}).AddRow(campaignCreated))
+	mock.ExpectCommit()
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.POST("/combats/:id/next", NextTurn)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/combats/7/next", nil)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var combat Combat
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &combat))
+	assert.Equal(t, 3, combat.Round)
+	require.NotNil(t, combat.Turn)
+	assert.Equal(t, int64(2), *combat.Turn)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddCombatants(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"Added", `{"seed":42,"combatants":[{"name":"Strahd","initiative":20,"hp":144}]}`, http.StatusOK},
+		{"NoCombatants", `{"seed":42}`, http.StatusBadRequest},
+		{"Array", `[{"name":"Strahd","initiative":20}]`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			if tt.code == http.StatusOK {
+				mock.ExpectBegin()
+				expectCombat(mock, 2)
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO combatants (session_id, beast_name, name, initiative, dex_modifier, armor_class, max_hp, current_hp, conditions)")).
+					WithArgs(int64(7), nil, "Strahd", 20, 0, 0, 144, 144, []string{}).
+					WillReturnRows(mock.NewRows([]string{"id"}).AddRow(int64(4)))
+				mock.ExpectQuery(saveCombatQuery).WithArgs(2, pgxmock.AnyArg(), int64(7)).
+					WillReturnRows(mock.NewRows([]string{"updated_at"}).AddRow(campaignCreated))
+				mock.ExpectCommit()
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+			router.POST("/combats/:id/combatants", AddCombatants)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/combats/7/combatants", bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code, w.Body.String())
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestChangeHitPoints(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		hp   int
+		code int
+	}{
+		{"Damage", "/combats/7/combatants/2/damage", `{"amount":15}`, 25, http.StatusOK},
+		{"DamageBelowZero", "/combats/7/combatants/2/damage", `{"amount":100}`, 0, http.StatusOK},
+		{"Heal", "/combats/7/combatants/2/heal", `{"amount":10}`, 50, http.StatusOK},
+		{"HealAboveMax", "/combats/7/combatants/2/heal", `{"amount":100}`, 58, http.StatusOK},
+		{"Untracked", "/combats/7/combatants/1/damage", `{"amount":5}`, 0, http.StatusUnprocessableEntity},
+		{"UnknownCombatant", "/combats/7/combatants/9/damage", `{"amount":5}`, 0, http.StatusNotFound},
+		{"InvalidAmount", "/combats/7/combatants/2/damage", `{"amount":0}`, 0, http.StatusBadRequest},
+		{"AmountTooLarge", "/combats/7/combatants/2/heal", `{"amount":9223372036854775807}`, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			if tt.code != http.StatusBadRequest {
+				mock.ExpectBegin()
+				expectCombat(mock, 2)
+				if tt.code == http.StatusOK {
+					mock.ExpectExec(regexp.QuoteMeta("UPDATE combatants SET current_hp=$1 WHERE id=$2")).WithArgs(tt.hp, int64(2)).
+						WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+					mock.ExpectQuery(saveCombatQuery).WithArgs(2, pgxmock.AnyArg(), int64(7)).
+						WillReturnRows(mock.NewRows([]string{"updated_at"}).AddRow(campaignCreated))
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+			router.POST("/combats/:id/combatants/:combatant/damage", DamageCombatant)
+			router.POST("/combats/:id/combatants/:combatant/heal", HealCombatant)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		condition  string
+		conditions []string
+		code       int
+	}{
+		{"Add", "PUT", "prone", []string{"grappled", "prone"}, http.StatusOK},
+		{"AddTwice", "PUT", "grappled", []string{"grappled"}, http.StatusOK},
+		{"Remove", "DELETE", "grappled", []string{}, http.StatusOK},
+		{"Unknown", "PUT", "sleepy", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			if tt.code == http.StatusOK {
+				mock.ExpectBegin()
+				expectCombat(mock, 2)
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE combatants SET conditions=$1 WHERE id=$2")).WithArgs(tt.conditions, int64(2)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectQuery(saveCombatQuery).WithArgs(2, pgxmock.AnyArg(), int64(7)).
+					WillReturnRows(mock.NewRows([]string{"updated_at"}).AddRow(campaignCreated))
+				mock.ExpectCommit()
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+			router.PUT("/combats/:id/combatants/:combatant/conditions/:condition", AddCondition)
+			router.DELETE("/combats/:id/combatants/:combatant/conditions/:condition", RemoveCondition)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/combats/7/combatants/2/conditions/"+tt.condition, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRemoveCombatant_CurrentTurn(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	// Removing Ireena, last in the round, passes the turn to the first mimic in the next round
+	mock.ExpectBegin()
+	expectCombat(mock, 1)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM combatants WHERE id=$1")).WithArgs(int64(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectQuery(saveCombatQuery).WithArgs(3, pgxmock.AnyArg(), int64(7)).
+		WillReturnRows(mock.NewRows([]string{"updated_at"}).AddRow(campaignCreated))
+	mock.ExpectCommit()
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.DELETE("/combats/:id/combatants/:combatant", RemoveCombatant)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/combats/7/combatants/1", nil)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var combat Combat
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &combat))
+	assert.Len(t, combat.Combatants, 2)
+	require.NotNil(t, combat.Turn)
+	assert.Equal(t, int64(2), *combat.Turn)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
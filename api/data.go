@@ -1,9 +1,30 @@
 package api
 
+// Beast visibility levels. Private beasts are only visible to their owner,
+// campaign beasts to members of the beast's campaign.
+const (
+	VisibilityPrivate  = "private"
+	VisibilityCampaign = "campaign"
+	VisibilityPublic   = "public"
+)
+
 type Beast struct {
 	BeastName   string            `json:"BeastName"`
 	Type        string            `json:"Type"`
+	Subtype     string            `json:"Subtype,omitempty"`
+	Size        string            `json:"Size,omitempty"`
+	Alignment   string            `json:"Alignment,omitempty"`
 	CR          string            `json:"CR"`
 	Attributes  map[string]string `json:"Attributes"`
 	Description string            `json:"Description"`
+	Owner       string            `json:"Owner,omitempty"`
+	Visibility  string            `json:"Visibility,omitempty"`
+	Campaign    string            `json:"Campaign,omitempty"`
+	ArmorClass  int               `json:"ArmorClass,omitempty"`
+	HitDice     string            `json:"HitDice,omitempty"`
+	Tags        []string          `json:"Tags,omitempty"`
+	Source      string            `json:"Source,omitempty"`
+	SourcePage  int               `json:"SourcePage,omitempty"`
+	Derived     *Derived          `json:"Derived,omitempty"`
+	Images      []Image           `json:"Images,omitempty"`
 }
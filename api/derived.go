@@ -0,0 +1,39 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/keremenci/bestiary-crud/rules"
+)
+
+// Derived holds the statistics computed from a beast's stat block. Abilities that can't
+// be read are left out, as are the proficiency bonus and XP when the CR is unknown.
+type Derived struct {
+	AbilityModifiers  map[string]int `json:"AbilityModifiers"`
+	ProficiencyBonus  int            `json:"ProficiencyBonus,omitempty"`
+	PassivePerception int            `json:"PassivePerception"`
+	XP                int            `json:"XP,omitempty"`
+}
+
+// deriveStats computes the derived statistics of a beast. Passive Perception uses a
+// "Perception" skill bonus from Attributes, such as "+5", over the Wisdom modifier.
+func deriveStats(beast Beast) *Derived {
+	d := &Derived{AbilityModifiers: map[string]int{}}
+	for _, ability := range rules.Abilities {
+		if score, err := rules.ParseAbilityScore(beast.Attributes[ability]); err == nil {
+			d.AbilityModifiers[ability] = rules.AbilityModifier(score)
+		}
+	}
+	if pb, err := rules.ProficiencyBonus(beast.CR); err == nil {
+		d.ProficiencyBonus = pb
+	}
+	if xp, err := rules.XPForCR(beast.CR); err == nil {
+		d.XP = xp
+	}
+	d.PassivePerception = 10 + d.AbilityModifiers["WIS"]
+	if bonus, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(beast.Attributes["Perception"]), "+")); err == nil {
+		d.PassivePerception = 10 + bonus
+	}
+	return d
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeriveStats(t *testing.T) {
+	tests := []struct {
+		name  string
+		beast Beast
+		want  Derived
+	}{
+		{
+			name: "Owlbear",
+			beast: Beast{CR: "3", Attributes: map[string]string{
+				"STR": "20 (+5)", "DEX": "12 (+1)", "CON": "17 (+3)", "INT": "3 (-4)", "WIS": "12 (+1)", "CHA": "7 (-2)",
+				"Perception": "+3",
+			}},
+			want: Derived{
+				AbilityModifiers:  map[string]int{"STR": 5, "DEX": 1, "CON": 3, "INT": -4, "WIS": 1, "CHA": -2},
+				ProficiencyBonus:  2,
+				PassivePerception: 13,
+				XP:                700,
+			},
+		},
+		{
+			name:  "WisdomOnly",
+			beast: Beast{CR: "14", Attributes: map[string]string{"WIS": "19"}},
+			want:  Derived{AbilityModifiers: map[string]int{"WIS": 4}, ProficiencyBonus: 5, PassivePerception: 14, XP: 11500},
+		},
+		{
+			name:  "UnknownCR",
+			beast: Beast{CR: "high", Attributes: map[string]string{"STR": "strong"}},
+			want:  Derived{AbilityModifiers: map[string]int{}, PassivePerception: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, &tt.want, deriveStats(tt.beast))
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/dice"
+)
+
+// RollRequest is a dice expression to roll. With both advantage and disadvantage, d20s are rolled normally.
+type RollRequest struct {
+	Expression   string  `json:"expression"`
+	Advantage    bool    `json:"advantage"`
+	Disadvantage bool    `json:"disadvantage"`
+	Seed         *uint64 `json:"seed"`
+}
+
+// RollResult is a rolled expression along with the seed reproducing it
+type RollResult struct {
+	Seed uint64 `json:"seed"`
+	dice.Result
+}
+
+// DamageRoll is rolled damage of one type
+type DamageRoll struct {
+	Type string `json:"type"`
+	dice.Result
+}
+
+// AttackRoll is a rolled attack. A natural 20 is a critical hit, rolling the damage dice twice, and a natural 1 misses.
+// Damage is rolled either way, for the caller to apply on a hit.
+type AttackRoll struct {
+	Seed     uint64       `json:"seed"`
+	Attack   string       `json:"attack"`
+	ToHit    dice.Result  `json:"to_hit"`
+	Natural  int          `json:"natural"`
+	Critical bool         `json:"critical"`
+	Damage   []DamageRoll `json:"damage"`
+}
+
+// attackRequest picks an attack of a beast, which may be left out for beasts with a single attack
+type attackRequest struct {
+	Attack       string `json:"attack"`
+	Advantage    bool   `json:"advantage"`
+	Disadvantage bool   `json:"disadvantage"`
+}
+
+// rollMode returns how d20s are rolled. Advantage and disadvantage cancel out.
+func rollMode(advantage, disadvantage bool) dice.Mode {
+	switch {
+	case advantage && !disadvantage:
+		return dice.Advantage
+	case disadvantage && !advantage:
+		return dice.Disadvantage
+	}
+	return dice.Normal
+}
+
+// RollDice rolls a dice expression such as "2d6+4" or "4d6kh3"
+func RollDice(c *gin.Context) {
+	var req RollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	expr, err := dice.Parse(req.Expression)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rng, seed := newRand(req.Seed)
+	result, err := expr.WithMode(rollMode(req.Advantage, req.Disadvantage)).Roll(rng)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, RollResult{Seed: seed, Result: result})
+}
+
+// RollHitPoints rolls the hit points of a beast from its hit dice
+func RollHitPoints(c *gin.Context) {
+	seed, ok := seedParam(c)
+	if !ok {
+		return
+	}
+	beast, ok := loadBeast(c, c.Param("key"))
+	if !ok {
+		return
+	}
+	expr, err := dice.Parse(beast.HitDice)
+	if beast.HitDice == "" || err != nil {
+		respondError(c, http.StatusUnprocessableEntity, fmt.Sprintf("Beast %q has no valid hit dice", beast.BeastName))
+		return
+	}
+
+	rng, s := newRand(seed)
+	result, _ := expr.Roll(rng)
+	// A creature always has at least 1 hit point
+	result.Total = max(result.Total, 1)
+
+	c.JSON(http.StatusOK, RollResult{Seed: s, Result: result})
+}
+
+// RollAttack rolls an attack written in the description of a beast, such as
+// "Beak. Melee Weapon Attack: +7 to hit, reach 5 ft., one creature. Hit: 10 (1d10 + 5) piercing damage."
+func RollAttack(c *gin.Context) {
+	var req attackRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid input")
+			return
+		}
+	}
+	seed, ok := seedParam(c)
+	if !ok {
+		return
+	}
+	beast, ok := loadBeast(c, c.Param("key"))
+	if !ok {
+		return
+	}
+	attack, found := dice.FindAttack(beast.Description, req.Attack)
+	if !found {
+		if req.Attack == "" {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Beast %q does not have exactly one attack, name the attack to roll", beast.BeastName))
+		} else {
+			respondError(c, http.StatusNotFound, fmt.Sprintf("Beast %q has no attack %q", beast.BeastName, req.Attack))
+		}
+		return
+	}
+
+	rng, s := newRand(seed)
+	roll := AttackRoll{Seed: s, Attack: attack.Name, Damage: []DamageRoll{}}
+	d20 := dice.MustParse("1d20").WithMode(rollMode(req.Advantage, req.Disadvantage))
+	natural, _ := d20.Roll(rng)
+	roll.Natural = natural.Total
+	roll.ToHit = natural
+	roll.ToHit.Expression = fmt.Sprintf("%s%+d", d20, attack.ToHit)
+	roll.ToHit.Total += attack.ToHit
+	roll.Critical = roll.Natural == 20
+
+	for _, d := range attack.Damage {
+		expr := d.Dice
+		if roll.Critical {
+			critical, err := expr.Critical()
+			if err != nil {
+				respondError(c, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			expr = critical
+		}
+		result, err := expr.Roll(rng)
+		if err != nil {
+			respondError(c, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		roll.Damage = append(roll.Damage, DamageRoll{Type: d.Type, Result: result})
+	}
+
+	c.JSON(http.StatusOK, roll)
+}
+
+// maxRandomSeed bounds random seeds so they are exact as JSON numbers in JavaScript clients
+const maxRandomSeed = 1 << 53
+
+// newRand returns a generator seeded with seed, or a random seed, along with the seed used
+func newRand(seed *uint64) (*rand.Rand, uint64) {
+	s := rand.Uint64N(maxRandomSeed)
+	if seed != nil {
+		s = *seed
+	}
+	return rand.New(rand.NewPCG(s, s)), s
+}
+
+// seedParam returns the optional seed query parameter. It writes the error response and returns false if it is invalid.
+func seedParam(c *gin.Context) (*uint64, bool) {
+	s := c.Query("seed")
+	if s == "" {
+		return nil, true
+	}
+	seed, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid seed")
+		return nil, false
+	}
+	return &seed, true
+}
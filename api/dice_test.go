@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var beastQuery = regexp.QuoteMeta("FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND visibility = 'public'")
+
+const owlbearDescription = "Keen Sight and Smell. The owlbear has advantage on Wisdom (Perception) checks that rely on sight or smell.\n" +
+	"Beak. Melee Weapon Attack: +7 to hit, reach 5 ft., one creature. Hit: 10 (1d10 + 5) piercing damage.\n" +
+	"Claws. Melee Weapon Attack: +7 to hit, reach 5 ft., one target. Hit: 14 (2d8 + 5) slashing damage."
+
+func TestRollDice(t *testing.T) {
+	router := gin.Default()
+	router.POST("/roll", RollDice)
+
+	roll := func(body string) (int, RollResult) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/roll", bytes.NewBufferString(body))
+		router.ServeHTTP(w, req)
+		var result RollResult
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	code, first := roll(`{"expression":"4d6kh3","seed":42}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint64(42), first.Seed)
+	assert.Equal(t, "4d6kh3", first.Expression)
+	require.Len(t, first.Rolls, 1)
+	assert.Len(t, first.Rolls[0].Kept, 3)
+	_, second := roll(`{"expression":"4d6kh3","seed":42}`)
+	assert.Equal(t, first, second)
+
+	code, result := roll(`{"expression":"d20+5","advantage":true}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "2d20kh1+5", result.Expression)
+	_, result = roll(`{"expression":"d20+5","advantage":true,"disadvantage":true}`)
+	assert.Equal(t, "1d20+5", result.Expression)
+
+	code, _ = roll(`{"expression":"2d"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestRollHitPoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		hitDice string
+		code    int
+	}{
+		{"Rolled", "7d10+21", http.StatusOK},
+		{"NoHitDice", "", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			mock.ExpectQuery(beastQuery).WithArgs("Owlbear").
+				WillReturnRows(mock.NewRows(beastRowColumns).
+					AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "", "public", "", 13, tt.hitDice, "", "", "", []string{}, "", 0))
+
+			router := gin.Default()
+			router.POST("/beasts/:key/roll/hp", RollHitPoints)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/beasts/Owlbear/roll/hp?seed=3", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusOK {
+				var result RollResult
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+				assert.Equal(t, uint64(3), result.Seed)
+				assert.Equal(t, "7d10+21", result.Expression)
+				assert.GreaterOrEqual(t, result.Total, 28)
+				assert.LessOrEqual(t, result.Total, 91)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRollAttack(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"Named", `{"attack":"beak"}`, http.StatusOK},
+		{"Unknown", `{"attack":"Tail"}`, http.StatusNotFound},
+		{"Unnamed", ``, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			mock.ExpectQuery(beastQuery).WithArgs("Owlbear").
+				WillReturnRows(mock.NewRows(beastRowColumns).
+					AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, owlbearDescription, "", "public", "", 13, "7d10+21", "", "", "", []string{}, "", 0))
+
+			router := gin.Default()
+			router.POST("/beasts/:key/roll/attack", RollAttack)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/beasts/Owlbear/roll/attack", bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusOK {
+				var roll AttackRoll
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &roll))
+				assert.Equal(t, "Beak", roll.Attack)
+				assert.Equal(t, "1d20+7", roll.ToHit.Expression)
+				assert.Equal(t, roll.Natural+7, roll.ToHit.Total)
+				assert.Equal(t, roll.Natural == 20, roll.Critical)
+				require.Len(t, roll.Damage, 1)
+				assert.Equal(t, "piercing", roll.Damage[0].Type)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/rules"
+)
+
+// maxEncounterMonsters caps the number of monsters in an encounter, to keep requests reasonable
+const maxEncounterMonsters = 100
+
+// EncounterBeast is a beast taking part in an encounter, count times
+type EncounterBeast struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+	CR    string `json:"cr,omitempty"`
+	XP    int    `json:"xp,omitempty"`
+}
+
+// EncounterRequest is a party facing a group of beasts
+type EncounterRequest struct {
+	Party  []int            `json:"party"`
+	Beasts []EncounterBeast `json:"beasts"`
+}
+
+// Encounter is a rated encounter. AdjustedXP is the XP of the beasts times the multiplier for their number,
+// compared to the party's thresholds to rate it.
+type Encounter struct {
+	PartySize    int              `json:"party_size"`
+	Thresholds   rules.Thresholds `json:"thresholds"`
+	Beasts       []EncounterBeast `json:"beasts"`
+	MonsterCount int              `json:"monster_count"`
+	BaseXP       int              `json:"base_xp"`
+	Multiplier   float64          `json:"multiplier"`
+	AdjustedXP   int              `json:"adjusted_xp"`
+	Difficulty   rules.Difficulty `json:"difficulty"`
+}
+
+// EvaluateEncounter rates an encounter between a party and beasts visible to the caller
+func EvaluateEncounter(c *gin.Context) {
+	var req EncounterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	thresholds, err := rules.PartyThresholds(req.Party)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Beasts) == 0 {
+		respondError(c, http.StatusBadRequest, "The encounter has no beasts")
+		return
+	}
+
+	keys := make([]string, 0, len(req.Beasts))
+	monsters := 0
+	for _, b := range req.Beasts {
+		if b.Count < 1 {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid count for %q, expected at least 1", b.Key))
+			return
+		}
+		monsters += b.Count
+		keys = append(keys, b.Key)
+	}
+	if monsters > maxEncounterMonsters {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Too many monsters, expected at most %d", maxEncounterMonsters))
+		return
+	}
+
+	crs, ok := loadChallengeRatings(c, keys)
+	if !ok {
+		return
+	}
+
+	beasts := make([]EncounterBeast, 0, len(req.Beasts))
+	for _, b := range req.Beasts {
+		cr, found := crs[b.Key]
+		if !found {
+			respondError(c, http.StatusNotFound, fmt.Sprintf("Beast %q not found", b.Key))
+			return
+		}
+		xp, err := rules.XPForCR(cr)
+		if err != nil {
+			respondError(c, http.StatusUnprocessableEntity, fmt.Sprintf("Beast %q has an %s", b.Key, err))
+			return
+		}
+		b.CR, b.XP = cr, xp
+		beasts = append(beasts, b)
+	}
+
+	c.JSON(http.StatusOK, rateEncounter(thresholds, len(req.Party), beasts))
+}
+
+// GenerateRequest asks for a random encounter of a difficulty. The same seed and beasts give the same encounter.
+type GenerateRequest struct {
+	Party      []int   `json:"party"`
+	Difficulty string  `json:"difficulty"`
+	Seed       *uint64 `json:"seed"`
+	BeastFilter
+}
+
+// GeneratedEncounter is a random encounter along with the seed reproducing it
+type GeneratedEncounter struct {
+	Seed uint64 `json:"seed"`
+	Encounter
+}
+
+// GenerateEncounter builds a random encounter of the requested difficulty from the beasts visible to the caller,
+// optionally of a single type. Without a seed a random one is used and returned.
+func GenerateEncounter(c *gin.Context) {
+	var req GenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	thresholds, err := rules.PartyThresholds(req.Party)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Difficulty == "" {
+		req.Difficulty = string(rules.Medium)
+	}
+	difficulty, err := rules.ParseDifficulty(req.Difficulty)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	conditions, args, err := req.BeastFilter.conditions(0)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rng, seed := newRand(req.Seed)
+	candidates, crs, ok := loadCandidates(c, conditions, args)
+	if !ok {
+		return
+	}
+	picks, err := rules.Generate(candidates, thresholds, len(req.Party), difficulty, rng)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, "No "+string(difficulty)+" encounter can be built from the matching beasts")
+		return
+	}
+
+	beasts := make([]EncounterBeast, 0, len(picks))
+	for _, pick := range picks {
+		xp, _ := rules.XPForCR(crs[pick.Key])
+		beasts = append(beasts, EncounterBeast{Key: pick.Key, Count: pick.Count, CR: crs[pick.Key], XP: xp})
+	}
+
+	c.JSON(http.StatusOK, GeneratedEncounter{Seed: seed, Encounter: rateEncounter(thresholds, len(req.Party), beasts)})
+}
+
+// rateEncounter computes the XP and difficulty of an encounter between a party and beasts with their XP set
+func rateEncounter(thresholds rules.Thresholds, partySize int, beasts []EncounterBeast) Encounter {
+	e := Encounter{PartySize: partySize, Thresholds: thresholds, Beasts: beasts}
+	for _, b := range beasts {
+		e.MonsterCount += b.Count
+		e.BaseXP += b.XP * b.Count
+	}
+	e.Multiplier = rules.Multiplier(e.MonsterCount, partySize)
+	e.AdjustedXP = rules.AdjustedXP(e.BaseXP, e.MonsterCount, partySize)
+	e.Difficulty = thresholds.Rate(e.AdjustedXP)
+	return e
+}
+
+// loadChallengeRatings returns the challenge ratings of the beasts visible to the caller among keys.
+// It writes the error response and returns false if the query fails.
+func loadChallengeRatings(c *gin.Context, keys []string) (map[string]string, bool) {
+	filter, args := visibilityFilter(CurrentPrincipal(c), 1)
+	rows, err := dbPool.Query(c.Request.Context(),
+		"SELECT beast_name, cr FROM beasts WHERE beast_name = ANY($1) AND deleted_at IS NULL AND "+filter,
+		append([]interface{}{keys}, args...)...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	defer rows.Close()
+
+	crs := make(map[string]string, len(keys))
+	for rows.Next() {
+		var name, cr string
+		if err := rows.Scan(&name, &cr); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return nil, false
+		}
+		crs[name] = cr
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	return crs, true
+}
+
+// loadCandidates returns the beasts visible to the caller and matching the conditions that can be picked for a random encounter, in a
+// stable order so seeds are reproducible, along with their CRs. Beasts whose CR has no XP value are left out.
+// It writes the error response and returns false if the query fails.
+func loadCandidates(c *gin.Context, conditions []string, args []interface{}) ([]rules.Candidate, map[string]string, bool) {
+	filter, filterArgs := visibilityFilter(CurrentPrincipal(c), len(args))
+	query := "SELECT beast_name, cr FROM beasts WHERE deleted_at IS NULL AND " +
+		strings.Join(append(conditions, filter), " AND ") + " ORDER BY beast_name"
+
+	rows, err := dbPool.Query(c.Request.Context(), query, append(args, filterArgs...)...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, nil, false
+	}
+	defer rows.Close()
+
+	var candidates []rules.Candidate
+	crs := map[string]string{}
+	for rows.Next() {
+		var name, cr string
+		if err := rows.Scan(&name, &cr); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return nil, nil, false
+		}
+		xp, err := rules.XPForCR(cr)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, rules.Candidate{Key: name, XP: xp})
+		crs[name] = cr
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, nil, false
+	}
+	return candidates, crs, true
+}
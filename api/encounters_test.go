@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/rules"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var crQuery = regexp.QuoteMeta("SELECT beast_name, cr FROM beasts WHERE beast_name = ANY($1) AND deleted_at IS NULL")
+
+func TestEvaluateEncounter(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(crQuery).WithArgs([]string{"Owlbear", "Mimic"}).
+		WillReturnRows(mock.NewRows([]string{"beast_name", "cr"}).AddRow("Owlbear", "3").AddRow("Mimic", "2"))
+
+	router := gin.Default()
+	router.POST("/encounters/evaluate", EvaluateEncounter)
+
+	// 700 + 2*450 = 1600 XP, times 2 for three monsters
+	body := `{"party":[3,3,3,2],"beasts":[{"key":"Owlbear","count":1},{"key":"Mimic","count":2}]}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/encounters/evaluate", bytes.NewBufferString(body))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"party_size":4,"thresholds":{"easy":275,"medium":550,"hard":825,"deadly":1400},
+		"beasts":[{"key":"Owlbear","count":1,"cr":"3","xp":700},{"key":"Mimic","count":2,"cr":"2","xp":450}],
+		"monster_count":3,"base_xp":1600,"multiplier":2,"adjusted_xp":3200,"difficulty":"deadly"}`, w.Body.String())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEvaluateEncounter_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		found map[string]string
+		code  int
+	}{
+		{"NoParty", `{"party":[],"beasts":[{"key":"Owlbear","count":1}]}`, nil, http.StatusBadRequest},
+		{"InvalidLevel", `{"party":[25],"beasts":[{"key":"Owlbear","count":1}]}`, nil, http.StatusBadRequest},
+		{"NoBeasts", `{"party":[3]}`, nil, http.StatusBadRequest},
+		{"InvalidCount", `{"party":[3],"beasts":[{"key":"Owlbear","count":0}]}`, nil, http.StatusBadRequest},
+		{"UnknownBeast", `{"party":[3],"beasts":[{"key":"Tarrasque","count":1}]}`, map[string]string{}, http.StatusNotFound},
+		{"UnratedBeast", `{"party":[3],"beasts":[{"key":"Owlbear","count":1}]}`, map[string]string{"Owlbear": "?"}, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			if tt.found != nil {
+				rows := mock.NewRows([]string{"beast_name", "cr"})
+				for name, cr := range tt.found {
+					rows.AddRow(name, cr)
+				}
+				mock.ExpectQuery(crQuery).WithArgs(pgxmock.AnyArg()).WillReturnRows(rows)
+			}
+
+			router := gin.Default()
+			router.POST("/encounters/evaluate", EvaluateEncounter)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/encounters/evaluate", bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestGenerateEncounter(t *testing.T) {
+	candidates := func(mock pgxmock.PgxPoolIface) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT beast_name, cr FROM beasts WHERE deleted_at IS NULL AND lower(type) = lower($1) AND EXISTS (")+
+			".*"+regexp.QuoteMeta("tags.category = 'environment' AND tags.name = $2) AND visibility = 'public' ORDER BY beast_name")).
+			WithArgs("Monstrosity", "forest").
+			WillReturnRows(mock.NewRows([]string{"beast_name", "cr"}).
+				AddRow("Mimic", "2").AddRow("Owlbear", "3").AddRow("Unrated", "?"))
+	}
+	generate := func(body string) *httptest.ResponseRecorder {
+		router := gin.Default()
+		router.POST("/encounters/generate", GenerateEncounter)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/encounters/generate", bytes.NewBufferString(body))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	// The same seed gives the same encounter
+	body := `{"party":[3,3,3,3],"difficulty":"hard","type":"Monstrosity","environment":"Forest","seed":7}`
+	candidates(mock)
+	first := generate(body)
+	candidates(mock)
+	second := generate(body)
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.JSONEq(t, first.Body.String(), second.Body.String())
+
+	var got GeneratedEncounter
+	if err := json.Unmarshal(first.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	assert.Equal(t, uint64(7), got.Seed)
+	assert.Equal(t, rules.Hard, got.Difficulty)
+	for _, b := range got.Beasts {
+		assert.NotEqual(t, "Unrated", b.Key)
+	}
+
+	// Random seeds are exact in JavaScript and reproduce the encounter
+	candidates(mock)
+	random := generate(`{"party":[3,3,3,3],"difficulty":"hard","type":"Monstrosity","environment":"Forest"}`)
+	if err := json.Unmarshal(random.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	assert.Less(t, got.Seed, uint64(maxRandomSeed))
+	candidates(mock)
+	again := generate(fmt.Sprintf(`{"party":[3,3,3,3],"difficulty":"hard","type":"Monstrosity","environment":"Forest","seed":%d}`, got.Seed))
+	assert.JSONEq(t, random.Body.String(), again.Body.String())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGenerateEncounter_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"InvalidDifficulty", `{"party":[3],"difficulty":"brutal"}`, http.StatusBadRequest},
+		{"NoParty", `{"difficulty":"easy"}`, http.StatusBadRequest},
+		{"InvalidTag", `{"party":[3],"tags":["#1"]}`, http.StatusBadRequest},
+		{"InvalidSize", `{"party":[3],"size":"Colossal"}`, http.StatusBadRequest},
+		{"NoMatchingBeasts", `{"party":[3],"type":"Dragon"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			if tt.code == http.StatusUnprocessableEntity {
+				mock.ExpectQuery(regexp.QuoteMeta("lower(type) = lower($1)")).WithArgs("Dragon").
+					WillReturnRows(mock.NewRows([]string{"beast_name", "cr"}))
+			}
+
+			router := gin.Default()
+			router.POST("/encounters/generate", GenerateEncounter)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/encounters/generate", bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
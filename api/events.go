@@ -0,0 +1,308 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// eventsChannel is the Postgres notification channel the beast_events trigger notifies
+const eventsChannel = "beast_events"
+
+// eventsLockKey is the advisory lock serializing event inserts until commit, so events become visible in
+// ID order and listeners reading past the last ID they saw never skip one
+const eventsLockKey = 0x62656173
+
+// Tuning of the event stream
+const (
+	// subscriberBuffer is the number of events a slow client may fall behind before it is disconnected
+	subscriberBuffer = 64
+	// reconnectDelay is the pause before the listener reconnects after losing its connection
+	reconnectDelay = 3 * time.Second
+)
+
+// heartbeatInterval is how often idle streams get a comment line, so proxies do not close them
+var heartbeatInterval = 15 * time.Second
+
+// eventReplayPage is the number of events loaded at a time when replaying to a client resuming with Last-Event-ID
+var eventReplayPage = 1000
+
+// BeastEvent is a change to a beast, as stored in beast_events and sent to subscribers.
+// Beast is the beast after the change, or before it for deletions.
+type BeastEvent struct {
+	ID        int64     `json:"id"`
+	Action    string    `json:"action"`
+	BeastName string    `json:"beast_name"`
+	Beast     *Beast    `json:"beast"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// before is the beast before an update, telling who could see it until then
+	before *Beast
+}
+
+// recordEvent stores the change in beast_events within the transaction making it. The insert trigger
+// notifies listeners once the transaction commits.
+func recordEvent(c *gin.Context, tx pgx.Tx, action, key string, before, after *Beast) error {
+	snapshot := after
+	if snapshot == nil {
+		snapshot, before = before, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	beforeData, err := marshalSnapshot(before)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(c.Request.Context(), `
+		INSERT INTO beast_events (beast_name, action, data, before)
+		SELECT $1, $2, $3, $4 FROM pg_advisory_xact_lock($5)`,
+		key, action, data, beforeData, eventsLockKey)
+	return err
+}
+
+// EventBroker fans the events written by any replica out to the event streams of this one
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan BeastEvent]struct{}
+	lastID      int64
+	started     bool
+}
+
+// NewEventBroker returns a broker without subscribers. Run must be started for it to receive events.
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: make(map[chan BeastEvent]struct{})}
+}
+
+// Subscribe returns a channel receiving every new event and a function to unsubscribe.
+// The channel is closed if the subscriber falls too far behind.
+func (b *EventBroker) Subscribe() (<-chan BeastEvent, func()) {
+	ch := make(chan BeastEvent, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *EventBroker) publish(event BeastEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Dropping events would leave the client silently out of date. Disconnecting it makes it
+			// resume from its last event instead.
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Run listens for event notifications until ctx is done, reconnecting when the connection is lost
+func (b *EventBroker) Run(ctx context.Context) {
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("Lost event notifications, reconnecting", "err", err, "retry_in", reconnectDelay)
+		select {
+		case <-time.After(reconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *EventBroker) listen(ctx context.Context) error {
+	conn, err := dbPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+eventsChannel); err != nil {
+		return err
+	}
+	// Catch up on events written while not listening
+	if err := b.poll(ctx); err != nil {
+		return err
+	}
+	for {
+		if _, err := conn.Conn().WaitForNotification(ctx); err != nil {
+			return err
+		}
+		if err := b.poll(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// poll publishes the events written since the last one published. The first poll only records where
+// the stream starts; earlier events are left to Last-Event-ID replay.
+func (b *EventBroker) poll(ctx context.Context) error {
+	if !b.started {
+		if err := dbPool.QueryRow(ctx, "SELECT COALESCE(MAX(id), 0) FROM beast_events").Scan(&b.lastID); err != nil {
+			return err
+		}
+		b.started = true
+		return nil
+	}
+
+	events, err := loadEventsSince(ctx, b.lastID, 0)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		b.publish(event)
+		b.lastID = event.ID
+	}
+	return nil
+}
+
+// loadEventsSince returns the events after the given ID in order, at most limit of them unless limit is 0
+func loadEventsSince(ctx context.Context, after int64, limit int) ([]BeastEvent, error) {
+	query := "SELECT id, action, beast_name, data, before, created_at FROM beast_events WHERE id > $1 ORDER BY id"
+	args := []interface{}{after}
+	if limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, limit)
+	}
+
+	rows, err := dbPool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []BeastEvent
+	for rows.Next() {
+		var event BeastEvent
+		var data, before []byte
+		if err := rows.Scan(&event.ID, &event.Action, &event.BeastName, &data, &before, &event.Timestamp); err != nil {
+			return nil, err
+		}
+		event.Beast = &Beast{}
+		if err := json.Unmarshal(data, event.Beast); err != nil {
+			return nil, fmt.Errorf("decoding event %d: %w", event.ID, err)
+		}
+		if before != nil {
+			event.before = &Beast{}
+			if err := json.Unmarshal(before, event.before); err != nil {
+				return nil, fmt.Errorf("decoding event %d: %w", event.ID, err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// StreamEvents streams changes to the beasts visible to the caller as Server-Sent Events named after
+// the action. An update hiding a beast from the caller is sent as a deletion of the version they could
+// see. Clients resuming with a Last-Event-ID header first get all the events they missed.
+func StreamEvents(broker *EventBroker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var lastID int64
+		resume := c.GetHeader("Last-Event-ID")
+		if resume != "" {
+			id, err := strconv.ParseInt(resume, 10, 64)
+			if err != nil || id < 0 {
+				respondError(c, http.StatusBadRequest, "Invalid Last-Event-ID")
+				return
+			}
+			lastID = id
+		}
+
+		// Subscribe before replaying so no event falls between the two
+		live, unsubscribe := broker.Subscribe()
+		defer unsubscribe()
+
+		var backlog []BeastEvent
+		if resume != "" {
+			var err error
+			backlog, err = loadEventsSince(c.Request.Context(), lastID, eventReplayPage)
+			if err != nil {
+				requestLogger(c).Error("Error querying database", "err", err)
+				respondError(c, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		// Keep the nginx in front of the API from buffering the stream
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+
+		principal := CurrentPrincipal(c)
+		send := func(event BeastEvent) {
+			// Live events may repeat the end of the replayed backlog
+			if event.ID <= lastID {
+				return
+			}
+			lastID = event.ID
+			if !canSee(principal, event.Beast) {
+				if event.before == nil || !canSee(principal, event.before) {
+					return
+				}
+				event = BeastEvent{ID: event.ID, Action: AuditDelete, BeastName: event.BeastName, Beast: event.before, Timestamp: event.Timestamp}
+			}
+			c.Render(-1, sse.Event{Id: strconv.FormatInt(event.ID, 10), Event: event.Action, Data: event})
+		}
+
+		// Replay a page at a time until a short page shows the backlog is caught up
+		for len(backlog) > 0 {
+			for _, event := range backlog {
+				send(event)
+			}
+			c.Writer.Flush()
+			if len(backlog) < eventReplayPage {
+				break
+			}
+			var err error
+			backlog, err = loadEventsSince(c.Request.Context(), lastID, eventReplayPage)
+			if err != nil {
+				// The client resumes from the last event it got
+				requestLogger(c).Error("Error querying database", "err", err)
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event, ok := <-live:
+				if !ok {
+					return
+				}
+				send(event)
+			case <-heartbeat.C:
+				fmt.Fprint(c.Writer, ": ping\n\n")
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var eventRowColumns = []string{"id", "action", "beast_name", "data", "before", "created_at"}
+
+func subscriberCount(b *EventBroker) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+func TestEventBroker_SlowSubscriber(t *testing.T) {
+	broker := NewEventBroker()
+	fast, unsubscribeFast := broker.Subscribe()
+	defer unsubscribeFast()
+	slow, unsubscribeSlow := broker.Subscribe()
+	defer unsubscribeSlow()
+
+	for i := 1; i <= subscriberBuffer; i++ {
+		broker.publish(BeastEvent{ID: int64(i)})
+		<-fast
+	}
+	// The slow subscriber's buffer is full, so the next event disconnects it
+	broker.publish(BeastEvent{ID: subscriberBuffer + 1})
+	assert.Equal(t, int64(subscriberBuffer+1), (<-fast).ID)
+	assert.Equal(t, 1, subscriberCount(broker))
+
+	received := 0
+	for range slow {
+		received++
+	}
+	assert.Equal(t, subscriberBuffer, received)
+}
+
+func TestEventBroker_Poll(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(id), 0) FROM beast_events")).
+		WillReturnRows(mock.NewRows([]string{"max"}).AddRow(int64(41)))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beast_events WHERE id > $1 ORDER BY id")).
+		WithArgs(int64(41)).
+		WillReturnRows(mock.NewRows(eventRowColumns).
+			AddRow(int64(42), AuditUpdate, "Owlbear", []byte(`{"BeastName":"Owlbear","CR":"4"}`), []byte(`{"BeastName":"Owlbear","CR":"3"}`), created).
+			AddRow(int64(43), AuditDelete, "Mimic", []byte(`{"BeastName":"Mimic"}`), nil, created))
+
+	broker := NewEventBroker()
+	events, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	// The first poll only finds where the stream starts
+	require.NoError(t, broker.poll(context.Background()))
+	require.NoError(t, broker.poll(context.Background()))
+
+	first, second := <-events, <-events
+	assert.Equal(t, int64(42), first.ID)
+	assert.Equal(t, "4", first.Beast.CR)
+	assert.Equal(t, "3", first.before.CR)
+	assert.Equal(t, AuditDelete, second.Action)
+	assert.Equal(t, int64(43), broker.lastID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	// Events 6 and 7 were missed by the client; 7 is a private beast of someone else
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beast_events WHERE id > $1 ORDER BY id LIMIT $2")).
+		WithArgs(int64(5), eventReplayPage).
+		WillReturnRows(mock.NewRows(eventRowColumns).
+			AddRow(int64(6), AuditCreate, "Owlbear", []byte(`{"BeastName":"Owlbear","Visibility":"public"}`), nil, created).
+			AddRow(int64(7), AuditCreate, "Gloomwing", []byte(`{"BeastName":"Gloomwing","Owner":"dm-2","Visibility":"private"}`), nil, created))
+
+	broker := NewEventBroker()
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleViewer}}))
+	router.GET("/beasts/events", StreamEvents(broker))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/beasts/events", nil)
+	req.Header.Set("Last-Event-ID", "5")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// A live event that was already replayed is not sent twice
+	require.Eventually(t, func() bool { return subscriberCount(broker) == 1 }, time.Second, time.Millisecond)
+	broker.publish(BeastEvent{ID: 6, Action: AuditCreate, BeastName: "Owlbear", Beast: &Beast{BeastName: "Owlbear"}})
+	broker.publish(BeastEvent{ID: 8, Action: AuditUpdate, BeastName: "Owlbear", Beast: &Beast{BeastName: "Owlbear", CR: "4"}, Timestamp: created})
+
+	var ids []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		assert.NotContains(t, line, "Gloomwing")
+		if id, ok := strings.CutPrefix(line, "id:"); ok {
+			ids = append(ids, id)
+		}
+		if line == "event:update" {
+			require.True(t, scanner.Scan())
+			assert.Contains(t, scanner.Text(), `"CR":"4"`)
+			break
+		}
+	}
+	assert.Equal(t, []string{"6", "8"}, ids)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStreamEvents_ReplayPages(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	page := eventReplayPage
+	eventReplayPage = 2
+	defer func() { eventReplayPage = page }()
+
+	// A full page is followed by the next one, until a short page
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	public := []byte(`{"BeastName":"Owlbear","Visibility":"public"}`)
+	replay := regexp.QuoteMeta("FROM beast_events WHERE id > $1 ORDER BY id LIMIT $2")
+	mock.ExpectQuery(replay).WithArgs(int64(0), 2).
+		WillReturnRows(mock.NewRows(eventRowColumns).
+			AddRow(int64(1), AuditCreate, "Owlbear", public, nil, created).
+			AddRow(int64(2), AuditUpdate, "Owlbear", public, public, created))
+	mock.ExpectQuery(replay).WithArgs(int64(2), 2).
+		WillReturnRows(mock.NewRows(eventRowColumns).
+			AddRow(int64(3), AuditUpdate, "Owlbear", public, public, created).
+			AddRow(int64(4), AuditUpdate, "Owlbear", public, public, created))
+	mock.ExpectQuery(replay).WithArgs(int64(4), 2).
+		WillReturnRows(mock.NewRows(eventRowColumns).
+			AddRow(int64(5), AuditUpdate, "Owlbear", public, public, created))
+
+	router := gin.Default()
+	router.GET("/beasts/events", StreamEvents(NewEventBroker()))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/beasts/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(ids) < 5 && scanner.Scan() {
+		if id, ok := strings.CutPrefix(scanner.Text(), "id:"); ok {
+			ids = append(ids, id)
+		}
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, ids)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStreamEvents_BeastHidden(t *testing.T) {
+	broker := NewEventBroker()
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "player-1", Roles: []string{RoleViewer}}))
+	router.GET("/beasts/events", StreamEvents(broker))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/beasts/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Making a public beast private hides it from the player, who gets a deletion of the public version
+	require.Eventually(t, func() bool { return subscriberCount(broker) == 1 }, time.Second, time.Millisecond)
+	broker.publish(BeastEvent{ID: 1, Action: AuditUpdate, BeastName: "Gloomwing",
+		Beast:  &Beast{BeastName: "Gloomwing", Owner: "dm-1", Visibility: VisibilityPrivate, Description: "secret"},
+		before: &Beast{BeastName: "Gloomwing", Owner: "dm-1", Visibility: VisibilityPublic}})
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		assert.NotContains(t, line, "secret")
+		if strings.HasPrefix(line, "event:") {
+			assert.Equal(t, "event:delete", line)
+			require.True(t, scanner.Scan())
+			assert.Contains(t, scanner.Text(), `"Visibility":"public"`)
+			break
+		}
+	}
+}
+
+func TestStreamEvents_InvalidLastEventID(t *testing.T) {
+	router := gin.Default()
+	router.GET("/beasts/events", StreamEvents(NewEventBroker()))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/events", nil)
+	req.Header.Set("Last-Event-ID", "yesterday")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
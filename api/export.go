@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export is a set of beasts along with the sources they come from, to publish them elsewhere
+type Export struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Sources    []Source  `json:"sources"`
+	Beasts     []Beast   `json:"beasts"`
+}
+
+// ExportBeasts returns the beasts visible to the caller that match the query parameters of BeastFilter,
+// with the sources they refer to and their attributions. ?license=open leaves out every beast that may not
+// be published. Owners, visibility and campaigns are not exported.
+func ExportBeasts(c *gin.Context) {
+	beasts, ok := findBeasts(c, filterFromQuery(c.Request.URL.Query()))
+	if !ok {
+		return
+	}
+
+	sources, ok := exportSources(c, beasts)
+	if !ok {
+		return
+	}
+
+	export := Export{ExportedAt: time.Now().UTC(), Sources: sources, Beasts: []Beast{}}
+	for _, beast := range beasts {
+		beast.Owner, beast.Visibility, beast.Campaign = "", "", ""
+		export.Beasts = append(export.Beasts, beast)
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+// exportSources returns the sources the beasts refer to.
+// It writes the error response and returns false if the query fails.
+func exportSources(c *gin.Context, beasts []Beast) ([]Source, bool) {
+	var used []string
+	for _, beast := range beasts {
+		if beast.Source != "" && !slices.Contains(used, beast.Source) {
+			used = append(used, beast.Source)
+		}
+	}
+	if len(used) == 0 {
+		return []Source{}, true
+	}
+	return findSources(c, " WHERE abbreviation = ANY($1)", used)
+}
+
+// sourceOf returns the source with the abbreviation, or nil
+func sourceOf(sources []Source, abbreviation string) *Source {
+	for i := range sources {
+		if sources[i].Abbreviation == abbreviation {
+			return &sources[i]
+		}
+	}
+	return nil
+}
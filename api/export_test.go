@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportBeasts(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE deleted_at IS NULL AND source IN (SELECT abbreviation FROM sources WHERE license = ANY($1)) " +
+		"AND visibility = 'public' ORDER BY beast_name")).
+		WithArgs(OpenLicenses).
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Mimic", "Monstrosity", "2", map[string]string{}, "", "", "public", "", 12, "9d8+18", "Shapechanger", "Medium", "neutral", []string{}, "SRD", 0).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "dm-1", "public", "", 13, "7d10+21", "", "Large", "unaligned", []string{"forest"}, "SRD", 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT abbreviation, title, license, attribution FROM sources WHERE abbreviation = ANY($1) ORDER BY abbreviation")).
+		WithArgs([]string{"SRD"}).
+		WillReturnRows(mock.NewRows(sourceRowColumns).
+			AddRow("SRD", "System Reference Document 5.1", "CC-BY-4.0", "Includes SRD 5.1 material."))
+
+	router := gin.Default()
+	router.GET("/export", ExportBeasts)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/export?license=open", nil)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var export Export
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	require.Len(t, export.Beasts, 2)
+	assert.Equal(t, "Owlbear", export.Beasts[1].BeastName)
+	assert.Empty(t, export.Beasts[1].Owner)
+	assert.Empty(t, export.Beasts[1].Visibility)
+	assert.Nil(t, export.Beasts[1].Derived)
+	require.Len(t, export.Sources, 1)
+	assert.True(t, export.Sources[0].Open)
+	assert.Equal(t, "Includes SRD 5.1 material.", export.Sources[0].Attribution)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExportBeasts_Empty(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE deleted_at IS NULL AND source = $1 AND visibility = 'public'")).
+		WithArgs("HB").
+		WillReturnRows(mock.NewRows(beastRowColumns))
+
+	router := gin.Default()
+	router.GET("/export", ExportBeasts)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/export?source=HB", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sources":[],"beasts":[]`)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
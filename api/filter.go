@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// BeastFilter selects beasts by their taxonomy, tags and source. Empty fields match every beast.
+type BeastFilter struct {
+	Type        string   `json:"type"`
+	Subtype     string   `json:"subtype"`
+	Size        string   `json:"size"`
+	Environment string   `json:"environment"`
+	Tags        []string `json:"tags"`
+	Source      string   `json:"source"`
+	// License is the license of the beasts' source, or "open" for any of OpenLicenses
+	License string `json:"license"`
+}
+
+// filterFromQuery reads a filter from the ?type=, ?subtype=, ?size=, ?environment=, repeated ?tag=,
+// ?source= and ?license= parameters
+func filterFromQuery(q url.Values) BeastFilter {
+	return BeastFilter{
+		Type:        q.Get("type"),
+		Subtype:     q.Get("subtype"),
+		Size:        q.Get("size"),
+		Environment: q.Get("environment"),
+		Tags:        q["tag"],
+		Source:      q.Get("source"),
+		License:     q.Get("license"),
+	}
+}
+
+// conditions returns the SQL conditions on beasts of the filter, numbering their arguments after n others.
+// A beast matches when it has every tag of the filter, and the environment is a tag of that category.
+func (f BeastFilter) conditions(n int) ([]string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, n+len(args)))
+	}
+
+	if f.Type != "" {
+		add("lower(type) = lower($%d)", strings.TrimSpace(f.Type))
+	}
+	if f.Subtype != "" {
+		add("lower(subtype) = lower($%d)", strings.TrimSpace(f.Subtype))
+	}
+	if f.Size != "" {
+		size, err := normalizeSize(f.Size)
+		if err != nil {
+			return nil, nil, err
+		}
+		add("size = $%d", size)
+	}
+	if f.Environment != "" {
+		environment, err := normalizeTag(f.Environment)
+		if err != nil {
+			return nil, nil, err
+		}
+		add("EXISTS (SELECT 1 FROM beast_tags JOIN tags ON tags.name = beast_tags.tag WHERE beast_tags.beast_name = beasts.beast_name "+
+			"AND tags.category = '"+EnvironmentCategory+"' AND tags.name = $%d)", environment)
+	}
+	if len(f.Tags) > 0 {
+		tags := make([]string, 0, len(f.Tags))
+		for _, t := range f.Tags {
+			tag, err := normalizeTag(t)
+			if err != nil {
+				return nil, nil, err
+			}
+			tags = append(tags, tag)
+		}
+		add("$%d::text[] <@ "+beastTags, tags)
+	}
+	if f.Source != "" {
+		add("source = $%d", strings.TrimSpace(f.Source))
+	}
+	if license := strings.TrimSpace(f.License); strings.EqualFold(license, "open") {
+		add("source IN (SELECT abbreviation FROM sources WHERE license = ANY($%d))", OpenLicenses)
+	} else if license != "" {
+		add("source IN (SELECT abbreviation FROM sources WHERE lower(license) = lower($%d))", license)
+	}
+	return conditions, args, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBeastFilterConditions(t *testing.T) {
+	q, _ := url.ParseQuery("type=Aberration&size=large&tag=Underdark&tag=homebrew")
+	conditions, args, err := filterFromQuery(q).conditions(1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lower(type) = lower($2)", "size = $3", "$4::text[] <@ " + beastTags}, conditions)
+	assert.Equal(t, []interface{}{"Aberration", "Large", []string{"underdark", "homebrew"}}, args)
+
+	conditions, _, err = BeastFilter{Environment: "Forest"}.conditions(0)
+	require.NoError(t, err)
+	assert.Contains(t, conditions[0], "tags.category = 'environment' AND tags.name = $1")
+
+	conditions, args, err = BeastFilter{Source: "SRD", License: "Proprietary"}.conditions(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"source = $1", "source IN (SELECT abbreviation FROM sources WHERE lower(license) = lower($2))"}, conditions)
+	assert.Equal(t, []interface{}{"SRD", "Proprietary"}, args)
+
+	conditions, args, err = BeastFilter{License: "OPEN"}.conditions(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"source IN (SELECT abbreviation FROM sources WHERE license = ANY($1))"}, conditions)
+	assert.Equal(t, []interface{}{OpenLicenses}, args)
+
+	conditions, args, err = BeastFilter{}.conditions(0)
+	require.NoError(t, err)
+	assert.Empty(t, conditions)
+	assert.Empty(t, args)
+
+	for _, f := range []BeastFilter{{Size: "Colossal"}, {Tags: []string{""}}, {Environment: "#forest"}} {
+		_, _, err := f.conditions(0)
+		assert.Error(t, err, f)
+	}
+}
+
+func TestListItems_Filtered(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE deleted_at IS NULL AND lower(subtype) = lower($1) AND $2::text[] <@ "+beastTags+" AND visibility = 'public'")).
+		WithArgs("Mind Flayer", []string{"underdark"}).
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Mind Flayer", "Aberration", "7", map[string]string{}, "", "", "public", "", 15, "13d8+13", "Mind Flayer", "Medium", "lawful evil", []string{"underdark"}, "", 0))
+
+	router := gin.Default()
+	router.GET("/beasts", ListItems)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts?subtype=Mind+Flayer&tag=underdark", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Tags":["underdark"]`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/beasts?size=enormous", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
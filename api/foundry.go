@@ -0,0 +1,236 @@
+package api
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/keremenci/bestiary-crud/rules"
+)
+
+// foundryActor is an NPC actor of the dnd5e system of Foundry VTT, as imported with "Import Data"
+type foundryActor struct {
+	Name           string                            `json:"name"`
+	Type           string                            `json:"type"`
+	System         foundryNPC                        `json:"system"`
+	Items          []foundryItem                     `json:"items"`
+	PrototypeToken foundryToken                      `json:"prototypeToken"`
+	Flags          map[string]map[string]interface{} `json:"flags,omitempty"`
+}
+
+type foundryNPC struct {
+	Abilities  map[string]foundryAbility `json:"abilities"`
+	Attributes foundryAttributes         `json:"attributes"`
+	Details    foundryDetails            `json:"details"`
+	Traits     foundryTraits             `json:"traits"`
+}
+
+type foundryAbility struct {
+	Value      int `json:"value"`
+	Proficient int `json:"proficient"`
+}
+
+type foundryAttributes struct {
+	AC foundryAC `json:"ac"`
+	HP foundryHP `json:"hp"`
+}
+
+// foundryAC is a flat armor class, or the one computed by Foundry when Flat is nil
+type foundryAC struct {
+	Calc string `json:"calc"`
+	Flat *int   `json:"flat"`
+}
+
+type foundryHP struct {
+	Value   int    `json:"value"`
+	Max     int    `json:"max"`
+	Formula string `json:"formula"`
+}
+
+type foundryDetails struct {
+	Biography foundryText       `json:"biography"`
+	Alignment string            `json:"alignment"`
+	Type      foundryType       `json:"type"`
+	CR        float64           `json:"cr"`
+	Source    foundrySourceInfo `json:"source"`
+}
+
+type foundryText struct {
+	Value string `json:"value"`
+}
+
+type foundryType struct {
+	Value   string `json:"value"`
+	Subtype string `json:"subtype"`
+	Custom  string `json:"custom"`
+}
+
+type foundrySourceInfo struct {
+	Book    string `json:"book"`
+	Page    string `json:"page"`
+	Custom  string `json:"custom"`
+	License string `json:"license"`
+}
+
+type foundryTraits struct {
+	Size string `json:"size"`
+}
+
+// foundryItem is a feature (feat) or an attack (weapon) of an actor
+type foundryItem struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	System foundryItemSystem `json:"system"`
+}
+
+type foundryItemSystem struct {
+	Description foundryText        `json:"description"`
+	Type        foundryItemType    `json:"type"`
+	Activation  *foundryActivation `json:"activation,omitempty"`
+	ActionType  string             `json:"actionType,omitempty"`
+	Attack      *foundryAttack     `json:"attack,omitempty"`
+	Damage      *foundryDamage     `json:"damage,omitempty"`
+}
+
+type foundryItemType struct {
+	Value string `json:"value"`
+}
+
+type foundryActivation struct {
+	Type string `json:"type"`
+	Cost int    `json:"cost"`
+}
+
+// foundryAttack is the attack bonus of an item, which is the whole bonus when Flat is set
+type foundryAttack struct {
+	Bonus string `json:"bonus"`
+	Flat  bool   `json:"flat"`
+}
+
+// foundryDamage lists the damage formulas of an item with their damage types
+type foundryDamage struct {
+	Parts [][2]string `json:"parts"`
+}
+
+type foundryToken struct {
+	Name        string  `json:"name"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Disposition int     `json:"disposition"`
+}
+
+// foundrySizes are the size keys of the dnd5e system and the grid squares tokens of each size take up
+var foundrySizes = map[string]struct {
+	Key   string
+	Width float64
+}{
+	"Tiny":       {"tiny", 0.5},
+	"Small":      {"sm", 1},
+	"Medium":     {"med", 1},
+	"Large":      {"lg", 2},
+	"Huge":       {"huge", 3},
+	"Gargantuan": {"grg", 4},
+}
+
+// foundryTypes are the creature types of the dnd5e system. Other types are written as custom types.
+var foundryTypes = []string{"aberration", "beast", "celestial", "construct", "dragon", "elemental", "fey",
+	"fiend", "giant", "humanoid", "monstrosity", "ooze", "plant", "undead"}
+
+// foundryHostile is the token disposition of hostile creatures
+const foundryHostile = -1
+
+// foundryActorOf converts a beast, and the source it comes from if any, to a Foundry VTT actor.
+// Ability scores that can't be read are 10, as in a new actor.
+func foundryActorOf(beast Beast, source *Source) foundryActor {
+	intro, features := parseFeatures(beast.Description)
+	size, ok := foundrySizes[beast.Size]
+	if !ok {
+		size = foundrySizes["Medium"]
+	}
+
+	actor := foundryActor{
+		Name: beast.BeastName,
+		Type: "npc",
+		System: foundryNPC{
+			Abilities:  map[string]foundryAbility{},
+			Attributes: foundryAttributes{AC: foundryAC{Calc: "default"}},
+			Details: foundryDetails{
+				Biography: foundryText{Value: biography(intro, source)},
+				Alignment: beast.Alignment,
+				Type:      foundryType{Value: strings.ToLower(beast.Type), Subtype: beast.Subtype},
+			},
+			Traits: foundryTraits{Size: size.Key},
+		},
+		Items:          []foundryItem{},
+		PrototypeToken: foundryToken{Name: beast.BeastName, Width: size.Width, Height: size.Width, Disposition: foundryHostile},
+	}
+
+	for _, ability := range rules.Abilities {
+		score, err := rules.ParseAbilityScore(beast.Attributes[ability])
+		if err != nil {
+			score = 10
+		}
+		actor.System.Abilities[strings.ToLower(ability)] = foundryAbility{Value: score}
+	}
+	if beast.ArmorClass > 0 {
+		ac := beast.ArmorClass
+		actor.System.Attributes.AC = foundryAC{Calc: "flat", Flat: &ac}
+	}
+	if hd, err := rules.ParseHitDice(beast.HitDice); err == nil {
+		actor.System.Attributes.HP = foundryHP{Value: hd.Average(), Max: hd.Average(), Formula: hd.String()}
+	}
+	if cr, err := rules.CRValue(beast.CR); err == nil {
+		actor.System.Details.CR = cr
+	}
+	if details := &actor.System.Details; !slices.Contains(foundryTypes, details.Type.Value) {
+		details.Type.Value, details.Type.Custom = "custom", beast.Type
+	}
+	if source != nil {
+		actor.System.Details.Source = foundrySourceInfo{Book: source.Abbreviation, License: source.License}
+		if beast.SourcePage > 0 {
+			actor.System.Details.Source.Page = strconv.Itoa(beast.SourcePage)
+		}
+	}
+	if len(beast.Tags) > 0 {
+		actor.Flags = map[string]map[string]interface{}{"bestiary": {"tags": beast.Tags}}
+	}
+
+	for _, f := range features {
+		actor.Items = append(actor.Items, foundryItemOf(f))
+	}
+	return actor
+}
+
+// foundryItemOf converts a feature to a weapon when it is an attack, and to a feat otherwise
+func foundryItemOf(f feature) foundryItem {
+	item := foundryItem{
+		Name:   f.Name,
+		Type:   "feat",
+		System: foundryItemSystem{Description: foundryText{Value: paragraphs(f.Text)}, Type: foundryItemType{Value: "monster"}},
+	}
+	if f.isAction() {
+		item.System.Activation = &foundryActivation{Type: "action", Cost: 1}
+	}
+	if f.Attack == nil {
+		return item
+	}
+
+	item.Type = "weapon"
+	item.System.Type.Value = "natural"
+	switch {
+	case f.Range == "Ranged" && f.Spell:
+		item.System.ActionType = "rsak"
+	case f.Range == "Ranged":
+		item.System.ActionType = "rwak"
+	case f.Spell:
+		item.System.ActionType = "msak"
+	default:
+		item.System.ActionType = "mwak"
+	}
+	item.System.Attack = &foundryAttack{Bonus: strconv.Itoa(f.Attack.ToHit), Flat: true}
+	item.System.Damage = &foundryDamage{Parts: [][2]string{}}
+	for _, d := range f.Attack.Damage {
+		item.System.Damage.Parts = append(item.System.Damage.Parts, [2]string{d.Dice.String(), d.Type})
+	}
+	return item
+}
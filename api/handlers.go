@@ -2,14 +2,22 @@ package api
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/keremenci/bestiary-crud/logging"
+	"github.com/keremenci/bestiary-crud/metrics"
+	"github.com/keremenci/bestiary-crud/rules"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type DBPool interface {
@@ -18,6 +26,7 @@ type DBPool interface {
 	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
 	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
 	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
 // Database connection pool
@@ -25,19 +34,32 @@ var dbPool DBPool
 
 // InitializeDB initializes the database connection pool
 func InitializeDB(connString string) {
+	logger.Info("Connecting to the database", "url", logging.RedactURL(connString))
+
 	var err error
 	pool, err := pgxpool.New(context.Background(), connString)
 	for attempts := 0; attempts < 5; attempts++ {
 		if err == nil {
-			SetDBPool(pool)
-			log.Println("Connected to the database successfully.")
+			SetDBPool(instrumentPool(pool))
+			registerPoolMetrics(pool)
+			logger.Info("Connected to the database successfully")
 			return
 		}
-		log.Printf("Unable to connect to database, retrying in 3 seconds... (%d/5)\n", attempts+1)
+		logger.Warn("Unable to connect to database, retrying in 3 seconds", "attempt", attempts+1, "max_attempts", 5)
 		time.Sleep(3 * time.Second)
 	}
 
-	log.Fatalf("Unable to connect to database: %v\n", err)
+	logger.Error("Unable to connect to database", "err", err)
+	os.Exit(1)
+}
+
+// registerPoolMetrics exports the statistics of the pool, once per process
+func registerPoolMetrics(pool *pgxpool.Pool) {
+	err := metrics.Registry.Register(metrics.NewPoolCollector(pool.Stat))
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if err != nil && !errors.As(err, &alreadyRegistered) {
+		logger.Error("Unable to register pool metrics", "err", err)
+	}
 }
 
 // Function to set the dbPool variable - mostly used for testing
@@ -50,79 +72,242 @@ func HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
-// ListItems retrieves all items from the database
-func ListItems(c *gin.Context) {
-	rows, err := dbPool.Query(context.Background(), "SELECT beast_name, type, cr, attributes, description FROM beasts")
+// beastColumns are the columns scanned by scanBeast, in order
+const beastColumns = "beast_name, type, cr, attributes, description, COALESCE(owner, ''), visibility, COALESCE(campaign, ''), armor_class, hit_dice, " +
+	"subtype, size, alignment, " + beastTags + ", COALESCE(source, ''), source_page"
+
+// beastTags selects the sorted tags of each row of beasts
+const beastTags = "ARRAY(SELECT tag FROM beast_tags WHERE beast_tags.beast_name = beasts.beast_name ORDER BY tag)"
+
+// scanBeast scans a row selected with beastColumns, followed by any extra columns into extra
+func scanBeast(row pgx.Row, beast *Beast, extra ...interface{}) error {
+	return row.Scan(append([]interface{}{&beast.BeastName, &beast.Type, &beast.CR, &beast.Attributes, &beast.Description,
+		&beast.Owner, &beast.Visibility, &beast.Campaign, &beast.ArmorClass, &beast.HitDice,
+		&beast.Subtype, &beast.Size, &beast.Alignment, &beast.Tags, &beast.Source, &beast.SourcePage}, extra...)...)
+}
+
+// normalizeStats checks the armor class, rewrites the hit dice in their usual form and
+// drops any derived statistics and images sent by the client
+func normalizeStats(beast *Beast) error {
+	beast.Derived, beast.Images = nil, nil
+	if beast.ArmorClass < 0 || beast.ArmorClass > 30 {
+		return errors.New("ArmorClass must be between 0 and 30")
+	}
+	if beast.HitDice == "" {
+		return nil
+	}
+	hd, err := rules.ParseHitDice(beast.HitDice)
 	if err != nil {
-		log.Printf("Error querying database: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return err
+	}
+	beast.HitDice = hd.String()
+	return nil
+}
+
+// ListItems retrieves all items visible to the caller from the database, filtered by the query parameters of BeastFilter
+func ListItems(c *gin.Context) {
+	beasts, ok := findBeasts(c, filterFromQuery(c.Request.URL.Query()))
+	if !ok {
 		return
 	}
+	for i := range beasts {
+		beasts[i].Derived = deriveStats(beasts[i])
+	}
+
+	c.JSON(http.StatusOK, beasts)
+}
+
+// findBeasts returns the beasts visible to the caller that match the filter, by name, only of the given names if any.
+// It writes the error response and returns false if the filter is invalid or the query fails.
+func findBeasts(c *gin.Context, f BeastFilter, names ...string) ([]Beast, bool) {
+	conditions, args, err := f.conditions(0)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if len(names) > 0 {
+		args = append(args, names)
+		conditions = append(conditions, fmt.Sprintf("beast_name = ANY($%d)", len(args)))
+	}
+	filter, filterArgs := visibilityFilter(CurrentPrincipal(c), len(args))
+	conditions = append(conditions, filter)
+	rows, err := dbPool.Query(c.Request.Context(), "SELECT "+beastColumns+" FROM beasts WHERE deleted_at IS NULL AND "+strings.Join(conditions, " AND ")+
+		" ORDER BY beast_name", append(args, filterArgs...)...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
 	defer rows.Close()
 
 	var beasts []Beast
 	for rows.Next() {
 		var beast Beast
-		err = rows.Scan(&beast.BeastName, &beast.Type, &beast.CR, &beast.Attributes, &beast.Description)
-		if err != nil {
-			log.Printf("Error scanning row: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-			return
+		if err := scanBeast(rows, &beast); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return nil, false
 		}
 		beasts = append(beasts, beast)
 	}
-
-	c.JSON(http.StatusOK, beasts)
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	return beasts, true
 }
 
-// GetItem retrieves a single item by key from the database
+// GetItem retrieves a single item by key from the database, along with its images.
+// A key ending in .pdf returns the stat block of the beast as a PDF instead.
 func GetItem(c *gin.Context) {
-	key := c.Param("key")
-	var beast Beast
+	if key, ok := strings.CutSuffix(c.Param("key"), ".pdf"); ok {
+		getBeastPDF(c, key)
+		return
+	}
+	beast, ok := loadBeast(c, c.Param("key"))
+	if !ok {
+		return
+	}
+	beast.Derived = deriveStats(beast)
+	if beast.Images, ok = loadImages(c, beast.BeastName); !ok {
+		return
+	}
+	c.JSON(http.StatusOK, beast)
+}
 
-	err := dbPool.QueryRow(context.Background(), "SELECT beast_name, type, cr, attributes, description FROM beasts WHERE beast_name=$1", key).
-		Scan(&beast.BeastName, &beast.Type, &beast.CR, &beast.Attributes, &beast.Description)
+// loadBeast loads a beast visible to the caller that is not in the trash.
+// It writes the error response and returns false if there is none.
+func loadBeast(c *gin.Context, key string) (Beast, bool) {
+	var beast Beast
+	filter, args := visibilityFilter(CurrentPrincipal(c), 1)
+	err := scanBeast(dbPool.QueryRow(c.Request.Context(), "SELECT "+beastColumns+" FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND "+filter,
+		append([]interface{}{key}, args...)...), &beast)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Beast not found"})
+			respondError(c, http.StatusNotFound, "Beast not found")
 		} else {
-			log.Printf("Error querying database: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
 		}
-		return
+		return beast, false
 	}
-
-	c.JSON(http.StatusOK, beast)
+	return beast, true
 }
 
-// PutItem creates a new item in the database
+// PutItem creates a new item in the database, owned by the caller
 func PutItem(c *gin.Context) {
 	var beast Beast
 	if err := c.ShouldBindJSON(&beast); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if strings.TrimSpace(beast.BeastName) == "" {
+		respondError(c, http.StatusBadRequest, "BeastName is required")
+		return
+	}
+	if err := normalizeVisibility(&beast); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := normalizeStats(&beast); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := normalizeTaxonomy(&beast); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := normalizeSource(&beast); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !createBeast(c, &beast) {
 		return
 	}
+	response := gin.H{"BeastName": beast.BeastName}
+	if warning := crWarning(beast); warning != "" {
+		response["Warnings"] = []string{warning}
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// createBeast inserts a new beast owned by the caller. It writes the error response and returns false if it fails.
+func createBeast(c *gin.Context, beast *Beast) bool {
+	principal := CurrentPrincipal(c)
+	if !canShareWith(principal, beast.Campaign) {
+		abortWithProblem(c, http.StatusForbidden, "Not a member of this campaign")
+		return false
+	}
+	beast.Owner = ""
+	if principal != nil {
+		beast.Owner = principal.Subject
+	}
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	defer tx.Rollback(ctx)
 
 	// Use ON CONFLICT DO NOTHING to handle duplicate primary keys
-	cmdTag, err := dbPool.Exec(context.Background(), `
-		INSERT INTO beasts (beast_name, type, cr, attributes, description) 
-		VALUES ($1, $2, $3, $4, $5)
+	cmdTag, err := tx.Exec(ctx, `
+		INSERT INTO beasts (beast_name, type, cr, attributes, description, owner, visibility, campaign, armor_class, hit_dice, subtype, size, alignment, source, source_page) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 		ON CONFLICT (beast_name) DO NOTHING`,
-		beast.BeastName, beast.Type, beast.CR, beast.Attributes, beast.Description)
+		beast.BeastName, beast.Type, beast.CR, beast.Attributes, beast.Description,
+		nullIfEmpty(beast.Owner), beast.Visibility, nullIfEmpty(beast.Campaign), beast.ArmorClass, beast.HitDice,
+		beast.Subtype, beast.Size, beast.Alignment, nullIfEmpty(beast.Source), beast.SourcePage)
 
+	if isViolation(err, foreignKeyViolation) {
+		respondError(c, http.StatusBadRequest, "Unknown source")
+		return false
+	}
 	if err != nil {
-		log.Printf("Error inserting into database: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
+		requestLogger(c).Error("Error inserting into database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
 	}
 
 	// Check if the insert was successful
 	if cmdTag.RowsAffected() == 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "Beast already exists"})
-		return
+		respondError(c, http.StatusConflict, "Beast already exists")
+		return false
+	}
+	if len(beast.Tags) > 0 {
+		if err := setBeastTags(ctx, tx, beast.BeastName, beast.Tags); err != nil {
+			requestLogger(c).Error("Error tagging beast", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+	}
+
+	return recordChangeAndCommit(c, tx, AuditCreate, beast.BeastName, nil, beast)
+}
+
+// loadForUpdate locks a beast that is not in the trash for the rest of the transaction and checks that the caller may modify it,
+// using anyAction to decide for beasts the caller does not own. It writes the error response and returns false if not.
+func loadForUpdate(c *gin.Context, tx pgx.Tx, key, anyAction string) (current Beast, ok bool) {
+	err := scanBeast(tx.QueryRow(c.Request.Context(), "SELECT "+beastColumns+" FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL FOR UPDATE", key), &current)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Beast not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return current, false
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"BeastName": beast.BeastName})
+	if !canModify(CurrentPrincipal(c), current.Owner, anyAction) {
+		abortWithProblem(c, http.StatusForbidden, "Only the owner or a moderator can modify this beast")
+		return current, false
+	}
+	return current, true
 }
 
 // UpdateItem updates an existing item in the database
@@ -130,29 +315,118 @@ func UpdateItem(c *gin.Context) {
 	key := c.Param("key")
 	var beast Beast
 	if err := c.ShouldBindJSON(&beast); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		respondError(c, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
-	_, err := dbPool.Exec(context.Background(), "UPDATE beasts SET type=$1, cr=$2, attributes=$3, description=$4 WHERE beast_name=$5",
-		beast.Type, beast.CR, beast.Attributes, beast.Description, key)
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
 	if err != nil {
-		log.Printf("Error updating database: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	current, ok := loadForUpdate(c, tx, key, ActionUpdateAnyBeast)
+	if !ok {
+		return
+	}
+
+	// Keep the current visibility unless the update sets one
+	if beast.Visibility == "" {
+		beast.Visibility = current.Visibility
+		if beast.Campaign == "" {
+			beast.Campaign = current.Campaign
+		}
+	}
+	if !saveUpdate(c, tx, key, current, beast) {
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Beast updated successfully"})
 }
 
-// DeleteItem deletes an item from the database
+// saveUpdate replaces the locked beast current with beast and commits the transaction.
+// It writes the error response and returns false on failure.
+func saveUpdate(c *gin.Context, tx pgx.Tx, key string, current, beast Beast) bool {
+	if err := normalizeVisibility(&beast); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err := normalizeStats(&beast); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err := normalizeTaxonomy(&beast); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err := normalizeSource(&beast); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if beast.Campaign != current.Campaign && !canShareWith(CurrentPrincipal(c), beast.Campaign) {
+		abortWithProblem(c, http.StatusForbidden, "Not a member of this campaign")
+		return false
+	}
+
+	ctx := c.Request.Context()
+	_, err := tx.Exec(ctx, "UPDATE beasts SET type=$1, cr=$2, attributes=$3, description=$4, visibility=$5, campaign=$6, armor_class=$7, hit_dice=$8, "+
+		"subtype=$9, size=$10, alignment=$11, source=$12, source_page=$13 WHERE beast_name=$14",
+		beast.Type, beast.CR, beast.Attributes, beast.Description, beast.Visibility, nullIfEmpty(beast.Campaign), beast.ArmorClass, beast.HitDice,
+		beast.Subtype, beast.Size, beast.Alignment, nullIfEmpty(beast.Source), beast.SourcePage, key)
+	if isViolation(err, foreignKeyViolation) {
+		respondError(c, http.StatusBadRequest, "Unknown source")
+		return false
+	}
+	if err != nil {
+		requestLogger(c).Error("Error updating database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	if !slices.Equal(current.Tags, beast.Tags) {
+		if err := setBeastTags(ctx, tx, key, beast.Tags); err != nil {
+			requestLogger(c).Error("Error tagging beast", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+	}
+
+	beast.BeastName = key
+	beast.Owner = current.Owner
+	return recordChangeAndCommit(c, tx, AuditUpdate, key, &current, &beast)
+}
+
+// DeleteItem moves an item to the trash, from where it can be restored until it is purged
 func DeleteItem(c *gin.Context) {
 	key := c.Param("key")
 
-	_, err := dbPool.Exec(context.Background(), "DELETE FROM beasts WHERE beast_name=$1", key)
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	current, ok := loadForUpdate(c, tx, key, ActionDeleteAnyBeast)
+	if !ok {
+		return
+	}
+	if !releaseEncounterBeasts(c, tx, key) {
+		return
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE beasts SET deleted_at = now() WHERE beast_name=$1", key)
 	if err != nil {
-		log.Printf("Error deleting from database: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		requestLogger(c).Error("Error deleting from database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if !recordChangeAndCommit(c, tx, AuditDelete, key, &current, nil) {
 		return
 	}
 
@@ -10,10 +10,30 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 )
 
+// beastRowColumns are the columns returned by queries selecting beastColumns
+var beastRowColumns = []string{"beast_name", "type", "cr", "attributes", "description", "owner", "visibility", "campaign", "armor_class", "hit_dice",
+	"subtype", "size", "alignment", "tags", "source", "source_page"}
+
+// lockQuery is the query UpdateItem and DeleteItem use to lock a beast and check the caller may modify it
+var lockQuery = regexp.QuoteMeta("SELECT " + beastColumns + " FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL FOR UPDATE")
+
+// encounterUsesQuery counts the saved encounters using a beast about to be deleted
+var encounterUsesQuery = regexp.QuoteMeta("SELECT count(*) FROM encounter_beasts WHERE beast_name=$1")
+
+// auditInsert is the statement recording a change in the audit log
+var auditInsert = regexp.QuoteMeta("INSERT INTO audit_log (beast_name, actor, action, before, after, request_id)")
+
+// revisionInsert is the statement saving a new version of a beast
+var revisionInsert = regexp.QuoteMeta("INSERT INTO beast_revisions (beast_name, revision, data, author, request_id)")
+
+// eventInsert is the statement publishing a change to the event stream
+var eventInsert = regexp.QuoteMeta("INSERT INTO beast_events (beast_name, action, data, before)")
+
 // TestHealthCheck tests the GET / endpoint
 func TestHealthCheck(t *testing.T) {
 	router := gin.Default()
@@ -39,9 +59,10 @@ func TestShouldListItems(t *testing.T) {
 	SetDBPool(mock)
 
 	// Setup rows
-	rows := mock.NewRows([]string{"beast_name", "type", "cr", "attributes", "description"}).
-		AddRow("TestBeast", "TestType", "1", map[string]string{"STR": "10"}, "Test description")
-	mock.ExpectQuery("SELECT beast_name, type, cr, attributes, description FROM beasts").WillReturnRows(rows)
+	rows := mock.NewRows(beastRowColumns).
+		AddRow("TestBeast", "TestType", "1", map[string]string{"STR": "10"}, "Test description", "", "public", "", 0, "", "", "", "", []string{}, "", 0)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + beastColumns + " FROM beasts WHERE deleted_at IS NULL AND visibility = 'public'")).
+		WillReturnRows(rows)
 
 	// Setup router
 
@@ -69,11 +90,12 @@ func TestGetItem(t *testing.T) {
 	defer mock.Close()
 	SetDBPool(mock)
 
-	rows := mock.NewRows([]string{"beast_name", "type", "cr", "attributes", "description"}).
-		AddRow("TestBeast", "TestType", "1", map[string]string{"STR": "10"}, "Test description")
+	rows := mock.NewRows(beastRowColumns).
+		AddRow("TestBeast", "TestType", "1", map[string]string{"STR": "10"}, "Test description", "", "public", "", 0, "", "", "", "", []string{}, "", 0)
 
-	queryRegex := regexp.QuoteMeta("SELECT beast_name, type, cr, attributes, description FROM beasts WHERE beast_name=$1")
+	queryRegex := regexp.QuoteMeta("SELECT " + beastColumns + " FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND visibility = 'public'")
 	mock.ExpectQuery(queryRegex).WithArgs("TestBeast").WillReturnRows(rows)
+	mock.ExpectQuery(imageQuery).WithArgs("TestBeast").WillReturnRows(mock.NewRows(imageRowColumns))
 
 	// Setup router
 	router := gin.Default()
@@ -106,6 +128,12 @@ func TestGetItem(t *testing.T) {
 		assert.Equal(t, "10", attributesResponse["STR"])
 	}
 
+	derived, ok := response["Derived"].(map[string]interface{})
+	if assert.True(t, ok, "Derived should be a map") {
+		assert.Equal(t, float64(2), derived["ProficiencyBonus"])
+		assert.Equal(t, float64(200), derived["XP"])
+	}
+
 	// Ensure all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -123,13 +151,26 @@ func TestPutItem(t *testing.T) {
 	SetDBPool(mock)
 
 	// Use ExpectExec for INSERT queries
-	queryRegex := regexp.QuoteMeta("INSERT INTO beasts (beast_name, type, cr, attributes, description) VALUES ($1, $2, $3, $4, $5)")
+	mock.ExpectBegin()
+	queryRegex := regexp.QuoteMeta("INSERT INTO beasts (beast_name, type, cr, attributes, description, owner, visibility, campaign, armor_class, hit_dice, subtype, size, alignment, source, source_page) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)")
 	mock.ExpectExec(queryRegex).
-		WithArgs("TestBeast", "TestType", "1", map[string]string{"STR": "10"}, "Test description").
+		WithArgs("TestBeast", "TestType", "1", map[string]string{"STR": "10"}, "Test description", "dm-1", "public", nil, 0, "", "", "", "", nil, 0).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	after := []byte(`{"BeastName":"TestBeast","Type":"TestType","CR":"1","Attributes":{"STR":"10"},"Description":"Test description","Owner":"dm-1","Visibility":"public"}`)
+	mock.ExpectExec(auditInsert).
+		WithArgs("TestBeast", "dm-1", AuditCreate, []byte(nil), after, nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(revisionInsert).
+		WithArgs("TestBeast", after, "dm-1", nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(eventInsert).
+		WithArgs("TestBeast", AuditCreate, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
 
 	// Setup Router
 	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{"editor"}}))
 	router.POST("/beasts", PutItem)
 
 	beast := Beast{
@@ -163,6 +204,28 @@ func TestPutItem(t *testing.T) {
 	}
 }
 
+func TestPutItem_NoName(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{"editor"}}))
+	router.POST("/beasts", PutItem)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/beasts", bytes.NewBufferString(`{"BeastName":" ","Type":"TestType","CR":"1"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestUpdateItem(t *testing.T) {
 	// Setup mock database
 	mock, err := pgxmock.NewPool()
@@ -172,22 +235,50 @@ func TestUpdateItem(t *testing.T) {
 	defer mock.Close()
 	SetDBPool(mock)
 
+	// The beast is locked and its owner checked before the update
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).WithArgs("TestBeast").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("TestBeast", "TestType", "1", map[string]string{"STR": "10"}, "Test description", "", "public", "", 0, "", "", "", "", []string{}, "", 0))
+
 	// Define the expected query and arguments for the UPDATE operation
-	queryRegex := regexp.QuoteMeta("UPDATE beasts SET type=$1, cr=$2, attributes=$3, description=$4 WHERE beast_name=$5")
+	queryRegex := regexp.QuoteMeta("UPDATE beasts SET type=$1, cr=$2, attributes=$3, description=$4, visibility=$5, campaign=$6, armor_class=$7, hit_dice=$8, " +
+		"subtype=$9, size=$10, alignment=$11, source=$12, source_page=$13 WHERE beast_name=$14")
 	mock.ExpectExec(queryRegex).
-		WithArgs("UpdatedType", "2", map[string]string{"STR": "12"}, "Updated description", "TestBeast").
+		WithArgs("Aberration", "2", map[string]string{"STR": "12"}, "Updated description", "public", nil, 0, "", "Mind Flayer", "Large", "", nil, 0, "TestBeast").
 		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	// The tags changed, so they are replaced
+	tags := []string{"forest", "underdark"}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO tags (name)")).WithArgs(tags).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM beast_tags")).WithArgs("TestBeast", tags).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO beast_tags")).WithArgs("TestBeast", tags).WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	before := []byte(`{"BeastName":"TestBeast","Type":"TestType","CR":"1","Attributes":{"STR":"10"},"Description":"Test description","Visibility":"public"}`)
+	after := []byte(`{"BeastName":"TestBeast","Type":"Aberration","Subtype":"Mind Flayer","Size":"Large","CR":"2","Attributes":{"STR":"12"},` +
+		`"Description":"Updated description","Visibility":"public","Tags":["forest","underdark"]}`)
+	mock.ExpectExec(auditInsert).
+		WithArgs("TestBeast", "admin-1", AuditUpdate, before, after, nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(revisionInsert).
+		WithArgs("TestBeast", after, "admin-1", nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(eventInsert).
+		WithArgs("TestBeast", AuditUpdate, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
 
 	// Setup router
 	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "admin-1", Roles: []string{"admin"}}))
 	router.PUT("/beasts/:key", UpdateItem)
 
 	beast := Beast{
 		BeastName:   "TestBeast",
-		Type:        "UpdatedType",
+		Type:        "Aberration (Mind Flayer)",
+		Size:        "large",
 		CR:          "2",
 		Attributes:  map[string]string{"STR": "12"},
 		Description: "Updated description",
+		Tags:        []string{"Underdark", "forest", "underdark"},
 	}
 	jsonValue, _ := json.Marshal(beast)
 
@@ -222,14 +313,30 @@ func TestDeleteItem(t *testing.T) {
 	defer mock.Close()
 	SetDBPool(mock)
 
-	// Define the expected query for the DELETE operation
-	queryRegex := regexp.QuoteMeta("DELETE FROM beasts WHERE beast_name=$1")
+	// The beast is locked and its owner checked before the delete
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).WithArgs("TestBeast").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("TestBeast", "TestType", "1", map[string]string{}, "", "dm-1", "private", "", 0, "", "", "", "", []string{}, "", 0))
+
+	mock.ExpectQuery(encounterUsesQuery).WithArgs("TestBeast").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	// Deleting moves the beast to the trash
+	queryRegex := regexp.QuoteMeta("UPDATE beasts SET deleted_at = now() WHERE beast_name=$1")
 	mock.ExpectExec(queryRegex).
 		WithArgs("TestBeast").
-		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(auditInsert).
+		WithArgs("TestBeast", "dm-1", AuditDelete, pgxmock.AnyArg(), []byte(nil), nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(eventInsert).
+		WithArgs("TestBeast", AuditDelete, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
 
 	// Setup router
 	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{"editor"}}))
 	router.DELETE("/beasts/:key", DeleteItem)
 
 	w := httptest.NewRecorder()
@@ -253,3 +360,13 @@ func TestDeleteItem(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestNormalizeStats(t *testing.T) {
+	beast := Beast{ArmorClass: 13, HitDice: "7d10 + 21"}
+	assert.NoError(t, normalizeStats(&beast))
+	assert.Equal(t, "7d10+21", beast.HitDice)
+
+	assert.Error(t, normalizeStats(&Beast{ArmorClass: 31}))
+	assert.Error(t, normalizeStats(&Beast{HitDice: "lots"}))
+	assert.NoError(t, normalizeStats(&Beast{}))
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/keremenci/bestiary-crud/imaging"
+	"github.com/keremenci/bestiary-crud/storage"
+)
+
+// Kinds of beast images
+const (
+	ImageArtwork = "artwork"
+	ImageToken   = "token" // virtual tabletop token
+)
+
+// imageExtensions are the accepted content types, which the standard library decodes, and their file extensions
+var imageExtensions = map[string]string{"image/png": "png", "image/jpeg": "jpg", "image/gif": "gif"}
+
+// Image is artwork or a token attached to a beast. The files are served from URL and ThumbnailURL.
+type Image struct {
+	ID           int64     `json:"ID"`
+	Kind         string    `json:"Kind"`
+	ContentType  string    `json:"ContentType"`
+	Width        int       `json:"Width"`
+	Height       int       `json:"Height"`
+	Size         int64     `json:"Size"`
+	URL          string    `json:"URL"`
+	ThumbnailURL string    `json:"ThumbnailURL"`
+	UploadedBy   string    `json:"UploadedBy,omitempty"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+}
+
+// ImageOptions limit uploaded images to MaxSize bytes, MaxDimension pixels on either side and MaxPixels
+// pixels in all, which bounds the memory they decode to, and set the size of the square thumbnails fit in
+type ImageOptions struct {
+	MaxSize       int64
+	MaxDimension  int
+	MaxPixels     int
+	ThumbnailSize int
+}
+
+var imageStore storage.Store
+var imageOptions = ImageOptions{MaxSize: 5 << 20, MaxDimension: 4096, MaxPixels: 12_000_000, ThumbnailSize: 256}
+
+// SetImageStore sets where uploaded images are kept and how large they may be. Uploads are refused until it is called.
+func SetImageStore(store storage.Store, opts ImageOptions) {
+	imageStore = store
+	imageOptions = opts
+}
+
+// imageColumns are the columns scanned into an Image by scanImage
+const imageColumns = "id, kind, content_type, width, height, size, uploaded_by, created_at"
+
+func scanImage(row pgx.Row, img *Image) error {
+	err := row.Scan(&img.ID, &img.Kind, &img.ContentType, &img.Width, &img.Height, &img.Size, &img.UploadedBy, &img.CreatedAt)
+	img.URL = fmt.Sprintf("/images/%d", img.ID)
+	img.ThumbnailURL = img.URL + "/thumbnail"
+	return err
+}
+
+// loadImages returns the images of a beast, oldest first.
+// It writes the error response and returns false if the query fails.
+func loadImages(c *gin.Context, key string) ([]Image, bool) {
+	rows, err := dbPool.Query(c.Request.Context(), "SELECT "+imageColumns+" FROM beast_images WHERE beast_name = $1 ORDER BY id", key)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	defer rows.Close()
+
+	var images []Image
+	for rows.Next() {
+		var img Image
+		if err := scanImage(rows, &img); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return nil, false
+		}
+		images = append(images, img)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	return images, true
+}
+
+// readImage reads the image file of a multipart upload and checks its size, type and dimensions.
+// It writes the error response and returns false if the upload is not an acceptable image.
+func readImage(c *gin.Context) (data []byte, contentType string, img image.Image, ok bool) {
+	// Leave room for the rest of the multipart body
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, imageOptions.MaxSize+64<<10)
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Images may not be larger than %d bytes", imageOptions.MaxSize))
+		} else {
+			respondError(c, http.StatusBadRequest, "Expected a multipart form with the file in an image field")
+		}
+		return nil, "", nil, false
+	}
+	defer file.Close()
+	if header.Size > imageOptions.MaxSize {
+		respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Images may not be larger than %d bytes", imageOptions.MaxSize))
+		return nil, "", nil, false
+	}
+	if data, err = io.ReadAll(file); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return nil, "", nil, false
+	}
+
+	// Trust the contents rather than the name or the declared type, but refuse contradicting declarations
+	contentType = http.DetectContentType(data)
+	if _, ok := imageExtensions[contentType]; !ok {
+		respondError(c, http.StatusUnsupportedMediaType, "Unsupported image type "+contentType+", expected PNG, JPEG or GIF")
+		return nil, "", nil, false
+	}
+	if declared, _, err := mime.ParseMediaType(header.Header.Get("Content-Type")); err == nil &&
+		declared != contentType && declared != "application/octet-stream" {
+		respondError(c, http.StatusUnsupportedMediaType, "The file is "+contentType+", not "+declared)
+		return nil, "", nil, false
+	}
+
+	// Check the dimensions before decoding, so small files cannot expand into huge images
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid image")
+		return nil, "", nil, false
+	}
+	if config.Width > imageOptions.MaxDimension || config.Height > imageOptions.MaxDimension {
+		respondError(c, http.StatusUnprocessableEntity, fmt.Sprintf("Images may not be larger than %dx%d pixels", imageOptions.MaxDimension, imageOptions.MaxDimension))
+		return nil, "", nil, false
+	}
+	if config.Width*config.Height > imageOptions.MaxPixels {
+		respondError(c, http.StatusUnprocessableEntity, fmt.Sprintf("Images may not have more than %d pixels", imageOptions.MaxPixels))
+		return nil, "", nil, false
+	}
+	if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid image")
+		return nil, "", nil, false
+	}
+	return data, contentType, img, true
+}
+
+// UploadImage attaches an image uploaded as multipart form data to a beast, in an image field along with
+// an optional kind field of artwork (the default) or token. Only the owner of the beast or a moderator may.
+func UploadImage(c *gin.Context) {
+	if imageStore == nil {
+		respondError(c, http.StatusServiceUnavailable, "Image uploads are not configured")
+		return
+	}
+	beast, ok := loadBeast(c, c.Param("key"))
+	if !ok {
+		return
+	}
+	if !canModify(CurrentPrincipal(c), beast.Owner, ActionUpdateAnyBeast) {
+		abortWithProblem(c, http.StatusForbidden, "Only the owner or a moderator can add images to this beast")
+		return
+	}
+
+	data, contentType, decoded, ok := readImage(c)
+	if !ok {
+		return
+	}
+	kind := c.DefaultPostForm("kind", ImageArtwork)
+	if kind != ImageArtwork && kind != ImageToken {
+		respondError(c, http.StatusBadRequest, "Invalid kind, expected artwork or token")
+		return
+	}
+
+	var thumbnail bytes.Buffer
+	if err := png.Encode(&thumbnail, imaging.Thumbnail(decoded, imageOptions.ThumbnailSize)); err != nil {
+		requestLogger(c).Error("Error encoding thumbnail", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	ctx := c.Request.Context()
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		requestLogger(c).Error("Error naming image", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	key := "beasts/" + hex.EncodeToString(name) + "." + imageExtensions[contentType]
+	thumbnailKey := "beasts/" + hex.EncodeToString(name) + "_thumbnail.png"
+	if err := storeImage(ctx, key, data, thumbnailKey, thumbnail.Bytes()); err != nil {
+		requestLogger(c).Error("Error storing image", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	bounds := decoded.Bounds()
+	img := Image{Kind: kind, ContentType: contentType, Width: bounds.Dx(), Height: bounds.Dy(), Size: int64(len(data)), UploadedBy: actorOf(c)}
+	err := dbPool.QueryRow(ctx, `
+		INSERT INTO beast_images (beast_name, kind, content_type, width, height, size, key, thumbnail_key, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`,
+		beast.BeastName, img.Kind, img.ContentType, img.Width, img.Height, img.Size, key, thumbnailKey, img.UploadedBy).
+		Scan(&img.ID, &img.CreatedAt)
+	if err != nil {
+		deleteImageFiles(ctx, key, thumbnailKey)
+		requestLogger(c).Error("Error inserting into database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	img.URL = fmt.Sprintf("/images/%d", img.ID)
+	img.ThumbnailURL = img.URL + "/thumbnail"
+
+	c.JSON(http.StatusCreated, img)
+}
+
+// storeImage puts an image and its thumbnail in the image store, or neither
+func storeImage(ctx context.Context, key string, data []byte, thumbnailKey string, thumbnail []byte) error {
+	if err := imageStore.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if err := imageStore.Put(ctx, thumbnailKey, bytes.NewReader(thumbnail)); err != nil {
+		deleteImageFiles(ctx, key)
+		return err
+	}
+	return nil
+}
+
+// deleteImageFiles removes files from the image store. Failures only leave unused files behind, so they are logged.
+func deleteImageFiles(ctx context.Context, keys ...string) {
+	if imageStore == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := imageStore.Delete(ctx, key); err != nil {
+			logger.Error("Error deleting image", "key", key, "err", err)
+		}
+	}
+}
+
+// ServeImage returns the file of an image of a beast visible to the caller
+func ServeImage(c *gin.Context) {
+	serveImage(c, "key", "content_type")
+}
+
+// ServeThumbnail returns the PNG thumbnail of an image of a beast visible to the caller
+func ServeThumbnail(c *gin.Context) {
+	serveImage(c, "thumbnail_key", "'image/png'")
+}
+
+// serveImage streams the file stored under the key column of an image, with the given content type expression
+func serveImage(c *gin.Context, keyColumn, contentTypeColumn string) {
+	if imageStore == nil {
+		respondError(c, http.StatusServiceUnavailable, "Image uploads are not configured")
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Image not found")
+		return
+	}
+
+	var key, contentType string
+	filter, args := visibilityFilter(CurrentPrincipal(c), 1)
+	err = dbPool.QueryRow(c.Request.Context(), "SELECT "+keyColumn+", "+contentTypeColumn+" FROM beast_images JOIN beasts USING (beast_name) "+
+		"WHERE id = $1 AND deleted_at IS NULL AND "+filter, append([]interface{}{id}, args...)...).Scan(&key, &contentType)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Image not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	file, err := imageStore.Open(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Image not found")
+		} else {
+			requestLogger(c).Error("Error opening image", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+	defer file.Close()
+
+	// Files never change under a key, but private beasts' images must not be kept by shared caches
+	c.DataFromReader(http.StatusOK, -1, contentType, file, map[string]string{
+		"Cache-Control":          "private, max-age=86400",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// DeleteImage removes an image from a beast. Only the owner of the beast or a moderator may.
+func DeleteImage(c *gin.Context) {
+	beast, ok := loadBeast(c, c.Param("key"))
+	if !ok {
+		return
+	}
+	if !canModify(CurrentPrincipal(c), beast.Owner, ActionUpdateAnyBeast) {
+		abortWithProblem(c, http.StatusForbidden, "Only the owner or a moderator can remove images of this beast")
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Image not found")
+		return
+	}
+
+	var key, thumbnailKey string
+	err = dbPool.QueryRow(c.Request.Context(), "DELETE FROM beast_images WHERE id = $1 AND beast_name = $2 RETURNING key, thumbnail_key",
+		id, beast.BeastName).Scan(&key, &thumbnailKey)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Image not found")
+		} else {
+			requestLogger(c).Error("Error deleting from database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+	deleteImageFiles(c.Request.Context(), key, thumbnailKey)
+
+	c.Status(http.StatusNoContent)
+}
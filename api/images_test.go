@@ -0,0 +1,376 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/keremenci/bestiary-crud/storage"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	imageQuery      = regexp.QuoteMeta("SELECT " + imageColumns + " FROM beast_images WHERE beast_name = $1 ORDER BY id")
+	imageRowColumns = []string{"id", "kind", "content_type", "width", "height", "size", "uploaded_by", "created_at"}
+	ownedBeastQuery = regexp.QuoteMeta("FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND (visibility = 'public' OR owner = $2")
+)
+
+// testPNG returns a w by h PNG image
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// multipartImage returns a multipart body with the file in an image field declared as contentType,
+// and the other fields given
+func multipartImage(t *testing.T, data []byte, contentType string, fields map[string]string) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, mw.WriteField(name, value))
+	}
+	if data != nil {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="image"; filename="owlbear.png"`)
+		header.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(header)
+		require.NoError(t, err)
+		part.Write(data)
+	}
+	require.NoError(t, mw.Close())
+	return &body, mw.FormDataContentType()
+}
+
+// testStore is a local image store in a temporary directory
+type testStore struct {
+	*storage.LocalStore
+	dir string
+}
+
+// useImageStore sets a local image store in a temporary directory for the test
+func useImageStore(t *testing.T, opts ImageOptions) testStore {
+	dir := t.TempDir()
+	store, err := storage.NewLocalStore(dir)
+	require.NoError(t, err)
+	SetImageStore(store, opts)
+	t.Cleanup(func() { SetImageStore(nil, ImageOptions{}) })
+	return testStore{store, dir}
+}
+
+// keys returns the keys of the stored files
+func (s testStore) keys(t *testing.T) []string {
+	var keys []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(s.dir, path)
+			keys = append(keys, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return keys
+}
+
+// read returns the contents of a stored file
+func (s testStore) read(t *testing.T, key string) []byte {
+	f, err := s.Open(context.Background(), key)
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return data
+}
+
+func TestUploadImage(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	store := useImageStore(t, ImageOptions{MaxSize: 1 << 20, MaxDimension: 1024, MaxPixels: 1 << 20, ThumbnailSize: 64})
+
+	data := testPNG(t, 300, 150)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(ownedBeastQuery).WithArgs("Owlbear", "dm-1", pgxmock.AnyArg()).
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "dm-1", "private", "", 13, "7d10+21", "", "", "", []string{}, "", 0))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO beast_images (beast_name, kind, content_type, width, height, size, key, thumbnail_key, uploaded_by)")).
+		WithArgs("Owlbear", ImageToken, "image/png", 300, 150, int64(len(data)), pgxmock.AnyArg(), pgxmock.AnyArg(), "dm-1").
+		WillReturnRows(mock.NewRows([]string{"id", "created_at"}).AddRow(int64(7), created))
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.POST("/beasts/:key/images", UploadImage)
+
+	body, contentType := multipartImage(t, data, "image/png", map[string]string{"kind": "token"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/beasts/Owlbear/images", body)
+	req.Header.Set("Content-Type", contentType)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var img Image
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &img))
+	assert.Equal(t, Image{ID: 7, Kind: ImageToken, ContentType: "image/png", Width: 300, Height: 150, Size: int64(len(data)),
+		URL: "/images/7", ThumbnailURL: "/images/7/thumbnail", UploadedBy: "dm-1", CreatedAt: created}, img)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// The stored image is the upload, and the thumbnail fits in the configured size
+	var original, thumbnail string
+	keys := store.keys(t)
+	require.Len(t, keys, 2)
+	for _, key := range keys {
+		if strings.HasSuffix(key, "_thumbnail.png") {
+			thumbnail = key
+		} else {
+			original = key
+		}
+	}
+	assert.Equal(t, data, store.read(t, original))
+	config, err := png.DecodeConfig(bytes.NewReader(store.read(t, thumbnail)))
+	require.NoError(t, err)
+	assert.Equal(t, 64, config.Width)
+	assert.Equal(t, 32, config.Height)
+}
+
+func TestUploadImage_Rejected(t *testing.T) {
+	gif := []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\xff\xff\xff\x00\x00\x00!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+	tests := []struct {
+		name        string
+		subject     string
+		data        []byte
+		contentType string
+		fields      map[string]string
+		code        int
+	}{
+		{"NotOwner", "dm-2", nil, "", nil, http.StatusForbidden},
+		{"NoFile", "dm-1", nil, "", nil, http.StatusBadRequest},
+		{"NotAnImage", "dm-1", []byte("<svg xmlns='http://www.w3.org/2000/svg'></svg>"), "image/svg+xml", nil, http.StatusUnsupportedMediaType},
+		{"DeclaredTypeMismatch", "dm-1", gif, "image/png", nil, http.StatusUnsupportedMediaType},
+		{"TooLarge", "dm-1", bytes.Repeat([]byte{0}, 5000), "image/png", nil, http.StatusRequestEntityTooLarge},
+		{"TooWide", "dm-1", nil, "image/png", nil, http.StatusUnprocessableEntity},
+		{"TooManyPixels", "dm-1", nil, "image/png", nil, http.StatusUnprocessableEntity},
+		{"Corrupt", "dm-1", []byte("\x89PNG\r\n\x1a\n broken"), "image/png", nil, http.StatusBadRequest},
+		{"InvalidKind", "dm-1", gif, "image/gif", map[string]string{"kind": "portrait"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+			store := useImageStore(t, ImageOptions{MaxSize: 4096, MaxDimension: 100, MaxPixels: 5000, ThumbnailSize: 64})
+
+			mock.ExpectQuery(ownedBeastQuery).WithArgs("Owlbear", tt.subject, pgxmock.AnyArg()).
+				WillReturnRows(mock.NewRows(beastRowColumns).
+					AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "dm-1", "public", "", 13, "7d10+21", "", "", "", []string{}, "", 0))
+
+			data := tt.data
+			switch tt.name {
+			case "TooWide":
+				data = testPNG(t, 101, 1)
+			case "TooManyPixels":
+				data = testPNG(t, 80, 80)
+			}
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: tt.subject, Roles: []string{RoleEditor}}))
+			router.POST("/beasts/:key/images", UploadImage)
+
+			body, contentType := multipartImage(t, data, tt.contentType, tt.fields)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/beasts/Owlbear/images", body)
+			req.Header.Set("Content-Type", contentType)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code, w.Body.String())
+			assert.Empty(t, store.keys(t))
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestUploadImage_NotConfigured(t *testing.T) {
+	SetImageStore(nil, ImageOptions{})
+
+	router := gin.Default()
+	router.POST("/beasts/:key/images", UploadImage)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/beasts/Owlbear/images", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestServeImage(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		query       string
+		stored      bool
+		code        int
+		contentType string
+	}{
+		{"Original", "/images/7", "SELECT key, content_type FROM beast_images JOIN beasts USING (beast_name) WHERE id = $1 AND deleted_at IS NULL AND visibility = 'public'",
+			true, http.StatusOK, "image/jpeg"},
+		{"Thumbnail", "/images/7/thumbnail", "SELECT thumbnail_key, 'image/png' FROM beast_images", true, http.StatusOK, "image/png"},
+		{"MissingFile", "/images/7", "SELECT key, content_type FROM beast_images", false, http.StatusNotFound, ""},
+		{"NotVisible", "/images/7", "SELECT key, content_type FROM beast_images", false, http.StatusNotFound, ""},
+		{"InvalidID", "/images/owlbear", "", false, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			store := useImageStore(t, imageOptions)
+
+			if tt.stored {
+				require.NoError(t, store.Put(context.Background(), "beasts/a.jpg", strings.NewReader("jpeg bytes")))
+				require.NoError(t, store.Put(context.Background(), "beasts/a_thumbnail.png", strings.NewReader("png bytes")))
+			}
+			if tt.name == "NotVisible" {
+				mock.ExpectQuery(regexp.QuoteMeta(tt.query)).WithArgs(int64(7)).WillReturnRows(mock.NewRows([]string{"key", "content_type"}))
+			} else if tt.query != "" {
+				key := "beasts/a.jpg"
+				if tt.name == "Thumbnail" {
+					key = "beasts/a_thumbnail.png"
+				}
+				mock.ExpectQuery(regexp.QuoteMeta(tt.query)).WithArgs(int64(7)).
+					WillReturnRows(mock.NewRows([]string{"key", "content_type"}).AddRow(key, tt.contentType))
+			}
+
+			router := gin.Default()
+			router.GET("/images/:id", ServeImage)
+			router.GET("/images/:id/thumbnail", ServeThumbnail)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+				assert.Equal(t, "private, max-age=86400", w.Header().Get("Cache-Control"))
+				if tt.name == "Thumbnail" {
+					assert.Equal(t, "png bytes", w.Body.String())
+				} else {
+					assert.Equal(t, "jpeg bytes", w.Body.String())
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestDeleteImage(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	store := useImageStore(t, imageOptions)
+	require.NoError(t, store.Put(context.Background(), "beasts/a.png", strings.NewReader("png bytes")))
+	require.NoError(t, store.Put(context.Background(), "beasts/a_thumbnail.png", strings.NewReader("png bytes")))
+
+	// The image is deleted the first time and gone the second
+	for _, rows := range []*pgxmock.Rows{
+		mock.NewRows([]string{"key", "thumbnail_key"}).AddRow("beasts/a.png", "beasts/a_thumbnail.png"),
+		mock.NewRows([]string{"key", "thumbnail_key"}),
+	} {
+		mock.ExpectQuery(ownedBeastQuery).WithArgs("Owlbear", "dm-1", pgxmock.AnyArg()).
+			WillReturnRows(mock.NewRows(beastRowColumns).
+				AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "dm-1", "public", "", 13, "7d10+21", "", "", "", []string{}, "", 0))
+		mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM beast_images WHERE id = $1 AND beast_name = $2 RETURNING key, thumbnail_key")).
+			WithArgs(int64(7), "Owlbear").
+			WillReturnRows(rows)
+	}
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.DELETE("/beasts/:key/images/:id", DeleteImage)
+
+	for _, code := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/beasts/Owlbear/images/7", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code)
+	}
+	assert.Empty(t, store.keys(t))
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetItem_Images(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(beastQuery).WithArgs("Owlbear").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "", "public", "", 13, "7d10+21", "", "", "", []string{}, "", 0))
+	mock.ExpectQuery(imageQuery).WithArgs("Owlbear").
+		WillReturnRows(mock.NewRows(imageRowColumns).AddRow(int64(7), ImageArtwork, "image/jpeg", 800, 600, int64(48213), "dm-1", created))
+
+	router := gin.Default()
+	router.GET("/beasts/:key", GetItem)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Owlbear", nil)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var beast Beast
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &beast))
+	require.Len(t, beast.Images, 1)
+	assert.Equal(t, "/images/7", beast.Images[0].URL)
+	assert.Equal(t, "/images/7/thumbnail", beast.Images[0].ThumbnailURL)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/keremenci/bestiary-crud/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedPool times every statement run through the pool and traces it as a child span of the request
+type instrumentedPool struct {
+	DBPool
+}
+
+// instrumentPool wraps a pool so its statements are measured by operation
+func instrumentPool(pool DBPool) DBPool {
+	return instrumentedPool{pool}
+}
+
+func (p instrumentedPool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	s := startStatement(ctx, sql)
+	tag, err := p.DBPool.Exec(s.ctx, sql, args...)
+	s.end(err)
+	return tag, err
+}
+
+func (p instrumentedPool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	s := startStatement(ctx, sql)
+	rows, err := p.DBPool.Query(s.ctx, sql, args...)
+	return instrumentRows(rows, err, s)
+}
+
+func (p instrumentedPool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	s := startStatement(ctx, sql)
+	return instrumentedRow{Row: p.DBPool.QueryRow(s.ctx, sql, args...), stmt: s}
+}
+
+func (p instrumentedPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := p.DBPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return instrumentedTx{tx}, nil
+}
+
+// instrumentedTx measures the statements run inside a transaction like those run on the pool
+type instrumentedTx struct {
+	pgx.Tx
+}
+
+func (t instrumentedTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	s := startStatement(ctx, sql)
+	tag, err := t.Tx.Exec(s.ctx, sql, args...)
+	s.end(err)
+	return tag, err
+}
+
+func (t instrumentedTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	s := startStatement(ctx, sql)
+	rows, err := t.Tx.Query(s.ctx, sql, args...)
+	return instrumentRows(rows, err, s)
+}
+
+func (t instrumentedTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	s := startStatement(ctx, sql)
+	return instrumentedRow{Row: t.Tx.QueryRow(s.ctx, sql, args...), stmt: s}
+}
+
+// instrumentedRow defers the end of the statement to Scan, where QueryRow reports its errors
+type instrumentedRow struct {
+	pgx.Row
+	stmt statement
+}
+
+func (r instrumentedRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	r.stmt.end(err)
+	return err
+}
+
+// instrumentedRows defers the end of the statement until the rows have been read, so streamed
+// results are measured in full. It ends when Next runs out of rows, as pgx closes them then, or on Close.
+type instrumentedRows struct {
+	pgx.Rows
+	stmt  statement
+	ended bool
+}
+
+// instrumentRows wraps the result of a query, or ends the statement right away if it failed
+func instrumentRows(rows pgx.Rows, err error, s statement) (pgx.Rows, error) {
+	if err != nil {
+		s.end(err)
+		return rows, err
+	}
+	return &instrumentedRows{Rows: rows, stmt: s}, nil
+}
+
+func (r *instrumentedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.end()
+	return false
+}
+
+func (r *instrumentedRows) Close() {
+	r.Rows.Close()
+	r.end()
+}
+
+func (r *instrumentedRows) end() {
+	if !r.ended {
+		r.ended = true
+		r.stmt.end(r.Rows.Err())
+	}
+}
+
+// statement is a running database statement being measured
+type statement struct {
+	ctx   context.Context
+	name  string
+	span  trace.Span
+	start time.Time
+}
+
+// startStatement starts a client span named after the statement. Only the statement name is recorded,
+// never the SQL arguments.
+func startStatement(ctx context.Context, sql string) statement {
+	name := statementName(sql)
+	operation, table, _ := strings.Cut(name, " ")
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", operation),
+	}
+	if table != "" {
+		attrs = append(attrs, attribute.String("db.collection.name", table))
+	}
+
+	ctx, span := tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return statement{ctx: ctx, name: name, span: span, start: time.Now()}
+}
+
+func (s statement) end(err error) {
+	outcome := "ok"
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		outcome = "error"
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, "query failed")
+	}
+	metrics.QueryDuration.WithLabelValues(s.name, outcome).Observe(time.Since(s.start).Seconds())
+	s.span.End()
+}
+
+// statementName names a statement by its verb and main table, e.g. "select beasts", so statements can be
+// grouped without exposing their arguments
+func statementName(sql string) string {
+	fields := strings.Fields(strings.ToLower(sql))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+
+	verb := fields[0]
+	var marker string
+	switch verb {
+	case "select", "delete":
+		marker = "from"
+	case "insert":
+		marker = "into"
+	case "update":
+		return verb + " " + tableName(fields, 1)
+	default:
+		return verb
+	}
+	// Skip the tables of subqueries, as in "SELECT ARRAY(SELECT tag FROM beast_tags ...) FROM beasts"
+	depth := 0
+	for i, f := range fields {
+		if f == marker && depth == 0 {
+			return verb + " " + tableName(fields, i+1)
+		}
+		depth += strings.Count(f, "(") - strings.Count(f, ")")
+	}
+	return verb
+}
+
+func tableName(fields []string, i int) string {
+	if i >= len(fields) {
+		return "unknown"
+	}
+	return strings.Trim(fields[i], `"(;`)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key holding the request ID
+const requestIDKey = "request_id"
+
+type requestIDContextKey struct{}
+
+// Logger used by the handlers
+var logger = slog.Default()
+
+// Function to set the logger variable
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// RequestID assigns each request an ID, reusing a well-formed incoming X-Request-ID, and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextKey{}, id))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs of printable ASCII up to 128 characters so they are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFromContext returns the request ID stored by RequestID, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// RequestLogger logs one line per request once it has been handled
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		requestLogger(c).LogAttrs(c.Request.Context(), level, "Request handled",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		)
+	}
+}
+
+// Recovery turns panics into 500 responses and logs them with the request ID
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		requestLogger(c).Error("Panic while handling request", "panic", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		c.Abort()
+	})
+}
+
+// requestLogger returns the logger annotated with the request ID and, when traced, the trace ID
+func requestLogger(c *gin.Context) *slog.Logger {
+	l := logger
+	if id := c.GetString(requestIDKey); id != "" {
+		l = l.With(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+		l = l.With(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return l
+}
+
+// respondError writes a JSON error response carrying the request ID
+func respondError(c *gin.Context, status int, msg string) {
+	body := gin.H{"error": msg}
+	if id := c.GetString(requestIDKey); id != "" {
+		body["request_id"] = id
+	}
+	c.JSON(status, body)
+}
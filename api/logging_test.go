@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, RequestIDFromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{"Generated", "", false},
+		{"Honored", "req-7f3a9c", true},
+		{"TooLong", string(bytes.Repeat([]byte("a"), 129)), false},
+		{"ControlCharacters", "abc\tdef", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set(RequestIDHeader, tt.incoming)
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			assert.Equal(t, id, w.Body.String())
+			if tt.reused {
+				assert.Equal(t, tt.incoming, id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+		})
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer SetLogger(slog.Default())
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	mock.ExpectQuery("SELECT").WillReturnError(errors.New("connection reset by peer"))
+
+	router := gin.New()
+	router.Use(RequestID(), RequestLogger(), Recovery())
+	router.GET("/beasts", ListItems)
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	// Failed queries are logged with the request ID, which is returned to the client
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Internal server error","request_id":"req-42"}`, w.Body.String())
+
+	lines := logLines(t, &buf)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "Error querying database", lines[0]["msg"])
+		assert.Equal(t, "connection reset by peer", lines[0]["err"])
+		assert.Equal(t, "req-42", lines[0]["request_id"])
+
+		assert.Equal(t, "Request handled", lines[1]["msg"])
+		assert.Equal(t, "ERROR", lines[1]["level"])
+		assert.Equal(t, "/beasts", lines[1]["route"])
+		assert.Equal(t, float64(500), lines[1]["status"])
+		assert.Equal(t, "req-42", lines[1]["request_id"])
+	}
+
+	// Panics are recovered and logged the same way
+	buf.Reset()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	lines = logLines(t, &buf)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "Panic while handling request", lines[0]["msg"])
+		assert.Equal(t, w.Header().Get(RequestIDHeader), lines[0]["request_id"])
+	}
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Log line is not JSON: %s", scanner.Text())
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics records the count and latency of requests by route template
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+var beastsDesc = prometheus.NewDesc("bestiary_beasts", "Beasts in the bestiary, by type.", []string{"type"}, nil)
+
+// beastCollector counts beasts by type on every scrape, leaving out those in the trash
+type beastCollector struct{}
+
+// BeastCollector returns a Prometheus collector exporting the number of beasts by type
+func BeastCollector() prometheus.Collector {
+	return beastCollector{}
+}
+
+func (beastCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- beastsDesc
+}
+
+func (beastCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := dbPool.Query(ctx, "SELECT type, count(*) FROM beasts WHERE deleted_at IS NULL GROUP BY type")
+	if err != nil {
+		logger.Error("Error counting beasts for metrics", "err", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var beastType string
+		var count int64
+		if err := rows.Scan(&beastType, &count); err != nil {
+			logger.Error("Error counting beasts for metrics", "err", err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(beastsDesc, prometheus.GaugeValue, float64(count), beastType)
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/metrics"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleCount returns the number of observations of a histogram series
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := observer.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("Unable to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetrics(t *testing.T) {
+	router := gin.New()
+	router.Use(Metrics())
+	router.GET("/beasts/:key", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	ok := metrics.HTTPRequests.WithLabelValues("GET", "/beasts/:key", "200")
+	unmatched := metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404")
+	okBefore, unmatchedBefore := testutil.ToFloat64(ok), testutil.ToFloat64(unmatched)
+	latencyBefore := sampleCount(t, metrics.HTTPDuration.WithLabelValues("GET", "/beasts/:key"))
+
+	for _, path := range []string{"/beasts/Owlbear", "/beasts/Mimic", "/nowhere"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+	}
+
+	// Requests are grouped by route template rather than path
+	assert.Equal(t, okBefore+2, testutil.ToFloat64(ok))
+	assert.Equal(t, unmatchedBefore+1, testutil.ToFloat64(unmatched))
+	assert.Equal(t, latencyBefore+2, sampleCount(t, metrics.HTTPDuration.WithLabelValues("GET", "/beasts/:key")))
+}
+
+func TestInstrumentPool(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	pool := instrumentPool(mock)
+
+	mock.ExpectQuery("SELECT").WithArgs("Owlbear").WillReturnRows(mock.NewRows([]string{"cr"}).AddRow("3"))
+	mock.ExpectExec("DELETE FROM beasts").WithArgs("Owlbear").WillReturnError(errors.New("connection reset"))
+	mock.ExpectQuery("SELECT").WillReturnRows(mock.NewRows([]string{"beast_name"}).AddRow("Mimic").AddRow("Owlbear"))
+
+	selectOK := metrics.QueryDuration.WithLabelValues("select beasts", "ok")
+	deleteErr := metrics.QueryDuration.WithLabelValues("delete beasts", "error")
+	selectBefore, deleteBefore := sampleCount(t, selectOK), sampleCount(t, deleteErr)
+
+	var cr string
+	assert.NoError(t, pool.QueryRow(context.Background(), "SELECT cr FROM beasts WHERE beast_name=$1", "Owlbear").Scan(&cr))
+	_, err = pool.Exec(context.Background(), "DELETE FROM beasts WHERE beast_name=$1", "Owlbear")
+	assert.Error(t, err)
+
+	assert.Equal(t, selectBefore+1, sampleCount(t, selectOK))
+	assert.Equal(t, deleteBefore+1, sampleCount(t, deleteErr))
+
+	// Queries are measured until their rows have been read
+	rows, err := pool.Query(context.Background(), "SELECT beast_name FROM beasts")
+	assert.NoError(t, err)
+	assert.True(t, rows.Next())
+	assert.Equal(t, selectBefore+1, sampleCount(t, selectOK))
+	rows.Close()
+	rows.Close()
+	assert.Equal(t, selectBefore+2, sampleCount(t, selectOK))
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStatementName(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT " + beastColumns + " FROM beasts WHERE beast_name=$1", "select beasts"},
+		{"\n\t\tINSERT INTO beasts (beast_name, type) \n\t\tVALUES ($1, $2)", "insert beasts"},
+		{"UPDATE beasts SET type=$1 WHERE beast_name=$2", "update beasts"},
+		{"DELETE FROM beasts WHERE beast_name=$1", "delete beasts"},
+		{"SELECT 1", "select"},
+		{"BEGIN", "begin"},
+		{"", "unknown"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, statementName(tt.sql), tt.sql)
+	}
+}
+
+func TestBeastCollector(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	// Beasts in the trash are not counted, so a trashed Monstrosity leaves two of them
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT type, count(*) FROM beasts WHERE deleted_at IS NULL GROUP BY type")).
+		WillReturnRows(mock.NewRows([]string{"type", "count"}).
+			AddRow("Monstrosity", int64(2)).
+			AddRow("Aberration (Mind Flayer)", int64(2)))
+
+	expected := `
+# HELP bestiary_beasts Beasts in the bestiary, by type.
+# TYPE bestiary_beasts gauge
+bestiary_beasts{type="Aberration (Mind Flayer)"} 2
+bestiary_beasts{type="Monstrosity"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(BeastCollector(), strings.NewReader(expected)))
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/keremenci/bestiary-crud/auth"
+)
+
+// visibilityFilter returns a SQL condition restricting beasts to the ones the principal may see.
+// Its placeholders are numbered after the first n arguments of the surrounding query.
+func visibilityFilter(p *auth.Principal, n int) (string, []interface{}) {
+	if policy.Allows(p, ActionViewAnyBeast) {
+		return "TRUE", nil
+	}
+	if p == nil {
+		return "visibility = 'public'", nil
+	}
+	return fmt.Sprintf("(visibility = 'public' OR owner = $%d OR (visibility = 'campaign' AND campaign = ANY($%d)))", n+1, n+2),
+		[]interface{}{p.Subject, p.Campaigns}
+}
+
+// canSee reports whether the principal may see the beast. It is the in-memory counterpart of
+// visibilityFilter, for beasts that did not come from a filtered query.
+func canSee(p *auth.Principal, beast *Beast) bool {
+	if policy.Allows(p, ActionViewAnyBeast) {
+		return true
+	}
+	switch beast.Visibility {
+	case "", VisibilityPublic:
+		return true
+	}
+	if p == nil {
+		return false
+	}
+	if beast.Owner != "" && beast.Owner == p.Subject {
+		return true
+	}
+	if beast.Visibility == VisibilityCampaign {
+		for _, c := range p.Campaigns {
+			if c == beast.Campaign {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canModify reports whether the principal may update or delete a beast with the given owner.
+// anyAction is the action that allows modifying beasts of other users, which is also required
+// for beasts without an owner.
+func canModify(p *auth.Principal, owner, anyAction string) bool {
+	if policy.Allows(p, anyAction) {
+		return true
+	}
+	return p != nil && owner != "" && owner == p.Subject
+}
+
+// normalizeVisibility defaults the visibility to public and checks that it is consistent with the campaign
+func normalizeVisibility(beast *Beast) error {
+	switch beast.Visibility {
+	case "":
+		beast.Visibility = VisibilityPublic
+		beast.Campaign = ""
+	case VisibilityPrivate, VisibilityPublic:
+		beast.Campaign = ""
+	case VisibilityCampaign:
+		if beast.Campaign == "" {
+			return errors.New("Campaign visibility requires a campaign")
+		}
+	default:
+		return fmt.Errorf("Invalid visibility %q", beast.Visibility)
+	}
+	return nil
+}
+
+// canShareWith reports whether the principal may share a beast with the given campaign
+func canShareWith(p *auth.Principal, campaign string) bool {
+	if campaign == "" || p.HasRole(RoleAdmin) {
+		return true
+	}
+	if p == nil {
+		return false
+	}
+	for _, c := range p.Campaigns {
+		if c == campaign {
+			return true
+		}
+	}
+	return false
+}
+
+// nullIfEmpty maps empty strings to SQL NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
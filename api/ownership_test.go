@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListItems_VisibleToPrincipal(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	principal := &auth.Principal{Subject: "dm-1", Roles: []string{"editor"}, Campaigns: []string{"curse-of-strahd"}}
+	rows := mock.NewRows(beastRowColumns).
+		AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "", "public", "", 0, "", "", "", "", []string{}, "", 0).
+		AddRow("Strahd's Hound", "Beast", "1", map[string]string{}, "", "dm-2", "campaign", "curse-of-strahd", 0, "", "", "", "", []string{}, "", 0).
+		AddRow("Gloomwing", "Monstrosity", "4", map[string]string{}, "", "dm-1", "private", "", 0, "", "", "", "", []string{}, "", 0)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE deleted_at IS NULL AND (visibility = 'public' OR owner = $1 OR (visibility = 'campaign' AND campaign = ANY($2)))")).
+		WithArgs("dm-1", []string{"curse-of-strahd"}).
+		WillReturnRows(rows)
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(principal))
+	router.GET("/beasts", ListItems)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var beasts []Beast
+	if err := json.Unmarshal(w.Body.Bytes(), &beasts); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	assert.Len(t, beasts, 3)
+	assert.Equal(t, "curse-of-strahd", beasts[1].Campaign)
+	assert.Equal(t, "private", beasts[2].Visibility)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetItem_AdminSeesEverything(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND TRUE")).
+		WithArgs("Gloomwing").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Gloomwing", "Monstrosity", "4", map[string]string{}, "", "dm-1", "private", "", 0, "", "", "", "", []string{}, "", 0))
+	mock.ExpectQuery(imageQuery).WithArgs("Gloomwing").WillReturnRows(mock.NewRows(imageRowColumns))
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "admin-1", Roles: []string{"admin"}}))
+	router.GET("/beasts/:key", GetItem)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Gloomwing", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestModify_RequiresOwner(t *testing.T) {
+	update, _ := json.Marshal(Beast{Type: "Monstrosity", CR: "5"})
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		method    string
+		owner     string
+		code      int
+	}{
+		{"UpdateByOtherUser", &auth.Principal{Subject: "dm-2", Roles: []string{"editor"}}, "PUT", "dm-1", http.StatusForbidden},
+		{"DeleteByOtherUser", &auth.Principal{Subject: "dm-2", Roles: []string{"editor"}}, "DELETE", "dm-1", http.StatusForbidden},
+		{"UpdateGlobalBeast", &auth.Principal{Subject: "dm-1", Roles: []string{"editor"}}, "PUT", "", http.StatusForbidden},
+		{"DeleteAnonymous", nil, "DELETE", "dm-1", http.StatusForbidden},
+		{"UpdateByOwner", &auth.Principal{Subject: "dm-1", Roles: []string{"editor"}}, "PUT", "dm-1", http.StatusOK},
+		{"DeleteByAdmin", &auth.Principal{Subject: "admin-1", Roles: []string{"admin"}}, "DELETE", "dm-1", http.StatusOK},
+		{"UpdateByModerator", &auth.Principal{Subject: "mod-1", Roles: []string{"moderator"}}, "PUT", "dm-1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(lockQuery).WithArgs("Gloomwing").
+				WillReturnRows(mock.NewRows(beastRowColumns).
+					AddRow("Gloomwing", "Monstrosity", "4", map[string]string{}, "", tt.owner, "private", "", 0, "", "", "", "", []string{}, "", 0))
+			if tt.code != http.StatusOK {
+				mock.ExpectRollback()
+			} else {
+				action := AuditDelete
+				if tt.method == "PUT" {
+					action = AuditUpdate
+					mock.ExpectExec("UPDATE beasts").
+						WithArgs("Monstrosity", "5", map[string]string(nil), "", "private", nil, 0, "", "", "", "", nil, 0, "Gloomwing").
+						WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				} else {
+					mock.ExpectQuery(encounterUsesQuery).WithArgs("Gloomwing").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+					mock.ExpectExec("UPDATE beasts SET deleted_at").WithArgs("Gloomwing").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				}
+				mock.ExpectExec(auditInsert).
+					WithArgs("Gloomwing", tt.principal.Subject, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), nil).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				if tt.method == "PUT" {
+					mock.ExpectExec(revisionInsert).
+						WithArgs("Gloomwing", pgxmock.AnyArg(), tt.principal.Subject, nil).
+						WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				}
+				mock.ExpectExec(eventInsert).
+					WithArgs("Gloomwing", action, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			}
+
+			router := gin.Default()
+			if tt.principal != nil {
+				router.Use(AssumePrincipal(tt.principal))
+			}
+			router.PUT("/beasts/:key", UpdateItem)
+			router.DELETE("/beasts/:key", DeleteItem)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/beasts/Gloomwing", bytes.NewBuffer(update))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPutItem_Visibility(t *testing.T) {
+	principal := &auth.Principal{Subject: "dm-1", Roles: []string{"editor"}, Campaigns: []string{"curse-of-strahd"}}
+
+	tests := []struct {
+		name  string
+		beast Beast
+		code  int
+	}{
+		{"InvalidVisibility", Beast{BeastName: "Gloomwing", Visibility: "secret"}, http.StatusBadRequest},
+		{"CampaignMissing", Beast{BeastName: "Gloomwing", Visibility: "campaign"}, http.StatusBadRequest},
+		{"NotAMember", Beast{BeastName: "Gloomwing", Visibility: "campaign", Campaign: "tomb-of-annihilation"}, http.StatusForbidden},
+		{"SharedWithCampaign", Beast{BeastName: "Gloomwing", Visibility: "campaign", Campaign: "curse-of-strahd"}, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+
+			if tt.code == http.StatusCreated {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO beasts").
+					WithArgs("Gloomwing", "", "", map[string]string(nil), "", "dm-1", "campaign", "curse-of-strahd", 0, "", "", "", "", nil, 0).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(auditInsert).
+					WithArgs("Gloomwing", "dm-1", AuditCreate, []byte(nil), pgxmock.AnyArg(), nil).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(revisionInsert).
+					WithArgs("Gloomwing", pgxmock.AnyArg(), "dm-1", nil).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(eventInsert).
+					WithArgs("Gloomwing", AuditCreate, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(principal))
+			router.POST("/beasts", PutItem)
+
+			body, _ := json.Marshal(tt.beast)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/beasts", bytes.NewBuffer(body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusForbidden {
+				assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCanSee(t *testing.T) {
+	owner := &auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}
+	player := &auth.Principal{Subject: "player-1", Roles: []string{RoleViewer}, Campaigns: []string{"curse-of-strahd"}}
+	moderator := &auth.Principal{Subject: "mod-1", Roles: []string{RoleModerator}}
+
+	public := &Beast{Owner: "dm-1", Visibility: VisibilityPublic}
+	private := &Beast{Owner: "dm-1", Visibility: VisibilityPrivate}
+	shared := &Beast{Owner: "dm-1", Visibility: VisibilityCampaign, Campaign: "curse-of-strahd"}
+
+	assert.True(t, canSee(nil, public))
+	assert.False(t, canSee(nil, private))
+	assert.True(t, canSee(owner, private))
+	assert.False(t, canSee(player, private))
+	assert.True(t, canSee(player, shared))
+	assert.False(t, canSee(&auth.Principal{Subject: "player-2"}, shared))
+	assert.True(t, canSee(moderator, private))
+}
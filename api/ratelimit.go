@@ -0,0 +1,74 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/ratelimit"
+)
+
+// APIKeyHeader is the request header identifying API key clients for rate limiting
+var APIKeyHeader = "X-API-Key"
+
+// apiKeys holds the hex SHA-256 digests of the issued API keys
+var apiKeys = map[string]bool{}
+
+// SetAPIKeys sets the issued API keys, given as hex SHA-256 digests so the keys themselves are not configured in plain text
+func SetAPIKeys(digests []string) {
+	apiKeys = make(map[string]bool, len(digests))
+	for _, d := range digests {
+		apiKeys[strings.ToLower(d)] = true
+	}
+}
+
+// RateLimit limits each client to the given token bucket within a route group.
+// Clients are identified by their API key if they send an issued one, otherwise by IP address,
+// which gin resolves from X-Forwarded-For when the request comes through a trusted proxy.
+// A zero limit disables rate limiting for the group.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit.Rate <= 0 || limit.Burst <= 0 {
+			c.Next()
+			return
+		}
+
+		res, err := store.Take(c.Request.Context(), group+":"+clientIdentity(c), limit)
+		if err != nil {
+			// Fail open, an unavailable store should not take the API down with it
+			requestLogger(c).Error("Error checking rate limit", "err", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset.Seconds())))
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter.Seconds())))
+			abortWithProblem(c, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientIdentity returns the rate limiting key of the caller. Unknown API keys are ignored, so that
+// made up keys don't get fresh buckets; known ones are hashed so they don't end up in the store in plain text.
+func clientIdentity(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		if digest := hex.EncodeToString(sum[:]); apiKeys[digest] {
+			return "key:" + digest[:32]
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
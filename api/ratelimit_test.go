@@ -0,0 +1,97 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	sum := sha256.Sum256([]byte("secret-key"))
+	SetAPIKeys([]string{hex.EncodeToString(sum[:])})
+	defer SetAPIKeys(nil)
+
+	router := gin.Default()
+	router.SetTrustedProxies([]string{"127.0.0.1"})
+	router.POST("/beasts", RateLimit(store, "write", ratelimit.Limit{Rate: 0.1, Burst: 2}), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	router.GET("/beasts", RateLimit(store, "read", ratelimit.Limit{}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(method, forwardedFor, apiKey string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/beasts", nil)
+		req.RemoteAddr = "127.0.0.1:41234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "203.0.113.7", "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusCreated, send("POST", "203.0.113.7", "").Code)
+
+	w = send("POST", "203.0.113.7", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	// The client behind the proxy is identified by X-Forwarded-For, not the proxy address
+	assert.Equal(t, http.StatusCreated, send("POST", "198.51.100.20", "").Code)
+
+	// API key clients get their own bucket regardless of address
+	assert.Equal(t, http.StatusCreated, send("POST", "203.0.113.7", "secret-key").Code)
+	assert.Equal(t, http.StatusCreated, send("POST", "203.0.113.7", "secret-key").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("POST", "198.51.100.20", "secret-key").Code)
+
+	// Keys that weren't issued are limited by address like everyone else
+	assert.Equal(t, http.StatusTooManyRequests, send("POST", "203.0.113.7", "bogus-key-1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("POST", "203.0.113.7", "bogus-key-2").Code)
+
+	// Groups without a limit are not limited
+	w = send("GET", "203.0.113.7", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_UntrustedProxy(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+
+	router := gin.Default()
+	router.SetTrustedProxies(nil)
+	router.POST("/beasts", RateLimit(store, "write", ratelimit.Limit{Rate: 0.1, Burst: 1}), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	// Spoofed X-Forwarded-For headers from untrusted peers do not give out new buckets
+	for i, forwardedFor := range []string{"203.0.113.7", "203.0.113.8"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/beasts", nil)
+		req.RemoteAddr = "192.0.2.1:41234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		router.ServeHTTP(w, req)
+
+		if i == 0 {
+			assert.Equal(t, http.StatusCreated, w.Code)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		}
+	}
+}
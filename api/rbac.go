@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+)
+
+// Roles, from least to most privileged. Every caller has the anonymous role, authenticated or not.
+const (
+	RoleAnonymous = "anonymous"
+	RoleViewer    = "viewer"
+	RoleEditor    = "editor"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Actions that can be granted to roles in a Policy
+const (
+	ActionListBeasts        = "beasts:list"
+	ActionGetBeast          = "beasts:get"
+	ActionCreateBeast       = "beasts:create"
+	ActionUpdateBeast       = "beasts:update"
+	ActionDeleteBeast       = "beasts:delete"
+	ActionViewAnyBeast      = "beasts:view_any"   // see private and campaign beasts of other users
+	ActionUpdateAnyBeast    = "beasts:update_any" // update beasts owned by someone else
+	ActionDeleteAnyBeast    = "beasts:delete_any" // delete beasts owned by someone else
+	ActionReadAudit         = "audit:read"
+	ActionManageWebhooks    = "webhooks:manage"
+	ActionReadCampaigns     = "campaigns:read"       // see campaigns and their saved encounters
+	ActionWriteCampaigns    = "campaigns:write"      // create campaigns and save encounters in them
+	ActionViewAnyCampaign   = "campaigns:view_any"   // see campaigns of other users and their encounters
+	ActionUpdateAnyCampaign = "campaigns:update_any" // change campaigns of other users and their encounters
+	ActionDeleteAnyCampaign = "campaigns:delete_any" // delete campaigns of other users
+	ActionRunCombats        = "combats:run"          // run combat sessions of their own
+	ActionRunAnyCombat      = "combats:run_any"      // see and run combat sessions of other users
+	ActionManageTags        = "tags:manage"          // create, rename and delete tags shared by all beasts
+	ActionManageSources     = "sources:manage"       // create, change and delete the sources beasts refer to
+)
+
+var knownRoles = []string{RoleAnonymous, RoleViewer, RoleEditor, RoleModerator, RoleAdmin}
+
+// Policy maps each action to the roles allowed to perform it. Admins may perform every action.
+type Policy map[string][]string
+
+// DefaultPolicy returns the built-in policy: everyone can read public beasts, editors manage their own
+// beasts and moderators manage everyone's and read the audit log. Only admins manage webhooks, which
+// receive every change including those to private beasts.
+func DefaultPolicy() Policy {
+	return Policy{
+		ActionListBeasts:        {RoleAnonymous},
+		ActionGetBeast:          {RoleAnonymous},
+		ActionCreateBeast:       {RoleEditor, RoleModerator},
+		ActionUpdateBeast:       {RoleEditor, RoleModerator},
+		ActionDeleteBeast:       {RoleEditor, RoleModerator},
+		ActionViewAnyBeast:      {RoleModerator},
+		ActionUpdateAnyBeast:    {RoleModerator},
+		ActionDeleteAnyBeast:    {RoleModerator},
+		ActionReadAudit:         {RoleModerator},
+		ActionManageWebhooks:    {},
+		ActionReadCampaigns:     {RoleViewer, RoleEditor, RoleModerator},
+		ActionWriteCampaigns:    {RoleEditor, RoleModerator},
+		ActionViewAnyCampaign:   {RoleModerator},
+		ActionUpdateAnyCampaign: {RoleModerator},
+		ActionDeleteAnyCampaign: {RoleModerator},
+		ActionRunCombats:        {RoleEditor, RoleModerator},
+		ActionRunAnyCombat:      {RoleModerator},
+		ActionManageTags:        {RoleModerator},
+		ActionManageSources:     {RoleModerator},
+	}
+}
+
+// With returns a copy of the policy with the role lists of the given actions replaced.
+// Unknown actions or roles are rejected so typos in the config do not silently open or close routes.
+func (p Policy) With(overrides map[string][]string) (Policy, error) {
+	merged := make(Policy, len(p))
+	for action, roles := range p {
+		merged[action] = roles
+	}
+	for action, roles := range overrides {
+		if _, ok := p[action]; !ok {
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+		for _, role := range roles {
+			if !isKnownRole(role) {
+				return nil, fmt.Errorf("unknown role %q for action %q", role, action)
+			}
+		}
+		merged[action] = roles
+	}
+	return merged, nil
+}
+
+// Allows reports whether the principal may perform the action
+func (p Policy) Allows(principal *auth.Principal, action string) bool {
+	if principal.HasRole(RoleAdmin) {
+		return true
+	}
+	for _, role := range p[action] {
+		if role == RoleAnonymous || principal.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownRole(role string) bool {
+	for _, r := range knownRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Access control policy in effect
+var policy = DefaultPolicy()
+
+// Function to set the policy variable
+func SetPolicy(p Policy) {
+	policy = p
+}
+
+// Authorize rejects requests whose principal is not allowed to perform the action.
+// Anonymous callers get a 401 so they know to authenticate, everyone else a 403.
+func Authorize(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authorized(c, action) {
+			c.Next()
+		}
+	}
+}
+
+// authorized reports whether the caller may perform the action, aborting with a 401 or 403 if not.
+// Handlers use it for actions that depend on the request, such as saving a scaled beast.
+func authorized(c *gin.Context, action string) bool {
+	principal := CurrentPrincipal(c)
+	if policy.Allows(principal, action) {
+		return true
+	}
+
+	if principal == nil {
+		c.Header("WWW-Authenticate", "Bearer")
+		abortWithProblem(c, http.StatusUnauthorized, "Authentication required")
+		return false
+	}
+	roles := append([]string(nil), principal.Roles...)
+	sort.Strings(roles)
+	abortWithProblem(c, http.StatusForbidden, fmt.Sprintf("Roles %v may not perform %s", roles, action))
+	return false
+}
+
+// abortWithProblem aborts the request with an RFC 7807 problem response
+func abortWithProblem(c *gin.Context, status int, detail string) {
+	body := gin.H{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	}
+	if id := c.GetString(requestIDKey); id != "" {
+		body["request_id"] = id
+	}
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(status, body)
+}
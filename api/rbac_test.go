@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAuthorize_RoleMatrix checks every role against every route under the default policy
+func TestAuthorize_RoleMatrix(t *testing.T) {
+	SetPolicy(DefaultPolicy())
+
+	routes := []struct {
+		method  string
+		pattern string
+		path    string
+		action  string
+	}{
+		{"GET", "/beasts", "/beasts", ActionListBeasts},
+		{"GET", "/beasts/:key", "/beasts/Owlbear", ActionGetBeast},
+		{"POST", "/beasts", "/beasts", ActionCreateBeast},
+		{"PUT", "/beasts/:key", "/beasts/Owlbear", ActionUpdateBeast},
+		{"DELETE", "/beasts/:key", "/beasts/Owlbear", ActionDeleteBeast},
+		{"GET", "/audit", "/audit", ActionReadAudit},
+		{"POST", "/webhooks", "/webhooks", ActionManageWebhooks},
+		{"GET", "/campaigns", "/campaigns", ActionReadCampaigns},
+		{"POST", "/campaigns", "/campaigns", ActionWriteCampaigns},
+		{"POST", "/combats", "/combats", ActionRunCombats},
+		{"POST", "/tags", "/tags", ActionManageTags},
+	}
+
+	// Expected status per role, in route order
+	matrix := map[string][]int{
+		RoleAnonymous: {200, 200, 401, 401, 401, 401, 401, 401, 401, 401, 401},
+		RoleViewer:    {200, 200, 403, 403, 403, 403, 403, 200, 403, 403, 403},
+		RoleEditor:    {200, 200, 200, 200, 200, 403, 403, 200, 200, 200, 403},
+		RoleModerator: {200, 200, 200, 200, 200, 200, 403, 200, 200, 200, 200},
+		RoleAdmin:     {200, 200, 200, 200, 200, 200, 200, 200, 200, 200, 200},
+	}
+
+	for role, codes := range matrix {
+		router := gin.Default()
+		if role != RoleAnonymous {
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "user-1", Roles: []string{role}}))
+		}
+		for _, r := range routes {
+			router.Handle(r.method, r.pattern, Authorize(r.action), func(c *gin.Context) { c.Status(http.StatusOK) })
+		}
+
+		for i, r := range routes {
+			t.Run(role+" "+r.method+" "+r.pattern, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(r.method, r.path, nil)
+				router.ServeHTTP(w, req)
+				assert.Equal(t, codes[i], w.Code)
+			})
+		}
+	}
+}
+
+func TestAuthorize_ProblemResponse(t *testing.T) {
+	SetPolicy(DefaultPolicy())
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "user-1", Roles: []string{RoleViewer}}))
+	router.DELETE("/beasts/:key", Authorize(ActionDeleteBeast), DeleteItem)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/beasts/Owlbear", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var problem map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	assert.Equal(t, "Forbidden", problem["title"])
+	assert.Equal(t, float64(403), problem["status"])
+	assert.Equal(t, "Roles [viewer] may not perform beasts:delete", problem["detail"])
+}
+
+func TestPolicy_With(t *testing.T) {
+	// Configured overrides replace the role list of an action
+	p, err := DefaultPolicy().With(map[string][]string{ActionCreateBeast: {RoleViewer, RoleEditor}})
+	assert.NoError(t, err)
+	assert.True(t, p.Allows(&auth.Principal{Roles: []string{RoleViewer}}, ActionCreateBeast))
+	assert.False(t, DefaultPolicy().Allows(&auth.Principal{Roles: []string{RoleViewer}}, ActionCreateBeast))
+
+	// Reads can be restricted to signed-in users
+	p, err = DefaultPolicy().With(map[string][]string{ActionListBeasts: {RoleViewer}})
+	assert.NoError(t, err)
+	assert.False(t, p.Allows(nil, ActionListBeasts))
+	assert.True(t, p.Allows(&auth.Principal{Roles: []string{RoleViewer}}, ActionListBeasts))
+
+	// Admins cannot be locked out
+	p, err = DefaultPolicy().With(map[string][]string{ActionDeleteAnyBeast: {}})
+	assert.NoError(t, err)
+	assert.True(t, p.Allows(&auth.Principal{Roles: []string{RoleAdmin}}, ActionDeleteAnyBeast))
+
+	_, err = DefaultPolicy().With(map[string][]string{"beasts:destroy": {RoleAdmin}})
+	assert.EqualError(t, err, `unknown action "beasts:destroy"`)
+
+	_, err = DefaultPolicy().With(map[string][]string{ActionCreateBeast: {"dungeon-master"}})
+	assert.EqualError(t, err, `unknown role "dungeon-master" for action "beasts:create"`)
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Revision is a saved version of a beast. Beast is only set when a single revision is requested.
+type Revision struct {
+	Revision  int       `json:"revision"`
+	Author    string    `json:"author"`
+	RequestID string    `json:"request_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Beast     *Beast    `json:"beast,omitempty"`
+}
+
+// FieldChange is a field that differs between two revisions. Attributes are compared one by one
+// and named like "Attributes.STR"; an empty value means the field is not set.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// revisionColumns are the columns of beast_revisions r scanned into a Revision, without its data
+const revisionColumns = "r.revision, r.author, COALESCE(r.request_id, ''), r.created_at"
+
+// saveRevision stores beast as the next revision of key within the transaction changing it
+func saveRevision(c *gin.Context, tx pgx.Tx, key string, beast *Beast) error {
+	data, err := json.Marshal(beast)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(c.Request.Context(), `
+		INSERT INTO beast_revisions (beast_name, revision, data, author, request_id)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4 FROM beast_revisions WHERE beast_name = $1`,
+		key, data, actorOf(c), nullIfEmpty(c.GetString(requestIDKey)))
+	return err
+}
+
+// ListRevisions returns the revisions of a beast visible to the caller, newest first
+func ListRevisions(c *gin.Context) {
+	key := c.Param("key")
+
+	filter, args := visibilityFilter(CurrentPrincipal(c), 1)
+	rows, err := dbPool.Query(c.Request.Context(), "SELECT "+revisionColumns+
+		" FROM beast_revisions r JOIN beasts b ON b.beast_name = r.beast_name WHERE r.beast_name=$1 AND b.deleted_at IS NULL AND "+filter+
+		" ORDER BY r.revision DESC", append([]interface{}{key}, args...)...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		var rev Revision
+		if err := rows.Scan(&rev.Revision, &rev.Author, &rev.RequestID, &rev.Timestamp); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	// Every beast has at least the revision it was created with
+	if len(revisions) == 0 {
+		respondError(c, http.StatusNotFound, "Beast not found")
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetRevision returns a single revision of a beast, including the beast as it was then
+func GetRevision(c *gin.Context) {
+	n, ok := revisionParam(c, c.Param("n"))
+	if !ok {
+		return
+	}
+	rev, ok := loadRevision(c, c.Param("key"), n)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rev)
+}
+
+// DiffRevisions lists the fields that changed between the revisions given by the from and to query parameters
+func DiffRevisions(c *gin.Context) {
+	key := c.Param("key")
+	from, ok := revisionParam(c, c.Query("from"))
+	if !ok {
+		return
+	}
+	to, ok := revisionParam(c, c.Query("to"))
+	if !ok {
+		return
+	}
+
+	fromRev, ok := loadRevision(c, key, from)
+	if !ok {
+		return
+	}
+	toRev, ok := loadRevision(c, key, to)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "changes": diffBeasts(*fromRev.Beast, *toRev.Beast)})
+}
+
+// RestoreRevision rolls a beast back to a past revision. The restore is saved as a new revision,
+// so it can itself be undone.
+func RestoreRevision(c *gin.Context) {
+	key := c.Param("key")
+	n, ok := revisionParam(c, c.Param("n"))
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	current, ok := loadForUpdate(c, tx, key, ActionUpdateAnyBeast)
+	if !ok {
+		return
+	}
+
+	var data []byte
+	err = tx.QueryRow(ctx, "SELECT data FROM beast_revisions WHERE beast_name=$1 AND revision=$2", key, n).Scan(&data)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Revision not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+	var beast Beast
+	if err := json.Unmarshal(data, &beast); err != nil {
+		requestLogger(c).Error("Error decoding revision", "err", err, "revision", n)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if !saveUpdate(c, tx, key, current, beast) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Beast restored successfully", "revision": n})
+}
+
+// revisionParam parses a revision number, writing a 400 response if it is not a positive integer
+func revisionParam(c *gin.Context, raw string) (int, bool) {
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		respondError(c, http.StatusBadRequest, "Invalid revision")
+		return 0, false
+	}
+	return n, true
+}
+
+// loadRevision loads a revision of a beast visible to the caller. It writes the error response and returns
+// false if there is none.
+func loadRevision(c *gin.Context, key string, n int) (Revision, bool) {
+	var rev Revision
+	var data []byte
+
+	filter, args := visibilityFilter(CurrentPrincipal(c), 2)
+	err := dbPool.QueryRow(c.Request.Context(), "SELECT "+revisionColumns+", r.data"+
+		" FROM beast_revisions r JOIN beasts b ON b.beast_name = r.beast_name WHERE r.beast_name=$1 AND r.revision=$2 AND b.deleted_at IS NULL AND "+filter,
+		append([]interface{}{key, n}, args...)...).
+		Scan(&rev.Revision, &rev.Author, &rev.RequestID, &rev.Timestamp, &data)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Revision not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return rev, false
+	}
+
+	rev.Beast = &Beast{}
+	if err := json.Unmarshal(data, rev.Beast); err != nil {
+		requestLogger(c).Error("Error decoding revision", "err", err, "revision", n)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return rev, false
+	}
+	return rev, true
+}
+
+// diffBeasts returns the fields that differ between two versions of a beast, attributes sorted by name
+func diffBeasts(from, to Beast) []FieldChange {
+	changes := []FieldChange{}
+	compare := func(field, a, b string) {
+		if a != b {
+			changes = append(changes, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+
+	compare("Type", from.Type, to.Type)
+	compare("Subtype", from.Subtype, to.Subtype)
+	compare("Size", from.Size, to.Size)
+	compare("Alignment", from.Alignment, to.Alignment)
+	compare("CR", from.CR, to.CR)
+	compare("Description", from.Description, to.Description)
+	compare("Owner", from.Owner, to.Owner)
+	compare("Visibility", from.Visibility, to.Visibility)
+	compare("Campaign", from.Campaign, to.Campaign)
+	compare("ArmorClass", strconv.Itoa(from.ArmorClass), strconv.Itoa(to.ArmorClass))
+	compare("HitDice", from.HitDice, to.HitDice)
+	compare("Tags", strings.Join(from.Tags, ", "), strings.Join(to.Tags, ", "))
+	compare("Source", from.Source, to.Source)
+	compare("SourcePage", strconv.Itoa(from.SourcePage), strconv.Itoa(to.SourcePage))
+
+	names := map[string]bool{}
+	for name := range from.Attributes {
+		names[name] = true
+	}
+	for name := range to.Attributes {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		compare("Attributes."+name, from.Attributes[name], to.Attributes[name])
+	}
+	return changes
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var revisionRowColumns = []string{"revision", "author", "request_id", "created_at"}
+
+func TestListRevisions(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta("FROM beast_revisions r JOIN beasts b ON b.beast_name = r.beast_name WHERE r.beast_name=$1 AND b.deleted_at IS NULL AND visibility = 'public' ORDER BY r.revision DESC")
+	mock.ExpectQuery(query).WithArgs("Owlbear").
+		WillReturnRows(mock.NewRows(revisionRowColumns).
+			AddRow(2, "dm-1", "req-2", created.Add(time.Hour)).
+			AddRow(1, "system", "", created))
+	mock.ExpectQuery(query).WithArgs("Gloomwing").
+		WillReturnRows(mock.NewRows(revisionRowColumns))
+
+	router := gin.Default()
+	router.GET("/beasts/:key/revisions", ListRevisions)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Owlbear/revisions", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[
+		{"revision":2,"author":"dm-1","request_id":"req-2","timestamp":"2024-05-01T13:00:00Z"},
+		{"revision":1,"author":"system","timestamp":"2024-05-01T12:00:00Z"}
+	]`, w.Body.String())
+
+	// Beasts that do not exist or are hidden from the caller have no visible revisions
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/beasts/Gloomwing/revisions", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetRevision(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE r.beast_name=$1 AND r.revision=$2 AND b.deleted_at IS NULL AND visibility = 'public'")).
+		WithArgs("Owlbear", 1).
+		WillReturnRows(mock.NewRows(append(revisionRowColumns, "data")).
+			AddRow(1, "system", "", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+				[]byte(`{"BeastName":"Owlbear","Type":"Monstrosity","CR":"3","Attributes":{"STR":"20 (+5)"},"Description":""}`)))
+
+	router := gin.Default()
+	router.GET("/beasts/:key/revisions/:n", GetRevision)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Owlbear/revisions/1", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"revision":1,"author":"system","timestamp":"2024-05-01T12:00:00Z",
+		"beast":{"BeastName":"Owlbear","Type":"Monstrosity","CR":"3","Attributes":{"STR":"20 (+5)"},"Description":""}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/beasts/Owlbear/revisions/latest", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta("WHERE r.beast_name=$1 AND r.revision=$2")
+	mock.ExpectQuery(query).WithArgs("Owlbear", 1).
+		WillReturnRows(mock.NewRows(append(revisionRowColumns, "data")).
+			AddRow(1, "system", "", created, []byte(`{"BeastName":"Owlbear","CR":"3","Attributes":{"STR":"20 (+5)","DEX":"12 (+1)"}}`)))
+	mock.ExpectQuery(query).WithArgs("Owlbear", 3).
+		WillReturnRows(mock.NewRows(append(revisionRowColumns, "data")).
+			AddRow(3, "dm-1", "", created, []byte(`{"BeastName":"Owlbear","CR":"4","Attributes":{"STR":"22 (+6)","CON":"17 (+3)"}}`)))
+
+	router := gin.Default()
+	router.GET("/beasts/:key/diff", DiffRevisions)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Owlbear/diff?from=1&to=3", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"from":1,"to":3,"changes":[
+		{"field":"CR","from":"3","to":"4"},
+		{"field":"Attributes.CON","from":"","to":"17 (+3)"},
+		{"field":"Attributes.DEX","from":"12 (+1)","to":""},
+		{"field":"Attributes.STR","from":"20 (+5)","to":"22 (+6)"}
+	]}`, w.Body.String())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRestoreRevision(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).WithArgs("Owlbear").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "4", map[string]string{"STR": "22 (+6)"}, "", "dm-1", "private", "", 0, "", "", "", "", []string{}, "", 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT data FROM beast_revisions WHERE beast_name=$1 AND revision=$2")).
+		WithArgs("Owlbear", 1).
+		WillReturnRows(mock.NewRows([]string{"data"}).
+			AddRow([]byte(`{"BeastName":"Owlbear","Type":"Monstrosity","CR":"3","Attributes":{"STR":"20 (+5)"},"Description":"","Owner":"dm-1","Visibility":"public"}`)))
+	mock.ExpectExec("UPDATE beasts").
+		WithArgs("Monstrosity", "3", map[string]string{"STR": "20 (+5)"}, "", "public", nil, 0, "", "", "", "", nil, 0, "Owlbear").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(auditInsert).
+		WithArgs("Owlbear", "dm-1", AuditUpdate, pgxmock.AnyArg(), pgxmock.AnyArg(), nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(revisionInsert).
+		WithArgs("Owlbear", pgxmock.AnyArg(), "dm-1", nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(eventInsert).
+		WithArgs("Owlbear", AuditUpdate, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}))
+	router.POST("/beasts/:key/revisions/:n/restore", RestoreRevision)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/beasts/Owlbear/revisions/1/restore", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"Beast restored successfully","revision":1}`, w.Body.String())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRestoreRevision_RequiresOwner(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).WithArgs("Owlbear").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "4", map[string]string{}, "", "dm-1", "public", "", 0, "", "", "", "", []string{}, "", 0))
+	mock.ExpectRollback()
+
+	router := gin.Default()
+	router.Use(AssumePrincipal(&auth.Principal{Subject: "dm-2", Roles: []string{RoleEditor}}))
+	router.POST("/beasts/:key/revisions/:n/restore", RestoreRevision)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/beasts/Owlbear/revisions/1/restore", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/keremenci/bestiary-crud/rules"
+)
+
+// roll20Export is a Roll20 character in the JSON format of the VTT Enhancement Suite character import
+type roll20Export struct {
+	SchemaVersion int             `json:"schema_version"`
+	Type          string          `json:"type"`
+	Character     roll20Character `json:"character"`
+}
+
+type roll20Character struct {
+	Name      string          `json:"name"`
+	Bio       string          `json:"bio"`
+	Attribs   []roll20Attrib  `json:"attribs"`
+	Abilities []roll20Ability `json:"abilities"`
+}
+
+// roll20Attrib is an attribute of the character sheet. Values are written as text, as Roll20 stores them.
+type roll20Attrib struct {
+	Name    string `json:"name"`
+	Current string `json:"current"`
+	Max     string `json:"max"`
+}
+
+// roll20Ability is a macro of a character. None are exported; the sheet makes its own from the attributes.
+type roll20Ability struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+// roll20Abilities name the ability score attributes of the D&D 5E by Roll20 sheet
+var roll20Abilities = map[string]string{"STR": "strength", "DEX": "dexterity", "CON": "constitution",
+	"INT": "intelligence", "WIS": "wisdom", "CHA": "charisma"}
+
+// roll20CharacterOf converts a beast, and the source it comes from if any, to an NPC of the
+// D&D 5E by Roll20 sheet. Traits and actions become rows of its repeating sections.
+func roll20CharacterOf(beast Beast, source *Source) roll20Export {
+	intro, features := parseFeatures(beast.Description)
+	derived := deriveStats(beast)
+	character := roll20Character{Name: beast.BeastName, Bio: biography(intro, source), Abilities: []roll20Ability{}}
+	set := func(name, current string) {
+		character.Attribs = append(character.Attribs, roll20Attrib{Name: name, Current: current})
+	}
+
+	set("npc", "1")
+	set("npc_name", beast.BeastName)
+	set("npc_type", typeLine(beast))
+	if beast.ArmorClass > 0 {
+		set("npc_ac", strconv.Itoa(beast.ArmorClass))
+	}
+	if hd, err := rules.ParseHitDice(beast.HitDice); err == nil {
+		hp := strconv.Itoa(hd.Average())
+		character.Attribs = append(character.Attribs, roll20Attrib{Name: "hp", Current: hp, Max: hp})
+		set("npc_hpformula", hd.String())
+	}
+	for _, ability := range rules.Abilities {
+		if score, err := rules.ParseAbilityScore(beast.Attributes[ability]); err == nil {
+			set(roll20Abilities[ability]+"_base", strconv.Itoa(score))
+			set(roll20Abilities[ability], strconv.Itoa(score))
+		}
+	}
+	if cr, err := rules.NormalizeCR(beast.CR); err == nil {
+		set("npc_challenge", cr)
+		set("npc_xp", strconv.Itoa(derived.XP))
+	}
+	set("npc_senses", fmt.Sprintf("passive Perception %d", derived.PassivePerception))
+
+	for i, f := range features {
+		section := "npctrait"
+		if f.isAction() {
+			section = "npcaction"
+		}
+		row := "repeating_" + section + "_" + roll20RowID(beast.BeastName, i) + "_"
+		set(row+"name", f.Name)
+		set(row+"description", f.Text)
+		if f.Attack == nil {
+			continue
+		}
+		set(row+"attack_flag", "on")
+		set(row+"attack_type", strings.TrimSuffix(f.Range, " or Ranged"))
+		set(row+"attack_tohit", strconv.Itoa(f.Attack.ToHit))
+		for j, d := range f.Attack.Damage[:min(len(f.Attack.Damage), 2)] {
+			suffix := ""
+			if j > 0 {
+				suffix = "2"
+			}
+			set(row+"attack_damage"+suffix, d.Dice.String())
+			set(row+"attack_damagetype"+suffix, d.Type)
+		}
+	}
+	return roll20Export{SchemaVersion: 2, Type: "character", Character: character}
+}
+
+// roll20RowID returns the ID of the i-th repeating row of a beast. Roll20 row IDs are 20 characters
+// starting with a dash; these are derived from the beast so that exports don't change between requests.
+func roll20RowID(name string, i int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s/%d", name, i)))
+	return "-" + hex.EncodeToString(sum[:])[:19]
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/rules"
+)
+
+// scaleBeast adjusts a beast's armor class, hit dice, attack bonuses, damage and save DCs
+func scaleBeast(beast Beast, s rules.Scaling) Beast {
+	beast.CR = s.To.CR
+	if beast.ArmorClass > 0 {
+		beast.ArmorClass = s.ArmorClass(beast.ArmorClass)
+	}
+	if hd, err := rules.ParseHitDice(beast.HitDice); err == nil {
+		beast.HitDice = s.HitDice(hd).String()
+	}
+	beast.Description = s.Description(beast.Description)
+	return beast
+}
+
+// WhenSaving applies a middleware, such as the write rate limit, only to scaling requests with ?save=true,
+// which create beasts like POST /beasts does
+func WhenSaving(middleware gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if save, _ := strconv.ParseBool(c.Query("save")); save {
+			middleware(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ScaleBeast returns a beast adjusted to the challenge rating in ?target_cr= without saving it.
+// With ?save=true the result is created as a new beast owned by the caller, named ?name= or
+// "<beast> (CR <target>)" and private unless ?visibility= (and ?campaign=) say otherwise. The copy is
+// homebrew, so it has no source.
+func ScaleBeast(c *gin.Context) {
+	target, err := rules.NormalizeCR(c.Query("target_cr"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid target_cr")
+		return
+	}
+	save := false
+	if raw := c.Query("save"); raw != "" {
+		if save, err = strconv.ParseBool(raw); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid save")
+			return
+		}
+	}
+	if save && !authorized(c, ActionCreateBeast) {
+		return
+	}
+
+	beast, ok := loadBeast(c, c.Param("key"))
+	if !ok {
+		return
+	}
+	scaling, err := rules.NewScaling(beast.CR, target)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, "Beast has no valid CR to scale from")
+		return
+	}
+	scaled := scaleBeast(beast, scaling)
+
+	if !save {
+		scaled.Derived = deriveStats(scaled)
+		c.JSON(http.StatusOK, scaled)
+		return
+	}
+
+	scaled.BeastName = c.DefaultQuery("name", fmt.Sprintf("%s (CR %s)", beast.BeastName, target))
+	if scaled.BeastName == "" {
+		respondError(c, http.StatusBadRequest, "Invalid name")
+		return
+	}
+	scaled.Source, scaled.SourcePage = "", 0
+	scaled.Visibility = c.DefaultQuery("visibility", VisibilityPrivate)
+	scaled.Campaign = c.Query("campaign")
+	if err := normalizeVisibility(&scaled); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !createBeast(c, &scaled) {
+		return
+	}
+	scaled.Derived = deriveStats(scaled)
+	c.JSON(http.StatusCreated, scaled)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/keremenci/bestiary-crud/ratelimit"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaleBeast(t *testing.T) {
+	editor := &auth.Principal{Subject: "dm-1", Roles: []string{"editor"}}
+	viewer := &auth.Principal{Subject: "player-1", Roles: []string{"viewer"}}
+	filter := regexp.QuoteMeta("FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND (visibility = 'public' OR owner = $2")
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		query     string
+		load      bool
+		save      bool
+		code      int
+	}{
+		{"Preview", editor, "?target_cr=6", true, false, http.StatusOK},
+		{"Saved", editor, "?target_cr=6&save=true", true, true, http.StatusCreated},
+		{"InvalidTarget", editor, "?target_cr=31", false, false, http.StatusBadRequest},
+		{"MissingTarget", editor, "", false, false, http.StatusBadRequest},
+		{"SaveForbidden", viewer, "?target_cr=6&save=true", false, false, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			SetPolicy(DefaultPolicy())
+
+			if tt.load {
+				mock.ExpectQuery(filter).WithArgs("Owlbear", tt.principal.Subject, pgxmock.AnyArg()).
+					WillReturnRows(mock.NewRows(beastRowColumns).
+						AddRow("Owlbear", "Monstrosity", "3", map[string]string{"WIS": "12 (+1)"}, owlbearDescription, "", "public", "", 13, "7d10+21", "", "", "", []string{}, "SRD", 147))
+			}
+			if tt.save {
+				// The copy is homebrew, not from the source of the original
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO beasts")).
+					WithArgs("Owlbear (CR 6)", "Monstrosity", "6", pgxmock.AnyArg(), pgxmock.AnyArg(), "dm-1", "private", nil, 15, "10d10+30", "", "", "", nil, 0).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(auditInsert).
+					WithArgs("Owlbear (CR 6)", "dm-1", AuditCreate, []byte(nil), pgxmock.AnyArg(), nil).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(revisionInsert).
+					WithArgs("Owlbear (CR 6)", pgxmock.AnyArg(), "dm-1", nil).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(eventInsert).
+					WithArgs("Owlbear (CR 6)", AuditCreate, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(tt.principal))
+			router.POST("/beasts/:key/scale", ScaleBeast)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/beasts/Owlbear/scale"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.load {
+				var beast Beast
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &beast))
+				assert.Equal(t, "6", beast.CR)
+				assert.Equal(t, 15, beast.ArmorClass)
+				assert.Equal(t, "10d10+30", beast.HitDice)
+				assert.Contains(t, beast.Description, "+9 to hit, reach 5 ft., one creature. Hit: 16 (2d10 + 5) piercing damage.")
+				assert.Contains(t, beast.Description, "Hit: 23 (4d8 + 5) slashing damage.")
+				require.NotNil(t, beast.Derived)
+				assert.Equal(t, 3, beast.Derived.ProficiencyBonus)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestWhenSaving(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	router := gin.Default()
+	router.POST("/beasts/:key/scale", WhenSaving(RateLimit(store, "write", ratelimit.Limit{Rate: 0.1, Burst: 1})), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	send := func(query string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/beasts/Owlbear/scale"+query, nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Previews are not charged to the write limit, saving is
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send("?target_cr=6"))
+	}
+	assert.Equal(t, http.StatusOK, send("?target_cr=6&save=true"))
+	assert.Equal(t, http.StatusTooManyRequests, send("?target_cr=6&save=true"))
+	assert.Equal(t, http.StatusOK, send("?target_cr=6&save=false"))
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// OpenLicenses are the licenses, as SPDX identifiers, under which beasts may be published.
+// Beasts without a source are never open.
+var OpenLicenses = []string{"CC-BY-4.0", "CC0-1.0", "OGL-1.0a", "ORC"}
+
+// PostgreSQL error codes of constraint violations
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+)
+
+// Source is a book or document beasts come from, such as the SRD or a homebrew supplement
+type Source struct {
+	Abbreviation string `json:"abbreviation"`
+	Title        string `json:"title"`
+	License      string `json:"license"`
+	Attribution  string `json:"attribution"`
+	Open         bool   `json:"open"`
+}
+
+// sourcePattern matches valid source abbreviations, such as "SRD" or "VGM"
+var sourcePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,19}$`)
+
+// sourceColumns are the columns scanned by scanSource
+const sourceColumns = "abbreviation, title, license, attribution"
+
+func scanSource(row pgx.Row, source *Source) error {
+	err := row.Scan(&source.Abbreviation, &source.Title, &source.License, &source.Attribution)
+	source.Open = isOpenLicense(source.License)
+	return err
+}
+
+// isOpenLicense reports whether a license is one of OpenLicenses
+func isOpenLicense(license string) bool {
+	for _, l := range OpenLicenses {
+		if l == license {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeLicense writes the open licenses as in OpenLicenses, whatever their case
+func normalizeLicense(license string) string {
+	license = strings.TrimSpace(license)
+	for _, l := range OpenLicenses {
+		if strings.EqualFold(l, license) {
+			return l
+		}
+	}
+	return license
+}
+
+// isViolation reports whether err is a violation of a constraint of the given PostgreSQL error code
+func isViolation(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+// normalizeSource checks the source reference of a beast. Whether the source exists is left to the database.
+func normalizeSource(beast *Beast) error {
+	beast.Source = strings.TrimSpace(beast.Source)
+	if beast.Source != "" && !sourcePattern.MatchString(beast.Source) {
+		return errors.New("Invalid Source, expected the abbreviation of a source")
+	}
+	if beast.SourcePage < 0 {
+		return errors.New("SourcePage must not be negative")
+	}
+	if beast.SourcePage > 0 && beast.Source == "" {
+		return errors.New("SourcePage requires a Source")
+	}
+	return nil
+}
+
+// ListSources returns all sources
+func ListSources(c *gin.Context) {
+	sources, ok := findSources(c, "")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, sources)
+}
+
+// findSources returns the sources selected by the where clause, by abbreviation.
+// It writes the error response and returns false if the query fails.
+func findSources(c *gin.Context, where string, args ...interface{}) ([]Source, bool) {
+	rows, err := dbPool.Query(c.Request.Context(), "SELECT "+sourceColumns+" FROM sources"+where+" ORDER BY abbreviation", args...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	defer rows.Close()
+
+	sources := []Source{}
+	for rows.Next() {
+		var source Source
+		if err := scanSource(rows, &source); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return nil, false
+		}
+		sources = append(sources, source)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	return sources, true
+}
+
+// GetSource returns a single source
+func GetSource(c *gin.Context) {
+	var source Source
+	err := scanSource(dbPool.QueryRow(c.Request.Context(), "SELECT "+sourceColumns+" FROM sources WHERE abbreviation = $1", c.Param("source")), &source)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Source not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, source)
+}
+
+// bindSource reads a source from the request body and normalizes its license.
+// It writes the error response and returns false if the source is invalid.
+func bindSource(c *gin.Context) (Source, bool) {
+	var source Source
+	if err := c.ShouldBindJSON(&source); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return source, false
+	}
+	if strings.TrimSpace(source.Title) == "" {
+		respondError(c, http.StatusBadRequest, "Title is required")
+		return source, false
+	}
+	source.License = normalizeLicense(source.License)
+	source.Open = isOpenLicense(source.License)
+	return source, true
+}
+
+// CreateSource creates a source beasts can refer to
+func CreateSource(c *gin.Context) {
+	source, ok := bindSource(c)
+	if !ok {
+		return
+	}
+	if !sourcePattern.MatchString(source.Abbreviation) {
+		respondError(c, http.StatusBadRequest, "Invalid abbreviation, expected up to 20 letters, digits and . _ -")
+		return
+	}
+	cmdTag, err := dbPool.Exec(c.Request.Context(),
+		"INSERT INTO sources (abbreviation, title, license, attribution) VALUES ($1, $2, $3, $4) ON CONFLICT (abbreviation) DO NOTHING",
+		source.Abbreviation, source.Title, source.License, source.Attribution)
+	if err != nil {
+		requestLogger(c).Error("Error inserting into database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if cmdTag.RowsAffected() == 0 {
+		respondError(c, http.StatusConflict, "Source already exists")
+		return
+	}
+	c.JSON(http.StatusCreated, source)
+}
+
+// UpdateSource changes the title, license and attribution of a source. The abbreviation stays the same.
+func UpdateSource(c *gin.Context) {
+	source, ok := bindSource(c)
+	if !ok {
+		return
+	}
+	source.Abbreviation = c.Param("source")
+	cmdTag, err := dbPool.Exec(c.Request.Context(),
+		"UPDATE sources SET title = $1, license = $2, attribution = $3 WHERE abbreviation = $4",
+		source.Title, source.License, source.Attribution, source.Abbreviation)
+	if err != nil {
+		requestLogger(c).Error("Error updating database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if cmdTag.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, "Source not found")
+		return
+	}
+	c.JSON(http.StatusOK, source)
+}
+
+// DeleteSource deletes a source no beast refers to, including beasts in the trash
+func DeleteSource(c *gin.Context) {
+	cmdTag, err := dbPool.Exec(c.Request.Context(), "DELETE FROM sources WHERE abbreviation = $1", c.Param("source"))
+	if err != nil {
+		if isViolation(err, foreignKeyViolation) {
+			respondError(c, http.StatusConflict, "Source is used by beasts")
+			return
+		}
+		requestLogger(c).Error("Error deleting from database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if cmdTag.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, "Source not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
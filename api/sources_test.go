@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sourceRowColumns = []string{"abbreviation", "title", "license", "attribution"}
+
+func TestNormalizeSource(t *testing.T) {
+	beast := Beast{Source: " SRD ", SourcePage: 339}
+	require.NoError(t, normalizeSource(&beast))
+	assert.Equal(t, "SRD", beast.Source)
+
+	assert.Error(t, normalizeSource(&Beast{Source: "Monster Manual"}))
+	assert.Error(t, normalizeSource(&Beast{Source: "MM", SourcePage: -1}))
+	assert.Error(t, normalizeSource(&Beast{SourcePage: 12}))
+
+	assert.Equal(t, "CC-BY-4.0", normalizeLicense(" cc-by-4.0"))
+	assert.Equal(t, "proprietary", normalizeLicense("proprietary"))
+	assert.True(t, isOpenLicense("OGL-1.0a"))
+	assert.False(t, isOpenLicense(""))
+}
+
+func TestListSources(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT abbreviation, title, license, attribution FROM sources ORDER BY abbreviation")).
+		WillReturnRows(mock.NewRows(sourceRowColumns).
+			AddRow("MM", "Monster Manual", "proprietary", "").
+			AddRow("SRD", "System Reference Document 5.1", "CC-BY-4.0", "Includes SRD 5.1 material."))
+
+	router := gin.Default()
+	router.GET("/sources", ListSources)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/sources", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"abbreviation":"MM","title":"Monster Manual","license":"proprietary","attribution":"","open":false},
+		{"abbreviation":"SRD","title":"System Reference Document 5.1","license":"CC-BY-4.0","attribution":"Includes SRD 5.1 material.","open":true}]`, w.Body.String())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSourceChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		expect func(mock pgxmock.PgxPoolIface)
+		code   int
+	}{
+		{"Create", "POST", "/sources", `{"abbreviation":"ToB","title":"Tome of Beasts","license":"ogl-1.0a"}`, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO sources (abbreviation, title, license, attribution)")).
+				WithArgs("ToB", "Tome of Beasts", "OGL-1.0a", "").
+				WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		}, http.StatusCreated},
+		{"CreateExisting", "POST", "/sources", `{"abbreviation":"MM","title":"Monster Manual"}`, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO sources")).WithArgs("MM", "Monster Manual", "", "").
+				WillReturnResult(pgxmock.NewResult("INSERT", 0))
+		}, http.StatusConflict},
+		{"CreateInvalid", "POST", "/sources", `{"abbreviation":"Monster Manual","title":"Monster Manual"}`, nil, http.StatusBadRequest},
+		{"CreateUntitled", "POST", "/sources", `{"abbreviation":"MM"}`, nil, http.StatusBadRequest},
+		{"Update", "PUT", "/sources/HB", `{"title":"House rules","license":"proprietary"}`, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE sources SET title = $1, license = $2, attribution = $3 WHERE abbreviation = $4")).
+				WithArgs("House rules", "proprietary", "", "HB").
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		}, http.StatusOK},
+		{"UpdateMissing", "PUT", "/sources/HB", `{"title":"House rules"}`, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE sources")).WithArgs("House rules", "", "", "HB").
+				WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+		}, http.StatusNotFound},
+		{"Delete", "DELETE", "/sources/HB", ``, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM sources WHERE abbreviation = $1")).WithArgs("HB").
+				WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		}, http.StatusNoContent},
+		{"DeleteUsed", "DELETE", "/sources/MM", ``, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM sources")).WithArgs("MM").
+				WillReturnError(&pgconn.PgError{Code: foreignKeyViolation})
+		}, http.StatusConflict},
+		{"DeleteMissing", "DELETE", "/sources/HB", ``, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM sources")).WithArgs("HB").
+				WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+
+			router := gin.Default()
+			router.POST("/sources", CreateSource)
+			router.PUT("/sources/:source", UpdateSource)
+			router.DELETE("/sources/:source", DeleteSource)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPutItem_UnknownSource(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO beasts").
+		WithArgs("Quickling", "Fey", "1", map[string]string(nil), "", nil, "public", nil, 0, "", "", "", "", "XYZ", 12).
+		WillReturnError(&pgconn.PgError{Code: foreignKeyViolation})
+	mock.ExpectRollback()
+
+	router := gin.Default()
+	router.POST("/beasts", PutItem)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/beasts", bytes.NewBufferString(`{"BeastName":"Quickling","Type":"Fey","CR":"1","Source":"XYZ","SourcePage":12}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Unknown source")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
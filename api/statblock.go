@@ -0,0 +1,305 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/keremenci/bestiary-crud/pdf"
+	"github.com/keremenci/bestiary-crud/rules"
+)
+
+// Printed pages have two columns between their margins, with room for the page number at the bottom
+const (
+	pageMargin   = 54.0
+	columnGap    = 18.0
+	columnWidth  = (pdf.PageWidth - 2*pageMargin - columnGap) / 2
+	columnTop    = pdf.PageHeight - pageMargin
+	columnBottom = pageMargin + 18
+	bodySize     = 8.5
+)
+
+// statBlockRed is the color of beast names, headings and rules, as in the Monster Manual
+var statBlockRed = pdf.Color{R: 0.48, G: 0.11, B: 0.08}
+
+// bookLayout flows text down the columns of a document, starting a new column or page when one is full
+type bookLayout struct {
+	doc    *pdf.Document
+	page   *pdf.Page
+	column int
+	y      float64
+}
+
+func newBookLayout(title string) *bookLayout {
+	l := &bookLayout{doc: pdf.New(title)}
+	l.newPage()
+	return l
+}
+
+func (l *bookLayout) newPage() {
+	l.page, l.column, l.y = l.doc.AddPage(), 0, columnTop
+}
+
+func (l *bookLayout) nextColumn() {
+	if l.column == 0 {
+		l.column, l.y = 1, columnTop
+	} else {
+		l.newPage()
+	}
+}
+
+// need moves to the next column unless height points are left in this one
+func (l *bookLayout) need(height float64) {
+	if l.y-height < columnBottom {
+		l.nextColumn()
+	}
+}
+
+// left returns where the current column starts
+func (l *bookLayout) left() float64 {
+	return pageMargin + float64(l.column)*(columnWidth+columnGap)
+}
+
+func leading(size float64) float64 {
+	return size * 1.25
+}
+
+// text writes a single line
+func (l *bookLayout) text(font pdf.Font, size float64, c pdf.Color, s string) {
+	l.need(leading(size))
+	l.page.Text(l.left(), l.y-size, font, size, c, s)
+	l.y -= leading(size)
+}
+
+// paragraph writes wrapped text after a run-in heading, which may be empty
+func (l *bookLayout) paragraph(heading string, headingFont, font pdf.Font, c pdf.Color, text string) {
+	indent := 0.0
+	if heading != "" {
+		indent = pdf.Width(headingFont, bodySize, heading+" ")
+	}
+	lines := pdf.Wrap(font, bodySize, text, columnWidth, indent)
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	for i, line := range lines {
+		l.need(leading(bodySize))
+		baseline := l.y - bodySize
+		if i == 0 && heading != "" {
+			l.page.Text(l.left(), baseline, headingFont, bodySize, c, heading)
+			l.page.Text(l.left()+indent, baseline, font, bodySize, c, line)
+		} else {
+			l.page.Text(l.left(), baseline, font, bodySize, c, line)
+		}
+		l.y -= leading(bodySize)
+	}
+}
+
+// rule draws a line across the column
+func (l *bookLayout) rule(width float64) {
+	l.need(6)
+	l.y -= 3
+	l.page.Line(l.left(), l.y, l.left()+columnWidth, l.y, width, statBlockRed)
+	l.y -= 3
+}
+
+// statBlock writes a beast in the layout of the Monster Manual and returns the page it starts on.
+// Features of the description are split into traits and actions; the lines before them and the
+// source of the beast follow the stat block.
+func (l *bookLayout) statBlock(beast Beast, source *Source) int {
+	// Keep the name with the start of the stat block
+	l.need(100)
+	page := l.doc.Pages()
+	l.text(pdf.Bold, 14, statBlockRed, beast.BeastName)
+	if line := typeLine(beast); line != "" {
+		l.text(pdf.Italic, bodySize, pdf.Black, line)
+	}
+
+	l.rule(1.5)
+	hd, hdErr := rules.ParseHitDice(beast.HitDice)
+	if beast.ArmorClass > 0 || hdErr == nil {
+		if beast.ArmorClass > 0 {
+			l.paragraph("Armor Class", pdf.Bold, pdf.Regular, statBlockRed, strconv.Itoa(beast.ArmorClass))
+		}
+		if hdErr == nil {
+			l.paragraph("Hit Points", pdf.Bold, pdf.Regular, statBlockRed, fmt.Sprintf("%d (%s)", hd.Average(), hd))
+		}
+		l.rule(1.5)
+	}
+	if slices.ContainsFunc(rules.Abilities, func(ability string) bool { return beast.Attributes[ability] != "" }) {
+		l.abilities(beast)
+		l.rule(1.5)
+	}
+
+	var others []string
+	for name := range beast.Attributes {
+		if !slices.Contains(rules.Abilities, name) {
+			others = append(others, name)
+		}
+	}
+	slices.Sort(others)
+	for _, name := range others {
+		l.paragraph(name, pdf.Bold, pdf.Regular, pdf.Black, beast.Attributes[name])
+	}
+	if xp, err := rules.XPForCR(beast.CR); err == nil {
+		cr, _ := rules.NormalizeCR(beast.CR)
+		l.paragraph("Challenge", pdf.Bold, pdf.Regular, pdf.Black, fmt.Sprintf("%s (%d XP)", cr, xp))
+	} else if beast.CR != "" {
+		l.paragraph("Challenge", pdf.Bold, pdf.Regular, pdf.Black, beast.CR)
+	}
+	if len(beast.Tags) > 0 {
+		l.paragraph("Tags", pdf.Bold, pdf.Regular, pdf.Black, strings.Join(beast.Tags, ", "))
+	}
+	if len(others) > 0 || beast.CR != "" || len(beast.Tags) > 0 {
+		l.rule(1.5)
+	}
+
+	intro, features := parseFeatures(beast.Description)
+	var actions []feature
+	for _, f := range features {
+		if f.isAction() {
+			actions = append(actions, f)
+			continue
+		}
+		l.feature(f)
+	}
+	if len(actions) > 0 {
+		l.need(40)
+		l.y -= 4
+		l.text(pdf.Regular, 12, statBlockRed, "Actions")
+		l.rule(0.5)
+		for _, f := range actions {
+			l.feature(f)
+		}
+	}
+	for _, line := range intro {
+		l.y -= 2
+		l.paragraph("", pdf.Regular, pdf.Italic, pdf.Black, line)
+	}
+	if source != nil {
+		text := source.Title
+		if beast.SourcePage > 0 {
+			text += fmt.Sprintf(", page %d", beast.SourcePage)
+		}
+		l.y -= 2
+		l.paragraph("Source:", pdf.Italic, pdf.Italic, pdf.Black, text)
+	}
+	l.y -= 14
+	return page
+}
+
+// abilities writes the ability scores of a beast with their modifiers as a table of six columns.
+// Scores that can't be read are left as a dash.
+func (l *bookLayout) abilities(beast Beast) {
+	l.need(2 * leading(bodySize))
+	cell := columnWidth / float64(len(rules.Abilities))
+	centered := func(i int, font pdf.Font, s string) {
+		l.page.Text(l.left()+float64(i)*cell+(cell-pdf.Width(font, bodySize, s))/2, l.y-bodySize, font, bodySize, statBlockRed, s)
+	}
+	for i, ability := range rules.Abilities {
+		centered(i, pdf.Bold, ability)
+	}
+	l.y -= leading(bodySize)
+	for i, ability := range rules.Abilities {
+		value := "—"
+		if score, err := rules.ParseAbilityScore(beast.Attributes[ability]); err == nil {
+			value = fmt.Sprintf("%d (%+d)", score, rules.AbilityModifier(score))
+		}
+		centered(i, pdf.Regular, value)
+	}
+	l.y -= leading(bodySize)
+}
+
+// feature writes a trait or action, its name run in before the first paragraph
+func (l *bookLayout) feature(f feature) {
+	l.y -= 2
+	for i, text := range strings.Split(f.Text, "\n") {
+		heading := ""
+		if i == 0 {
+			heading = f.Name + "."
+		}
+		l.paragraph(heading, pdf.BoldItalic, pdf.Regular, pdf.Black, text)
+	}
+}
+
+// credits lists the sources of the beasts with their licenses and the attributions they ask for
+func (l *bookLayout) credits(sources []Source) {
+	if len(sources) == 0 {
+		return
+	}
+	l.need(60)
+	l.text(pdf.Regular, 12, statBlockRed, "Credits")
+	l.rule(0.5)
+	for _, source := range sources {
+		var notes []string
+		for _, note := range []string{source.License, source.Attribution} {
+			if note != "" {
+				notes = append(notes, strings.TrimSuffix(note, "."))
+			}
+		}
+		text := strings.Join(notes, ". ")
+		if text != "" {
+			text += "."
+		}
+		l.y -= 2
+		l.paragraph(source.Title+".", pdf.Bold, pdf.Regular, pdf.Black, text)
+	}
+}
+
+// indexEntry is a beast in the index and the page it starts on
+type indexEntry struct {
+	Name string
+	Page int
+}
+
+// indexInitial returns the letter a name is listed under in the index, or # for names not starting with one
+func indexInitial(name string) string {
+	r, _ := utf8.DecodeRuneInString(name)
+	if !unicode.IsLetter(r) {
+		return "#"
+	}
+	return string(unicode.ToUpper(r))
+}
+
+// index writes the entries under the initial letter of their names, their pages right aligned after dot leaders
+func (l *bookLayout) index(entries []indexEntry) {
+	l.text(pdf.Bold, 18, statBlockRed, "Index")
+	l.rule(1.5)
+	initial := ""
+	for _, entry := range entries {
+		if letter := indexInitial(entry.Name); letter != initial {
+			initial = letter
+			l.need(leading(11) + 2*leading(bodySize))
+			l.y -= 4
+			l.text(pdf.Bold, 11, statBlockRed, letter)
+		}
+
+		page := strconv.Itoa(entry.Page)
+		name := entry.Name
+		for name != "" && pdf.Width(pdf.Regular, bodySize, name+" "+page) > columnWidth {
+			name = strings.TrimRightFunc(string([]rune(name)[:len([]rune(name))-1]), unicode.IsSpace)
+		}
+		l.need(leading(bodySize))
+		baseline := l.y - bodySize
+		pageX := l.left() + columnWidth - pdf.Width(pdf.Regular, bodySize, page)
+		l.page.Text(l.left(), baseline, pdf.Regular, bodySize, pdf.Black, name)
+		l.page.Text(pageX, baseline, pdf.Regular, bodySize, pdf.Black, page)
+		dot := pdf.Width(pdf.Regular, bodySize, ".")
+		space := pageX - l.left() - pdf.Width(pdf.Regular, bodySize, name+" ") - dot
+		if dots := int(space / dot); dots > 0 {
+			leaders := strings.Repeat(".", dots)
+			l.page.Text(pageX-dot-pdf.Width(pdf.Regular, bodySize, leaders), baseline, pdf.Regular, bodySize, pdf.Black, leaders)
+		}
+		l.y -= leading(bodySize)
+	}
+}
+
+// numberPages writes the page number at the bottom of every page from the first one given
+func (l *bookLayout) numberPages(from int) {
+	for n := from; n <= l.doc.Pages(); n++ {
+		s := strconv.Itoa(n)
+		l.doc.Page(n).Text((pdf.PageWidth-pdf.Width(pdf.Regular, 9, s))/2, pageMargin-18, pdf.Regular, 9, pdf.Black, s)
+	}
+}
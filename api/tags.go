@@ -0,0 +1,336 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Sizes of creatures, smallest first
+var Sizes = []string{"Tiny", "Small", "Medium", "Large", "Huge", "Gargantuan"}
+
+// EnvironmentCategory is the tag category read as a beast's environments by encounter generation
+const EnvironmentCategory = "environment"
+
+// Tag is a free-form label of beasts, such as an environment, a source book or "homebrew"
+type Tag struct {
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Beasts      int    `json:"beasts,omitempty"`
+}
+
+var (
+	tagPattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9 ._'-]{0,49}$`)
+	subtypePattern = regexp.MustCompile(`^(.*?)\s*\(([^)]*)\)\s*$`)
+)
+
+// normalizeTag returns a tag name in lowercase, or an error if it is not one
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !tagPattern.MatchString(name) {
+		return "", fmt.Errorf("Invalid tag %q, expected up to 50 letters, digits, spaces and . _ ' -", name)
+	}
+	return name, nil
+}
+
+// normalizeSize returns a size as written in Sizes, or an error if it is not one
+func normalizeSize(size string) (string, error) {
+	for _, s := range Sizes {
+		if strings.EqualFold(s, strings.TrimSpace(size)) {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("Invalid size %q, expected one of %s", size, strings.Join(Sizes, ", "))
+}
+
+// normalizeTaxonomy moves a parenthesized subtype out of the type, as in "Aberration (Mind Flayer)",
+// checks the size and sorts the tags, dropping duplicates
+func normalizeTaxonomy(beast *Beast) error {
+	if m := subtypePattern.FindStringSubmatch(beast.Type); m != nil && beast.Subtype == "" {
+		beast.Type, beast.Subtype = m[1], strings.TrimSpace(m[2])
+	}
+	if beast.Size != "" {
+		size, err := normalizeSize(beast.Size)
+		if err != nil {
+			return err
+		}
+		beast.Size = size
+	}
+
+	tags := make([]string, 0, len(beast.Tags))
+	for _, t := range beast.Tags {
+		tag, err := normalizeTag(t)
+		if err != nil {
+			return err
+		}
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	beast.Tags = slices.Compact(tags)
+	return nil
+}
+
+// setBeastTags replaces the tags of a beast, creating the tags that do not exist yet
+func setBeastTags(ctx context.Context, tx pgx.Tx, key string, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING", tags); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM beast_tags WHERE beast_name = $1 AND NOT (tag = ANY($2))", key, tags); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, "INSERT INTO beast_tags (beast_name, tag) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING", key, tags)
+	return err
+}
+
+// tagColumns are the columns scanned into a Tag, counting the beasts visible with the filter
+// of visibilityFilter
+func tagColumns(filter string) string {
+	return "name, category, description, (SELECT count(*) FROM beast_tags JOIN beasts USING (beast_name) " +
+		"WHERE beast_tags.tag = tags.name AND deleted_at IS NULL AND " + filter + ")"
+}
+
+// ListTags returns all tags, optionally of a single ?category=, with the number of beasts visible to the caller carrying them
+func ListTags(c *gin.Context) {
+	var args []interface{}
+	where := ""
+	if category := c.Query("category"); category != "" {
+		args = append(args, strings.ToLower(category))
+		where = " WHERE category = $1"
+	}
+	filter, filterArgs := visibilityFilter(CurrentPrincipal(c), len(args))
+	rows, err := dbPool.Query(c.Request.Context(), "SELECT "+tagColumns(filter)+" FROM tags"+where+" ORDER BY name", append(args, filterArgs...)...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.Name, &tag.Category, &tag.Description, &tag.Beasts); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// GetTag returns a single tag
+func GetTag(c *gin.Context) {
+	filter, args := visibilityFilter(CurrentPrincipal(c), 1)
+	var tag Tag
+	err := dbPool.QueryRow(c.Request.Context(), "SELECT "+tagColumns(filter)+" FROM tags WHERE name = $1",
+		append([]interface{}{strings.ToLower(c.Param("tag"))}, args...)...).
+		Scan(&tag.Name, &tag.Category, &tag.Description, &tag.Beasts)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Tag not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// bindTag reads a tag from the request body and normalizes its name and category.
+// It writes the error response and returns false if the tag is invalid.
+func bindTag(c *gin.Context) (Tag, bool) {
+	var tag Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return tag, false
+	}
+	name, err := normalizeTag(tag.Name)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return tag, false
+	}
+	tag.Name = name
+	if tag.Category != "" {
+		if tag.Category, err = normalizeTag(tag.Category); err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid category")
+			return tag, false
+		}
+	}
+	tag.Beasts = 0
+	return tag, true
+}
+
+// CreateTag creates a tag. Tags given to beasts are created on the fly, so this is mostly useful to
+// create them with a category and description.
+func CreateTag(c *gin.Context) {
+	tag, ok := bindTag(c)
+	if !ok {
+		return
+	}
+	cmdTag, err := dbPool.Exec(c.Request.Context(),
+		"INSERT INTO tags (name, category, description) VALUES ($1, $2, $3) ON CONFLICT (name) DO NOTHING",
+		tag.Name, tag.Category, tag.Description)
+	if err != nil {
+		requestLogger(c).Error("Error inserting into database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if cmdTag.RowsAffected() == 0 {
+		respondError(c, http.StatusConflict, "Tag already exists")
+		return
+	}
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTag changes the category and description of a tag and renames it, along with the beasts carrying it.
+// Each renamed beast gets an update in the audit log, a revision and an event.
+func UpdateTag(c *gin.Context) {
+	tag, ok := bindTag(c)
+	if !ok {
+		return
+	}
+	name := strings.ToLower(c.Param("tag"))
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	beasts, ok := lockTaggedBeasts(c, tx, name)
+	if !ok {
+		return
+	}
+	_, err = tx.Exec(ctx, "UPDATE tags SET name = $1, category = $2, description = $3 WHERE name = $4",
+		tag.Name, tag.Category, tag.Description, name)
+	if err != nil {
+		if isViolation(err, uniqueViolation) {
+			respondError(c, http.StatusConflict, "Tag already exists")
+			return
+		}
+		requestLogger(c).Error("Error updating database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if tag.Name == name {
+		beasts = nil
+	}
+	if !commitTagChange(c, tx, beasts, name, tag.Name) {
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag deletes a tag, removing it from all beasts. Each of them gets an update in the audit log, a
+// revision and an event.
+func DeleteTag(c *gin.Context) {
+	name := strings.ToLower(c.Param("tag"))
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	beasts, ok := lockTaggedBeasts(c, tx, name)
+	if !ok {
+		return
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM tags WHERE name = $1", name); err != nil {
+		requestLogger(c).Error("Error deleting from database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !commitTagChange(c, tx, beasts, name, "") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// lockTaggedBeasts locks a tag, so it is given to no other beast meanwhile, and the beasts carrying it, trashed
+// ones included, and returns those beasts. It writes the error response and returns false if there is no such tag.
+func lockTaggedBeasts(c *gin.Context, tx pgx.Tx, tag string) ([]Beast, bool) {
+	ctx := c.Request.Context()
+	err := tx.QueryRow(ctx, "SELECT name FROM tags WHERE name = $1 FOR UPDATE", tag).Scan(&tag)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Tag not found")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return nil, false
+	}
+
+	rows, err := tx.Query(ctx, "SELECT "+beastColumns+" FROM beasts WHERE beast_name IN (SELECT beast_name FROM beast_tags WHERE tag = $1) "+
+		"ORDER BY beast_name FOR UPDATE", tag)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	defer rows.Close()
+
+	var beasts []Beast
+	for rows.Next() {
+		var beast Beast
+		if err := scanBeast(rows, &beast); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return nil, false
+		}
+		beasts = append(beasts, beast)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return nil, false
+	}
+	return beasts, true
+}
+
+// commitTagChange records the change to the beasts whose tag old was renamed, or removed if renamed is
+// empty, and commits the transaction. It writes the error response and returns false on failure.
+func commitTagChange(c *gin.Context, tx pgx.Tx, beasts []Beast, old, renamed string) bool {
+	for _, before := range beasts {
+		after := before
+		after.Tags = slices.DeleteFunc(slices.Clone(before.Tags), func(t string) bool { return t == old })
+		if renamed != "" {
+			after.Tags = append(after.Tags, renamed)
+			slices.Sort(after.Tags)
+		}
+		if !recordBeastChange(c, tx, AuditUpdate, before.BeastName, &before, &after) {
+			return false
+		}
+	}
+	if err := tx.Commit(c.Request.Context()); err != nil {
+		requestLogger(c).Error("Error committing transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTaxonomy(t *testing.T) {
+	beast := Beast{Type: "Monstrosity (Shapechanger)", Size: " medium", Tags: []string{"Urban", "underdark", "urban "}}
+	require.NoError(t, normalizeTaxonomy(&beast))
+	assert.Equal(t, "Monstrosity", beast.Type)
+	assert.Equal(t, "Shapechanger", beast.Subtype)
+	assert.Equal(t, "Medium", beast.Size)
+	assert.Equal(t, []string{"underdark", "urban"}, beast.Tags)
+
+	// An explicit subtype keeps the type as it is
+	beast = Beast{Type: "Humanoid (any race)", Subtype: "elf"}
+	require.NoError(t, normalizeTaxonomy(&beast))
+	assert.Equal(t, "Humanoid (any race)", beast.Type)
+
+	assert.Error(t, normalizeTaxonomy(&Beast{Size: "Colossal"}))
+	assert.Error(t, normalizeTaxonomy(&Beast{Tags: []string{"a,b"}}))
+}
+
+func TestListTags(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, category, description, (SELECT count(*) FROM beast_tags JOIN beasts USING (beast_name) " +
+		"WHERE beast_tags.tag = tags.name AND deleted_at IS NULL AND visibility = 'public') FROM tags WHERE category = $1 ORDER BY name")).
+		WithArgs("environment").
+		WillReturnRows(mock.NewRows([]string{"name", "category", "description", "count"}).
+			AddRow("forest", "environment", "", 2).AddRow("urban", "environment", "Cities and towns", 0))
+
+	router := gin.Default()
+	router.GET("/tags", ListTags)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/tags?category=Environment", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"name":"forest","category":"environment","description":"","beasts":2},
+		{"name":"urban","category":"environment","description":"Cities and towns"}]`, w.Body.String())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+var tagLockQuery = regexp.QuoteMeta("SELECT name FROM tags WHERE name = $1 FOR UPDATE")
+
+// expectTaggedBeasts expects the tag to be locked along with the Mimic carrying it
+func expectTaggedBeasts(mock pgxmock.PgxPoolIface, tag string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(tagLockQuery).WithArgs(tag).WillReturnRows(mock.NewRows([]string{"name"}).AddRow(tag))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE beast_name IN (SELECT beast_name FROM beast_tags WHERE tag = $1) ORDER BY beast_name FOR UPDATE")).
+		WithArgs(tag).
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Mimic", "Monstrosity", "2", map[string]string{}, "", "dm-1", "public", "", 12, "9d8+18", "", "", "", []string{"underdark", tag}, "", 0))
+}
+
+// expectTagChange expects the Mimic's change to the given tags to be recorded and committed
+func expectTagChange(mock pgxmock.PgxPoolIface, tags []string) {
+	mock.ExpectExec(auditInsert).WithArgs("Mimic", pgxmock.AnyArg(), AuditUpdate, pgxmock.AnyArg(), pgxmock.AnyArg(), nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(revisionInsert).WithArgs("Mimic", pgxmock.AnyArg(), pgxmock.AnyArg(), nil).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	after, _ := json.Marshal(Beast{BeastName: "Mimic", Type: "Monstrosity", CR: "2", Attributes: map[string]string{}, Owner: "dm-1",
+		Visibility: "public", ArmorClass: 12, HitDice: "9d8+18", Tags: tags})
+	mock.ExpectExec(eventInsert).WithArgs("Mimic", AuditUpdate, after, pgxmock.AnyArg(), eventsLockKey).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+}
+
+func TestTagChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		expect func(mock pgxmock.PgxPoolIface)
+		code   int
+	}{
+		{"Create", "POST", "/tags", `{"name":"Swamp","category":"Environment"}`, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO tags (name, category, description)")).WithArgs("swamp", "environment", "").
+				WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		}, http.StatusCreated},
+		{"CreateExisting", "POST", "/tags", `{"name":"forest"}`, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO tags")).WithArgs("forest", "", "").
+				WillReturnResult(pgxmock.NewResult("INSERT", 0))
+		}, http.StatusConflict},
+		{"CreateInvalid", "POST", "/tags", `{"name":"  "}`, nil, http.StatusBadRequest},
+		{"Rename", "PUT", "/tags/woods", `{"name":"forest","category":"environment"}`, func(mock pgxmock.PgxPoolIface) {
+			expectTaggedBeasts(mock, "woods")
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE tags SET name = $1, category = $2, description = $3 WHERE name = $4")).
+				WithArgs("forest", "environment", "", "woods").
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			expectTagChange(mock, []string{"forest", "underdark"})
+		}, http.StatusOK},
+		{"Describe", "PUT", "/tags/woods", `{"name":"woods","description":"Trees"}`, func(mock pgxmock.PgxPoolIface) {
+			expectTaggedBeasts(mock, "woods")
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE tags")).WithArgs("woods", "", "Trees", "woods").
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			mock.ExpectCommit()
+		}, http.StatusOK},
+		{"RenameTaken", "PUT", "/tags/woods", `{"name":"forest"}`, func(mock pgxmock.PgxPoolIface) {
+			expectTaggedBeasts(mock, "woods")
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE tags")).WithArgs("forest", "", "", "woods").
+				WillReturnError(&pgconn.PgError{Code: "23505"})
+			mock.ExpectRollback()
+		}, http.StatusConflict},
+		{"UpdateMissing", "PUT", "/tags/woods", `{"name":"woods"}`, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(tagLockQuery).WithArgs("woods").WillReturnError(pgx.ErrNoRows)
+			mock.ExpectRollback()
+		}, http.StatusNotFound},
+		{"Delete", "DELETE", "/tags/woods", ``, func(mock pgxmock.PgxPoolIface) {
+			expectTaggedBeasts(mock, "woods")
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM tags WHERE name = $1")).WithArgs("woods").
+				WillReturnResult(pgxmock.NewResult("DELETE", 1))
+			expectTagChange(mock, []string{"underdark"})
+		}, http.StatusNoContent},
+		{"DeleteMissing", "DELETE", "/tags/forest", ``, func(mock pgxmock.PgxPoolIface) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(tagLockQuery).WithArgs("forest").WillReturnError(pgx.ErrNoRows)
+			mock.ExpectRollback()
+		}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+
+			router := gin.Default()
+			router.POST("/tags", CreateTag)
+			router.PUT("/tags/:tag", UpdateTag)
+			router.DELETE("/tags/:tag", DeleteTag)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupTestTracing records spans in memory for the duration of the test
+func setupTestTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+	return exporter
+}
+
+func TestTracing_GetItem(t *testing.T) {
+	exporter := setupTestTracing(t)
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(instrumentPool(mock))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE beast_name=$1")).
+		WithArgs("Owlbear").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "", "public", "", 0, "", "", "", "", []string{}, "", 0))
+	mock.ExpectQuery(imageQuery).WithArgs("Owlbear").WillReturnRows(mock.NewRows(imageRowColumns))
+
+	router := gin.New()
+	router.Use(RequestID(), Tracing())
+	router.GET("/beasts/:key", GetItem)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Owlbear", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(RequestIDHeader, "req-42")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	query, server := spans[0], spans[2]
+	assert.Equal(t, "select beast_images", spans[1].Name)
+
+	// The request span continues the caller's trace
+	assert.Equal(t, "GET /beasts/:key", server.Name)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Contains(t, server.Attributes, attribute.String("http.route", "/beasts/:key"))
+	assert.Contains(t, server.Attributes, attribute.String("request_id", "req-42"))
+
+	// The query is a child of the request span and carries no argument values
+	assert.Equal(t, "select beasts", query.Name)
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind)
+	assert.Equal(t, server.SpanContext.TraceID(), query.SpanContext.TraceID())
+	assert.Equal(t, server.SpanContext.SpanID(), query.Parent.SpanID())
+	assert.Contains(t, query.Attributes, attribute.String("db.operation.name", "select"))
+	assert.Contains(t, query.Attributes, attribute.String("db.collection.name", "beasts"))
+	for _, attr := range query.Attributes {
+		assert.NotContains(t, attr.Value.Emit(), "Owlbear")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestTracing_ServerError(t *testing.T) {
+	exporter := setupTestTracing(t)
+
+	router := gin.New()
+	router.Use(Tracing())
+	router.GET("/fail", func(c *gin.Context) { c.Status(http.StatusServiceUnavailable) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/fail", nil)
+	router.ServeHTTP(w, req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "Error", spans[0].Status.Code.String())
+	assert.Contains(t, spans[0].Attributes, attribute.Int("http.response.status_code", 503))
+	// Without a traceparent a new trace is started
+	assert.False(t, spans[0].Parent.IsValid())
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// TrashedBeast is a deleted beast waiting in the trash
+type TrashedBeast struct {
+	Beast
+	DeletedAt time.Time `json:"DeletedAt"`
+}
+
+// ListTrash returns the deleted beasts the caller may restore, most recently deleted first
+func ListTrash(c *gin.Context) {
+	principal := CurrentPrincipal(c)
+	query := "SELECT " + beastColumns + ", deleted_at FROM beasts WHERE deleted_at IS NOT NULL"
+	var args []interface{}
+	if !policy.Allows(principal, ActionDeleteAnyBeast) {
+		subject := ""
+		if principal != nil {
+			subject = principal.Subject
+		}
+		query += " AND owner = $1"
+		args = append(args, subject)
+	}
+
+	rows, err := dbPool.Query(c.Request.Context(), query+" ORDER BY deleted_at DESC", args...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	beasts := []TrashedBeast{}
+	for rows.Next() {
+		var b TrashedBeast
+		if err := scanBeast(rows, &b.Beast, &b.DeletedAt); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		beasts = append(beasts, b)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, beasts)
+}
+
+// RestoreItem takes a beast back out of the trash
+func RestoreItem(c *gin.Context) {
+	key := c.Param("key")
+
+	ctx := c.Request.Context()
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		requestLogger(c).Error("Error starting transaction", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var beast Beast
+	err = scanBeast(tx.QueryRow(ctx, "SELECT "+beastColumns+" FROM beasts WHERE beast_name=$1 AND deleted_at IS NOT NULL FOR UPDATE", key), &beast)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			respondError(c, http.StatusNotFound, "Beast not found in trash")
+		} else {
+			requestLogger(c).Error("Error querying database", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+	if !canModify(CurrentPrincipal(c), beast.Owner, ActionDeleteAnyBeast) {
+		abortWithProblem(c, http.StatusForbidden, "Only the owner or a moderator can restore this beast")
+		return
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE beasts SET deleted_at = NULL WHERE beast_name=$1", key)
+	if err != nil {
+		requestLogger(c).Error("Error updating database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if !recordChangeAndCommit(c, tx, AuditRestore, key, nil, &beast) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Beast restored successfully"})
+}
+
+// PurgeTrash permanently deletes beasts that have been in the trash for longer than retention,
+// along with their revisions and images, and returns how many beasts were purged
+func PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	cutoff := time.Now().Add(-retention)
+	_, err = tx.Exec(ctx, "DELETE FROM beast_revisions WHERE beast_name IN (SELECT beast_name FROM beasts WHERE deleted_at < $1)", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.Query(ctx, "DELETE FROM beast_images WHERE beast_name IN (SELECT beast_name FROM beasts WHERE deleted_at < $1) RETURNING key, thumbnail_key", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var files []string
+	for rows.Next() {
+		var key, thumbnailKey string
+		if err := rows.Scan(&key, &thumbnailKey); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		files = append(files, key, thumbnailKey)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	tag, err := tx.Exec(ctx, "DELETE FROM beasts WHERE deleted_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	// The image files go once nothing refers to them anymore
+	deleteImageFiles(ctx, files...)
+	return tag.RowsAffected(), nil
+}
+
+// PurgeTrashEvery runs PurgeTrash every interval until stop is closed
+func PurgeTrashEvery(interval, retention time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			purged, err := PurgeTrash(context.Background(), retention)
+			if err != nil {
+				logger.Error("Error purging trash", "err", err)
+			} else if purged > 0 {
+				logger.Info("Purged trash", "beasts", purged)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTrash(t *testing.T) {
+	deleted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		query     string
+		args      []interface{}
+	}{
+		{"OwnBeasts", &auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}, "WHERE deleted_at IS NOT NULL AND owner = $1 ORDER BY deleted_at DESC", []interface{}{"dm-1"}},
+		{"Moderator", &auth.Principal{Subject: "mod-1", Roles: []string{RoleModerator}}, "WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).WithArgs(tt.args...).
+				WillReturnRows(mock.NewRows(append(beastRowColumns, "deleted_at")).
+					AddRow("Elder Brain", "Aberration", "14", map[string]string{}, "", "dm-1", "private", "", 0, "", "", "", "", []string{}, "", 0, deleted))
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(tt.principal))
+			router.GET("/trash", ListTrash)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/trash", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `[{"BeastName":"Elder Brain","Type":"Aberration","CR":"14","Attributes":{},"Description":"",
+				"Owner":"dm-1","Visibility":"private","DeletedAt":"2024-05-01T12:00:00Z"}]`, w.Body.String())
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestRestoreItem(t *testing.T) {
+	trashQuery := regexp.QuoteMeta("FROM beasts WHERE beast_name=$1 AND deleted_at IS NOT NULL FOR UPDATE")
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		found     bool
+		code      int
+	}{
+		{"ByOwner", &auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}, true, http.StatusOK},
+		{"ByOtherUser", &auth.Principal{Subject: "dm-2", Roles: []string{RoleEditor}}, true, http.StatusForbidden},
+		{"NotInTrash", &auth.Principal{Subject: "dm-1", Roles: []string{RoleEditor}}, false, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+
+			mock.ExpectBegin()
+			rows := mock.NewRows(beastRowColumns)
+			if tt.found {
+				rows.AddRow("Elder Brain", "Aberration", "14", map[string]string{}, "", "dm-1", "private", "", 0, "", "", "", "", []string{}, "", 0)
+			}
+			mock.ExpectQuery(trashQuery).WithArgs("Elder Brain").WillReturnRows(rows)
+			if tt.code == http.StatusOK {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE beasts SET deleted_at = NULL WHERE beast_name=$1")).
+					WithArgs("Elder Brain").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectExec(auditInsert).
+					WithArgs("Elder Brain", "dm-1", AuditRestore, []byte(nil), pgxmock.AnyArg(), nil).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(revisionInsert).
+					WithArgs("Elder Brain", pgxmock.AnyArg(), "dm-1", nil).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(eventInsert).
+					WithArgs("Elder Brain", AuditRestore, pgxmock.AnyArg(), pgxmock.AnyArg(), eventsLockKey).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(tt.principal))
+			router.POST("/beasts/:key/restore", RestoreItem)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/beasts/Elder Brain/restore", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM beast_revisions WHERE beast_name IN (SELECT beast_name FROM beasts WHERE deleted_at < $1)")).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 5))
+	mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM beast_images WHERE beast_name IN (SELECT beast_name FROM beasts WHERE deleted_at < $1) RETURNING key, thumbnail_key")).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(mock.NewRows([]string{"key", "thumbnail_key"}))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM beasts WHERE deleted_at < $1")).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+	mock.ExpectCommit()
+
+	purged, err := PurgeTrash(context.Background(), 30*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/dice"
+)
+
+// feature is a named trait or action in a beast's description, such as
+// "Keen Sight and Smell. The owlbear has advantage on Wisdom (Perception) checks that rely on sight or smell."
+type feature struct {
+	Name   string
+	Text   string
+	Attack *dice.Attack
+	// Range is Melee, Ranged or "Melee or Ranged" for attacks, and Spell tells spell attacks from weapon attacks
+	Range string
+	Spell bool
+}
+
+var (
+	featurePattern = regexp.MustCompile(`^([A-Z][^.:]{0,60})\.\s+(.+)$`)
+	rangePattern   = regexp.MustCompile(`^(Melee or Ranged|Melee|Ranged) (Weapon|Spell) Attack:`)
+)
+
+// isAction reports whether the feature is an action rather than a trait. Only attacks and
+// multiattacks are told apart, as descriptions don't have sections.
+func (f feature) isAction() bool {
+	return f.Attack != nil || strings.EqualFold(f.Name, "Multiattack")
+}
+
+// parseFeatures splits a description into its features, one per line starting with a name.
+// Lines that don't start with a name continue the feature before them, or are returned as the
+// introduction when they come first.
+func parseFeatures(description string) (intro []string, features []feature) {
+	for _, line := range strings.Split(description, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m := featurePattern.FindStringSubmatch(line)
+		if m == nil {
+			if len(features) == 0 {
+				intro = append(intro, line)
+			} else {
+				features[len(features)-1].Text += "\n" + line
+			}
+			continue
+		}
+		f := feature{Name: strings.TrimSpace(m[1]), Text: m[2]}
+		if attacks := dice.FindAttacks(line); len(attacks) == 1 {
+			f.Attack = &attacks[0]
+			if r := rangePattern.FindStringSubmatch(f.Text); r != nil {
+				f.Range, f.Spell = r[1], r[2] == "Spell"
+			}
+		}
+		features = append(features, f)
+	}
+	return intro, features
+}
+
+// paragraphs writes each line of text as an HTML paragraph
+func paragraphs(lines ...string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		for _, l := range strings.Split(line, "\n") {
+			b.WriteString("<p>" + html.EscapeString(l) + "</p>")
+		}
+	}
+	return b.String()
+}
+
+// biography returns the introduction of a beast's description and the attribution its source asks for, in HTML
+func biography(intro []string, source *Source) string {
+	if source != nil && source.Attribution != "" {
+		intro = append(intro, source.Attribution)
+	}
+	return paragraphs(intro...)
+}
+
+// typeLine writes the size, type and alignment of a beast the way stat blocks do, such as
+// "Large monstrosity (shapechanger), unaligned"
+func typeLine(beast Beast) string {
+	s := strings.ToLower(beast.Type)
+	if beast.Subtype != "" {
+		s += " (" + strings.ToLower(beast.Subtype) + ")"
+	}
+	if beast.Size != "" {
+		s = beast.Size + " " + s
+	}
+	if beast.Alignment != "" {
+		s += ", " + beast.Alignment
+	}
+	return s
+}
+
+// ExportBeastFoundry returns a beast as a Foundry VTT actor of the dnd5e system
+func ExportBeastFoundry(c *gin.Context) {
+	exportBeast(c, func(beast Beast, source *Source) interface{} { return foundryActorOf(beast, source) })
+}
+
+// ExportBeastRoll20 returns a beast as a Roll20 character using the D&D 5E by Roll20 sheet
+func ExportBeastRoll20(c *gin.Context) {
+	exportBeast(c, func(beast Beast, source *Source) interface{} { return roll20CharacterOf(beast, source) })
+}
+
+// ExportFoundry returns the visible beasts matching the query parameters of BeastFilter as
+// Foundry VTT actors, to fill a compendium
+func ExportFoundry(c *gin.Context) {
+	exportCompendium(c, func(beast Beast, source *Source) interface{} { return foundryActorOf(beast, source) })
+}
+
+// ExportRoll20 returns the visible beasts matching the query parameters of BeastFilter as Roll20 characters
+func ExportRoll20(c *gin.Context) {
+	exportCompendium(c, func(beast Beast, source *Source) interface{} { return roll20CharacterOf(beast, source) })
+}
+
+func exportBeast(c *gin.Context, convert func(Beast, *Source) interface{}) {
+	beast, ok := loadBeast(c, c.Param("key"))
+	if !ok {
+		return
+	}
+	sources, ok := exportSources(c, []Beast{beast})
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, convert(beast, sourceOf(sources, beast.Source)))
+}
+
+func exportCompendium(c *gin.Context, convert func(Beast, *Source) interface{}) {
+	beasts, ok := findBeasts(c, filterFromQuery(c.Request.URL.Query()))
+	if !ok {
+		return
+	}
+	sources, ok := exportSources(c, beasts)
+	if !ok {
+		return
+	}
+	documents := []interface{}{}
+	for _, beast := range beasts {
+		documents = append(documents, convert(beast, sourceOf(sources, beast.Source)))
+	}
+	c.JSON(http.StatusOK, documents)
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var srd = Source{Abbreviation: "SRD", Title: "System Reference Document 5.1", License: "CC-BY-4.0",
+	Attribution: "This work includes material taken from the System Reference Document 5.1 by Wizards of the Coast LLC.", Open: true}
+
+var vttBeasts = map[string]Beast{
+	"owlbear": {
+		BeastName: "Owlbear", Type: "Monstrosity", Size: "Large", Alignment: "unaligned", CR: "3",
+		Attributes: map[string]string{"STR": "20 (+5)", "DEX": "12 (+1)", "CON": "17 (+3)", "INT": "3 (-4)", "WIS": "12 (+1)", "CHA": "7 (-2)", "Perception": "+3"},
+		Description: "Keen Sight and Smell. The owlbear has advantage on Wisdom (Perception) checks that rely on sight or smell.\n" +
+			"Multiattack. The owlbear makes two attacks: one with its beak and one with its claws.\n" +
+			"Beak. Melee Weapon Attack: +7 to hit, reach 5 ft., one creature. Hit: 10 (1d10 + 5) piercing damage.\n" +
+			"Claws. Melee Weapon Attack: +7 to hit, reach 5 ft., one target. Hit: 14 (2d8 + 5) slashing damage.",
+		ArmorClass: 13, HitDice: "7d10+21", Tags: []string{"forest"}, Source: "SRD", SourcePage: 249,
+	},
+	"mimic": {
+		BeastName: "Mimic", Type: "Monstrosity", Subtype: "Shapechanger", Size: "Medium", Alignment: "neutral", CR: "2",
+		Attributes: map[string]string{"STR": "17 (+3)", "DEX": "12 (+1)", "CON": "15 (+2)", "INT": "5 (-3)", "WIS": "13 (+1)", "CHA": "8 (-1)"},
+		Description: "Mimics take the shape of objects to lure their prey.\n" +
+			"Shapechanger. The mimic can use its action to polymorph into an object or back into its true, amorphous form.\n" +
+			"Its statistics are the same in each form.\n" +
+			"Pseudopod. Melee Weapon Attack: +5 to hit, reach 5 ft., one target. Hit: 7 (1d8 + 3) bludgeoning damage plus 4 (1d8) acid damage.",
+		ArmorClass: 12, HitDice: "9d8+18",
+	},
+	"swarm": {BeastName: "Swarm of Quippers", Type: "Swarm of Tiny beasts", CR: "unknown", Description: "Spit. Ranged Spell Attack: +2 to hit. Hit: 1 cold damage."},
+}
+
+// assertGolden compares v, as indented JSON, to testdata/<name>. Run the tests with -update to rewrite it.
+func assertGolden(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	require.NoError(t, encoder.Encode(v))
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestParseFeatures(t *testing.T) {
+	intro, features := parseFeatures(vttBeasts["mimic"].Description)
+
+	assert.Equal(t, []string{"Mimics take the shape of objects to lure their prey."}, intro)
+	require.Len(t, features, 2)
+	assert.Equal(t, "Shapechanger", features[0].Name)
+	assert.Contains(t, features[0].Text, "\nIts statistics are the same in each form.")
+	assert.False(t, features[0].isAction())
+	assert.Equal(t, "Pseudopod", features[1].Name)
+	require.NotNil(t, features[1].Attack)
+	assert.Equal(t, "Melee", features[1].Range)
+	assert.Len(t, features[1].Attack.Damage, 2)
+	assert.True(t, features[1].isAction())
+}
+
+func TestFoundryActor(t *testing.T) {
+	for name, beast := range vttBeasts {
+		t.Run(name, func(t *testing.T) {
+			var source *Source
+			if beast.Source == "SRD" {
+				source = &srd
+			}
+			assertGolden(t, name+".foundry.json", foundryActorOf(beast, source))
+		})
+	}
+}
+
+func TestRoll20Character(t *testing.T) {
+	for name, beast := range vttBeasts {
+		t.Run(name, func(t *testing.T) {
+			var source *Source
+			if beast.Source == "SRD" {
+				source = &srd
+			}
+			assertGolden(t, name+".roll20.json", roll20CharacterOf(beast, source))
+		})
+	}
+}
+
+func TestExportBeastFoundry(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND visibility = 'public'")).
+		WithArgs("Owlbear").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{"STR": "20 (+5)"}, "", "dm-1", "public", "", 13, "7d10+21", "", "Large", "unaligned", []string{}, "SRD", 249))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT abbreviation, title, license, attribution FROM sources WHERE abbreviation = ANY($1) ORDER BY abbreviation")).
+		WithArgs([]string{"SRD"}).
+		WillReturnRows(mock.NewRows(sourceRowColumns).AddRow(srd.Abbreviation, srd.Title, srd.License, srd.Attribution))
+
+	router := gin.Default()
+	router.GET("/beasts/:key/export/foundry", ExportBeastFoundry)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Owlbear/export/foundry", nil)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var actor foundryActor
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &actor))
+	assert.Equal(t, "Owlbear", actor.Name)
+	assert.Equal(t, 20, actor.System.Abilities["str"].Value)
+	assert.Equal(t, 59, actor.System.Attributes.HP.Max)
+	assert.Equal(t, foundrySourceInfo{Book: "SRD", Page: "249", License: "CC-BY-4.0"}, actor.System.Details.Source)
+	assert.Contains(t, actor.System.Details.Biography.Value, "System Reference Document 5.1 by Wizards of the Coast")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExportBeastRoll20_NotFound(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE beast_name=$1 AND deleted_at IS NULL AND visibility = 'public'")).
+		WithArgs("Tarrasque").
+		WillReturnRows(mock.NewRows(beastRowColumns))
+
+	router := gin.Default()
+	router.GET("/beasts/:key/export/roll20", ExportBeastRoll20)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/beasts/Tarrasque/export/roll20", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExportRoll20(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+	SetPolicy(DefaultPolicy())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM beasts WHERE deleted_at IS NULL AND lower(type) = lower($1) AND visibility = 'public' ORDER BY beast_name")).
+		WithArgs("Monstrosity").
+		WillReturnRows(mock.NewRows(beastRowColumns).
+			AddRow("Mimic", "Monstrosity", "2", map[string]string{}, "", "", "public", "", 12, "9d8+18", "Shapechanger", "Medium", "neutral", []string{}, "", 0).
+			AddRow("Owlbear", "Monstrosity", "3", map[string]string{}, "", "dm-1", "public", "", 13, "7d10+21", "", "Large", "unaligned", []string{"forest"}, "", 0))
+
+	router := gin.Default()
+	router.GET("/export/roll20", ExportRoll20)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/export/roll20?type=Monstrosity", nil)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var characters []roll20Export
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &characters))
+	require.Len(t, characters, 2)
+	assert.Equal(t, "Mimic", characters[0].Character.Name)
+	assert.Contains(t, characters[0].Character.Attribs, roll20Attrib{Name: "npc_type", Current: "Medium monstrosity (shapechanger), neutral"})
+	assert.Contains(t, characters[1].Character.Attribs, roll20Attrib{Name: "hp", Current: "59", Max: "59"})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
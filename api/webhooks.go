@@ -0,0 +1,359 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/webhook"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Default and maximum number of deliveries returned by ListWebhookDeliveries
+const (
+	defaultDeliveryLimit = 100
+	maxDeliveryLimit     = 1000
+)
+
+// Webhook is a URL notified of beast changes. The secret is only returned when the webhook is created.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an attempt, past or pending, to send an event to a webhook
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhook_id"`
+	EventID        int64      `json:"event_id"`
+	Action         string     `json:"action"`
+	BeastName      string     `json:"beast_name"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      *string    `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// webhookEvents are the actions a webhook can subscribe to
+var webhookEvents = map[string]bool{AuditCreate: true, AuditUpdate: true, AuditDelete: true, AuditRestore: true}
+
+// CreateWebhook registers a webhook. Without a secret one is generated; without events it receives all of them.
+func CreateWebhook(c *gin.Context) {
+	var hook Webhook
+	if err := c.ShouldBindJSON(&hook); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid input")
+		return
+	}
+	if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondError(c, http.StatusBadRequest, "Invalid url, expected an http or https URL")
+		return
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	for _, event := range hook.Events {
+		if !webhookEvents[event] {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Unknown event %q", event))
+			return
+		}
+	}
+	if hook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			requestLogger(c).Error("Error generating webhook secret", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		hook.Secret = hex.EncodeToString(secret)
+	}
+	hook.CreatedBy = actorOf(c)
+
+	err := dbPool.QueryRow(c.Request.Context(),
+		"INSERT INTO webhooks (url, secret, events, created_by) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		hook.URL, hook.Secret, hook.Events, hook.CreatedBy).Scan(&hook.ID, &hook.CreatedAt)
+	if err != nil {
+		requestLogger(c).Error("Error inserting into database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusCreated, hook)
+}
+
+// ListWebhooks returns the registered webhooks, without their secrets
+func ListWebhooks(c *gin.Context) {
+	rows, err := dbPool.Query(c.Request.Context(),
+		"SELECT id, url, events, created_by, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var hook Webhook
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.Events, &hook.CreatedBy, &hook.CreatedAt); err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+// DeleteWebhook removes a webhook along with its pending and past deliveries
+func DeleteWebhook(c *gin.Context) {
+	id, ok := webhookParam(c)
+	if !ok {
+		return
+	}
+
+	tag, err := dbPool.Exec(c.Request.Context(), "DELETE FROM webhooks WHERE id=$1", id)
+	if err != nil {
+		requestLogger(c).Error("Error deleting from database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		respondError(c, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook, newest first, optionally filtered by status
+func ListWebhookDeliveries(c *gin.Context) {
+	id, ok := webhookParam(c)
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT d.id, d.webhook_id, d.event_id, e.action, e.beast_name, d.status, d.attempts, d.next_attempt_at,
+			d.last_status_code, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d JOIN beast_events e ON e.id = d.event_id
+		WHERE d.webhook_id = $1`
+	args := []interface{}{id}
+	if status := c.Query("status"); status != "" {
+		if status != DeliveryPending && status != DeliveryDelivered && status != DeliveryFailed {
+			respondError(c, http.StatusBadRequest, "Invalid status, expected pending, delivered or failed")
+			return
+		}
+		args = append(args, status)
+		query += " AND d.status = $2"
+	}
+
+	limit := defaultDeliveryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid limit, expected 1 to %d", maxDeliveryLimit))
+			return
+		}
+		limit = n
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY d.id DESC LIMIT $%d", len(args))
+
+	rows, err := dbPool.Query(c.Request.Context(), query, args...)
+	if err != nil {
+		requestLogger(c).Error("Error querying database", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Action, &d.BeastName, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			requestLogger(c).Error("Error scanning row", "err", err)
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		// The next attempt time is only meaningful while the delivery is pending
+		if d.Status != DeliveryPending {
+			d.NextAttemptAt = nil
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		requestLogger(c).Error("Error reading rows", "err", err)
+		respondError(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// webhookParam parses the webhook ID in the path, writing a 400 response if it is invalid
+func webhookParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		respondError(c, http.StatusBadRequest, "Invalid webhook ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// WebhookOptions tunes webhook delivery. Failed deliveries are retried after BaseDelay, doubling up to
+// MaxDelay, and given up after MaxAttempts.
+type WebhookOptions struct {
+	Client      *http.Client
+	BatchSize   int
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// pendingDelivery is a delivery claimed by the worker, with the event to send
+type pendingDelivery struct {
+	id       int64
+	attempts int
+	url      string
+	secret   string
+	event    BeastEvent
+}
+
+// DeliverWebhooks sends the deliveries that are due and returns how many were attempted.
+// Claimed deliveries are leased by pushing their next attempt back, so replicas running the worker
+// concurrently do not send them twice and deliveries claimed by a replica that dies are retried.
+func DeliverWebhooks(ctx context.Context, opts WebhookOptions) (int, error) {
+	lease := time.Duration(opts.BatchSize+1) * opts.Client.Timeout
+	if lease <= 0 {
+		lease = time.Minute
+	}
+	rows, err := dbPool.Query(ctx, `
+		UPDATE webhook_deliveries d SET next_attempt_at = $1
+		FROM webhooks w, beast_events e
+		WHERE d.id IN (
+			SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at LIMIT $2 FOR UPDATE SKIP LOCKED
+		) AND w.id = d.webhook_id AND e.id = d.event_id
+		RETURNING d.id, d.attempts, w.url, w.secret, e.id, e.action, e.beast_name, e.data, e.created_at`,
+		time.Now().Add(lease), opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var due []pendingDelivery
+	for rows.Next() {
+		var d pendingDelivery
+		var data []byte
+		err := rows.Scan(&d.id, &d.attempts, &d.url, &d.secret,
+			&d.event.ID, &d.event.Action, &d.event.BeastName, &data, &d.event.Timestamp)
+		if err != nil {
+			return 0, err
+		}
+		d.event.Beast = &Beast{}
+		if err := json.Unmarshal(data, d.event.Beast); err != nil {
+			return 0, fmt.Errorf("decoding event %d: %w", d.event.ID, err)
+		}
+		due = append(due, d)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range due {
+		if err := deliver(ctx, opts, d); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// deliver sends one delivery and records the outcome, scheduling a retry if it failed
+func deliver(ctx context.Context, opts WebhookOptions, d pendingDelivery) error {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		return err
+	}
+	code, sendErr := webhook.Send(ctx, opts.Client, webhook.Delivery{
+		ID:     d.id,
+		URL:    d.url,
+		Secret: d.secret,
+		Event:  d.event.Action,
+		Body:   body,
+	})
+
+	attempts := d.attempts + 1
+	status, next := DeliveryDelivered, time.Now()
+	var lastCode *int
+	var lastError *string
+	if code != 0 {
+		lastCode = &code
+	}
+	if sendErr != nil {
+		msg := sendErr.Error()
+		lastError = &msg
+		status, next = DeliveryPending, time.Now().Add(webhook.Backoff(attempts, opts.BaseDelay, opts.MaxDelay))
+		if attempts >= opts.MaxAttempts {
+			status = DeliveryFailed
+		}
+		logger.Warn("Webhook delivery failed", "delivery_id", d.id, "attempts", attempts, "err", sendErr)
+	}
+
+	_, err = dbPool.Exec(ctx, `
+		UPDATE webhook_deliveries SET status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5,
+			last_error = $6, delivered_at = CASE WHEN $2 = 'delivered' THEN now() END
+		WHERE id = $1`,
+		d.id, status, attempts, next, lastCode, lastError)
+	return err
+}
+
+// DeliverWebhooksEvery sends due webhook deliveries every interval until stop is closed
+func DeliverWebhooksEvery(interval time.Duration, opts WebhookOptions, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// Keep going while full batches come back, so a backlog is not drained one batch per tick
+			for {
+				n, err := DeliverWebhooks(context.Background(), opts)
+				if err != nil {
+					logger.Error("Error delivering webhooks", "err", err)
+				}
+				if err != nil || n < opts.BatchSize {
+					break
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/keremenci/bestiary-crud/auth"
+	"github.com/keremenci/bestiary-crud/webhook"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	claimDeliveries = regexp.QuoteMeta("UPDATE webhook_deliveries d SET next_attempt_at = $1")
+	recordAttempt   = regexp.QuoteMeta("UPDATE webhook_deliveries SET status = $2, attempts = $3")
+	claimColumns    = []string{"id", "attempts", "url", "secret", "event_id", "action", "beast_name", "data", "created_at"}
+)
+
+func TestCreateWebhook(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"WithSecret", `{"url":"https://wiki.example.com/hooks/bestiary","secret":"s3cret","events":["create","delete"]}`, http.StatusCreated},
+		{"GeneratedSecret", `{"url":"https://wiki.example.com/hooks/bestiary"}`, http.StatusCreated},
+		{"InvalidURL", `{"url":"ftp://wiki.example.com"}`, http.StatusBadRequest},
+		{"UnknownEvent", `{"url":"https://wiki.example.com","events":["rename"]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("Unable to create mock database connection: %v", err)
+			}
+			defer mock.Close()
+			SetDBPool(mock)
+
+			created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			if tt.code == http.StatusCreated {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks (url, secret, events, created_by)")).
+					WithArgs("https://wiki.example.com/hooks/bestiary", pgxmock.AnyArg(), pgxmock.AnyArg(), "admin-1").
+					WillReturnRows(mock.NewRows([]string{"id", "created_at"}).AddRow(int64(3), created))
+			}
+
+			router := gin.Default()
+			router.Use(AssumePrincipal(&auth.Principal{Subject: "admin-1", Roles: []string{RoleAdmin}}))
+			router.POST("/webhooks", CreateWebhook)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/webhooks", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code == http.StatusCreated {
+				var hook Webhook
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+				assert.Equal(t, int64(3), hook.ID)
+				assert.NotEmpty(t, hook.Secret)
+				assert.NotNil(t, hook.Events)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestListWebhooks(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, url, events, created_by, created_at FROM webhooks ORDER BY id")).
+		WillReturnRows(mock.NewRows([]string{"id", "url", "events", "created_by", "created_at"}).
+			AddRow(int64(3), "https://wiki.example.com/hooks", []string{"create"}, "admin-1", created))
+
+	router := gin.Default()
+	router.GET("/webhooks", ListWebhooks)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/webhooks", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"id":3,"url":"https://wiki.example.com/hooks","events":["create"],"created_by":"admin-1",
+		"created_at":"2024-05-01T12:00:00Z"}]`, w.Body.String())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhooks WHERE id=$1")).WithArgs(int64(3)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhooks WHERE id=$1")).WithArgs(int64(4)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	router := gin.Default()
+	router.DELETE("/webhooks/:id", DeleteWebhook)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/webhooks/3", http.StatusNoContent},
+		{"/webhooks/4", http.StatusNotFound},
+		{"/webhooks/abc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", tt.path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.code, w.Code, tt.path)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListWebhookDeliveries(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("Unable to create mock database connection: %v", err)
+	}
+	defer mock.Close()
+	SetDBPool(mock)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	next := created.Add(time.Minute)
+	code := 503
+	msg := "receiver responded with 503 Service Unavailable"
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE d.webhook_id = $1 AND d.status = $2 ORDER BY d.id DESC LIMIT $3")).
+		WithArgs(int64(3), DeliveryPending, 10).
+		WillReturnRows(mock.NewRows([]string{"id", "webhook_id", "event_id", "action", "beast_name", "status", "attempts",
+			"next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"}).
+			AddRow(int64(9), int64(3), int64(42), AuditUpdate, "Owlbear", DeliveryPending, 2, &next, &code, &msg, created, (*time.Time)(nil)))
+
+	router := gin.Default()
+	router.GET("/webhooks/:id/deliveries", ListWebhookDeliveries)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/webhooks/3/deliveries?status=pending&limit=10", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"id":9,"webhook_id":3,"event_id":42,"action":"update","beast_name":"Owlbear","status":"pending",
+		"attempts":2,"next_attempt_at":"2024-05-01T12:01:00Z","last_status_code":503,
+		"last_error":"receiver responded with 503 Service Unavailable","created_at":"2024-05-01T12:00:00Z",
+		"delivered_at":null}]`, w.Body.String())
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/webhooks/3/deliveries?status=lost", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	var received []BeastEvent
+	status := http.StatusOK
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("s3cret", r.Header.Get(webhook.SignatureHeader), body, time.Now(), time.Minute); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event BeastEvent
+		json.Unmarshal(body, &event)
+		received = append(received, event)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	opts := WebhookOptions{Client: receiver.Client(), BatchSize: 10, MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	claim := func(mock pgxmock.PgxPoolIface, attempts int) {
+		mock.ExpectQuery(claimDeliveries).WithArgs(pgxmock.AnyArg(), 10).
+			WillReturnRows(mock.NewRows(claimColumns).
+				AddRow(int64(9), attempts, receiver.URL, "s3cret", int64(42), AuditUpdate, "Owlbear",
+					[]byte(`{"BeastName":"Owlbear","CR":"4"}`), created))
+	}
+
+	t.Run("Delivered", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatalf("Unable to create mock database connection: %v", err)
+		}
+		defer mock.Close()
+		SetDBPool(mock)
+
+		received, status = nil, http.StatusOK
+		claim(mock, 0)
+		mock.ExpectExec(recordAttempt).
+			WithArgs(int64(9), DeliveryDelivered, 1, pgxmock.AnyArg(), pgxmock.AnyArg(), (*string)(nil)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		n, err := DeliverWebhooks(context.Background(), opts)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		require.Len(t, received, 1)
+		assert.Equal(t, int64(42), received[0].ID)
+		assert.Equal(t, "4", received[0].Beast.CR)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("Retried", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatalf("Unable to create mock database connection: %v", err)
+		}
+		defer mock.Close()
+		SetDBPool(mock)
+
+		status = http.StatusServiceUnavailable
+		claim(mock, 1)
+		// The second failure waits twice the base delay
+		retryAt := timeArg{after: time.Now().Add(2 * time.Minute), before: time.Now().Add(3 * time.Minute)}
+		mock.ExpectExec(recordAttempt).
+			WithArgs(int64(9), DeliveryPending, 2, retryAt, pgxmock.AnyArg(), pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		_, err = DeliverWebhooks(context.Background(), opts)
+		require.NoError(t, err)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("GivenUp", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		if err != nil {
+			t.Fatalf("Unable to create mock database connection: %v", err)
+		}
+		defer mock.Close()
+		SetDBPool(mock)
+
+		status = http.StatusInternalServerError
+		claim(mock, 2)
+		mock.ExpectExec(recordAttempt).
+			WithArgs(int64(9), DeliveryFailed, 3, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		_, err = DeliverWebhooks(context.Background(), opts)
+		require.NoError(t, err)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
+
+// timeArg matches a time.Time argument within a range
+type timeArg struct {
+	after, before time.Time
+}
+
+func (a timeArg) Match(v interface{}) bool {
+	t, ok := v.(time.Time)
+	return ok && t.After(a.after) && t.Before(a.before)
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed or fail signature checks.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for tokens whose exp claim has passed.
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Principal is the authenticated identity behind a request.
+type Principal struct {
+	Subject   string
+	Roles     []string
+	Campaigns []string
+	Claims    map[string]interface{}
+}
+
+// HasRole reports whether the principal has the given role.
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyProvider looks up token verification keys by key ID.
+type KeyProvider interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// Config controls which tokens a Verifier accepts and how claims become roles.
+type Config struct {
+	// Issuer and Audience are checked against the iss and aud claims when set.
+	Issuer   string
+	Audience string
+	// ClockSkew is the tolerance applied to exp, nbf and iat.
+	ClockSkew time.Duration
+	// RolesClaim is a dot-separated path to the claim holding the roles, e.g. "realm_access.roles".
+	RolesClaim string
+	// RoleMapping translates claim values to API roles. When empty, claim values are used as-is.
+	RoleMapping map[string]string
+	// CampaignsClaim is a dot-separated path to the claim listing the campaigns the subject plays in.
+	CampaignsClaim string
+}
+
+// Verifier validates RS256 and ES256 signed JWTs.
+type Verifier struct {
+	keys KeyProvider
+	cfg  Config
+	now  func() time.Time
+}
+
+// NewVerifier returns a Verifier that checks signatures against keys.
+func NewVerifier(keys KeyProvider, cfg Config) *Verifier {
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "roles"
+	}
+	if cfg.CampaignsClaim == "" {
+		cfg.CampaignsClaim = "campaigns"
+	}
+	return &Verifier{keys: keys, cfg: cfg, now: time.Now}
+}
+
+// Verify checks the token's signature and registered claims and returns the principal it describes.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidToken)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	key, err := v.keys.Key(header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims", ErrInvalidToken)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	return &Principal{
+		Subject:   sub,
+		Roles:     v.roles(claims),
+		Campaigns: stringValues(claimAt(claims, v.cfg.CampaignsClaim)),
+		Claims:    claims,
+	}, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key type does not match RS256")
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve.Params().Name != "P-256" {
+			return errors.New("key type does not match ES256")
+		}
+		if len(sig) != 64 {
+			return errors.New("bad ES256 signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+func (v *Verifier) validateClaims(claims map[string]interface{}) error {
+	now := v.now()
+	skew := v.cfg.ClockSkew
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if now.After(exp.Add(skew)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(skew).Before(nbf) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	if iat, ok := numericDate(claims["iat"]); ok && now.Add(skew).Before(iat) {
+		return fmt.Errorf("%w: token issued in the future", ErrInvalidToken)
+	}
+
+	if v.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+			return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+		}
+	}
+	if v.cfg.Audience != "" && !containsString(claims["aud"], v.cfg.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+}
+
+func containsString(v interface{}, want string) bool {
+	for _, s := range stringValues(v) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// stringValues returns a claim as a list of strings. Space-separated strings
+// (as used by the scope claim) are split.
+func stringValues(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return strings.Fields(val)
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// claimAt follows a dot-separated path through nested claims.
+func claimAt(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+	return value
+}
+
+func (v *Verifier) roles(claims map[string]interface{}) []string {
+	var roles []string
+	for _, r := range stringValues(claimAt(claims, v.cfg.RolesClaim)) {
+		if len(v.cfg.RoleMapping) == 0 {
+			roles = append(roles, r)
+		} else if mapped, ok := v.cfg.RoleMapping[r]; ok {
+			roles = append(roles, mapped)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signToken creates a compact JWT signed with the given private key
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// writeJWKS writes the public halves of keys as a JWKS file at path
+func writeJWKS(t *testing.T, path string, keys map[string]crypto.Signer) {
+	t.Helper()
+	var entries []map[string]string
+	for kid, key := range keys {
+		switch pub := key.Public().(type) {
+		case *rsa.PublicKey:
+			entries = append(entries, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+				"n": base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			entries = append(entries, map[string]string{
+				"kty": "EC", "kid": kid, "use": "sig", "alg": "ES256", "crv": "P-256",
+				"x": base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+				"y": base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": entries})
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func generateKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return rsaKey, ecKey
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, ecKey := generateKeys(t)
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, map[string]crypto.Signer{"rsa-1": rsaKey, "ec-1": ecKey})
+
+	keys, err := NewKeySet(jwksPath, time.Minute)
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	verifier := NewVerifier(keys, Config{
+		Issuer:      "https://idp.example",
+		Audience:    "bestiary",
+		ClockSkew:   30 * time.Second,
+		RolesClaim:  "realm_access.roles",
+		RoleMapping: map[string]string{"bestiary-dm": "editor"},
+	})
+	verifier.now = func() time.Time { return now }
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":          "dm-1",
+			"iss":          "https://idp.example",
+			"aud":          []string{"bestiary", "other"},
+			"exp":          now.Add(time.Hour).Unix(),
+			"iat":          now.Unix(),
+			"realm_access": map[string]interface{}{"roles": []string{"bestiary-dm", "offline_access"}},
+			"campaigns":    []string{"curse-of-strahd"},
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"RS256", signToken(t, "RS256", "rsa-1", rsaKey, claims(nil)), nil},
+		{"ES256", signToken(t, "ES256", "ec-1", ecKey, claims(nil)), nil},
+		{"ExpiredWithinSkew", signToken(t, "RS256", "rsa-1", rsaKey, claims(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()})), nil},
+		{"Expired", signToken(t, "RS256", "rsa-1", rsaKey, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})), ErrTokenExpired},
+		{"NotYetValid", signToken(t, "RS256", "rsa-1", rsaKey, claims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()})), ErrInvalidToken},
+		{"WrongIssuer", signToken(t, "RS256", "rsa-1", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example"})), ErrInvalidToken},
+		{"WrongAudience", signToken(t, "RS256", "rsa-1", rsaKey, claims(map[string]interface{}{"aud": "other"})), ErrInvalidToken},
+		{"AlgorithmMismatch", signToken(t, "ES256", "rsa-1", ecKey, claims(nil)), ErrInvalidToken},
+		{"UnknownKid", signToken(t, "RS256", "rsa-2", rsaKey, claims(nil)), ErrInvalidToken},
+		{"Malformed", "not-a-jwt", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := verifier.Verify(tt.token)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "dm-1", principal.Subject)
+			assert.Equal(t, []string{"editor"}, principal.Roles)
+			assert.Equal(t, []string{"curse-of-strahd"}, principal.Campaigns)
+		})
+	}
+
+	t.Run("TamperedPayload", func(t *testing.T) {
+		token := signToken(t, "RS256", "rsa-1", rsaKey, claims(nil))
+		forged := signToken(t, "RS256", "rsa-1", rsaKey, claims(map[string]interface{}{"sub": "admin"}))
+		parts := strings.Split(token, ".")
+		forgedParts := strings.Split(forged, ".")
+		_, err := verifier.Verify(parts[0] + "." + forgedParts[1] + "." + parts[2])
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestVerify_KeyRotation(t *testing.T) {
+	oldKey, _ := generateKeys(t)
+	newKey, _ := generateKeys(t)
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, map[string]crypto.Signer{"old": oldKey})
+
+	keys, err := NewKeySet(jwksPath, 0)
+	require.NoError(t, err)
+	verifier := NewVerifier(keys, Config{})
+
+	claims := map[string]interface{}{"sub": "dm-1", "exp": time.Now().Add(time.Hour).Unix(), "roles": "viewer editor"}
+	_, err = verifier.Verify(signToken(t, "RS256", "new", newKey, claims))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Rotate: the new key is published and the old one retired
+	writeJWKS(t, jwksPath, map[string]crypto.Signer{"new": newKey})
+
+	principal, err := verifier.Verify(signToken(t, "RS256", "new", newKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"viewer", "editor"}, principal.Roles)
+
+	_, err = verifier.Verify(signToken(t, "RS256", "old", oldKey, claims))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerify_RefreshCooldown(t *testing.T) {
+	oldKey, _ := generateKeys(t)
+	newKey, _ := generateKeys(t)
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, map[string]crypto.Signer{"old": oldKey})
+
+	keys, err := NewKeySet(jwksPath, time.Hour)
+	require.NoError(t, err)
+	writeJWKS(t, jwksPath, map[string]crypto.Signer{"new": newKey})
+
+	// Unknown kids do not trigger a refetch until the cooldown has passed
+	_, err = keys.Key("new")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	require.NoError(t, keys.Refresh())
+	_, err = keys.Key("new")
+	assert.NoError(t, err)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"sync"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -10,8 +11,111 @@ import (
 // bestiaryConfig holds the configuration details
 // Each field can have a corresponding environment variable.
 type bestiaryConfig struct {
-	DatabaseUrl string `yaml:"db_url"`
-	Port        string `yaml:"port"`
+	DatabaseUrl string     `yaml:"db_url"`
+	Port        string     `yaml:"port"`
+	Auth        authConfig `yaml:"auth"`
+	RBAC        rbacConfig `yaml:"rbac"`
+	// TrustedProxies are the addresses allowed to set X-Forwarded-For, e.g. the nginx in front of the API
+	TrustedProxies []string         `yaml:"trusted_proxies"`
+	RateLimit      rateLimitConfig  `yaml:"rate_limit"`
+	Log            logConfig        `yaml:"log"`
+	Metrics        metricsConfig    `yaml:"metrics"`
+	Tracing        tracingConfig    `yaml:"tracing"`
+	Trash          trashConfig      `yaml:"trash"`
+	Webhooks       webhooksConfig   `yaml:"webhooks"`
+	Encounters     encountersConfig `yaml:"encounters"`
+	Images         imagesConfig     `yaml:"images"`
+}
+
+// imagesConfig sets the directory uploaded beast images are kept in, empty to disable uploads, and limits
+// them to MaxSizeMB megabytes, MaxDimension pixels on either side and MaxMegapixels million pixels in all.
+// Thumbnails fit in ThumbnailSize pixels.
+type imagesConfig struct {
+	Dir           string `yaml:"dir"`
+	MaxSizeMB     int    `yaml:"max_size_mb"`
+	MaxDimension  int    `yaml:"max_dimension"`
+	MaxMegapixels int    `yaml:"max_megapixels"`
+	ThumbnailSize int    `yaml:"thumbnail_size"`
+}
+
+// encountersConfig sets what deleting a beast used by saved encounters does: "restrict" or "cascade"
+type encountersConfig struct {
+	OnBeastDelete string `yaml:"on_beast_delete"`
+}
+
+// webhooksConfig tunes webhook delivery: due deliveries are sent every PollInterval, BatchSize at a time,
+// and failed ones are retried after RetryDelay, doubling up to MaxRetryDelay, until MaxAttempts.
+type webhooksConfig struct {
+	PollInterval  time.Duration `yaml:"poll_interval"`
+	Timeout       time.Duration `yaml:"timeout"`
+	BatchSize     int           `yaml:"batch_size"`
+	MaxAttempts   int           `yaml:"max_attempts"`
+	RetryDelay    time.Duration `yaml:"retry_delay"`
+	MaxRetryDelay time.Duration `yaml:"max_retry_delay"`
+}
+
+// trashConfig sets how many days deleted beasts stay restorable before they are purged,
+// checked every PurgeInterval. A RetentionDays of 0 keeps them forever.
+type trashConfig struct {
+	RetentionDays int           `yaml:"retention_days"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// tracingConfig selects the span exporter: "otlp" (OTLP/HTTP to Endpoint), "stdout" or empty to disable
+type tracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// metricsConfig sets the path Prometheus metrics are served on. An empty path disables the endpoint.
+type metricsConfig struct {
+	Path string `yaml:"path"`
+}
+
+// logConfig selects the log level (debug, info, warn, error) and format (json, text)
+type logConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// authConfig holds the bearer token settings. Authentication is enabled when
+// either JWKSFile or JWKSUrl is set.
+type authConfig struct {
+	JWKSFile       string            `yaml:"jwks_file"`
+	JWKSUrl        string            `yaml:"jwks_url"`
+	JWKSRefresh    time.Duration     `yaml:"jwks_refresh"`
+	Issuer         string            `yaml:"issuer"`
+	Audience       string            `yaml:"audience"`
+	ClockSkew      time.Duration     `yaml:"clock_skew"`
+	RolesClaim     string            `yaml:"roles_claim"`
+	RoleMapping    map[string]string `yaml:"role_mapping"`
+	CampaignsClaim string            `yaml:"campaigns_claim"`
+	// LocalAdmin makes every request act as an admin when no JWKS is configured. Only meant for local development.
+	LocalAdmin bool `yaml:"local_admin"`
+}
+
+// rbacConfig overrides entries of the default access control policy.
+// Policy maps an action such as "beasts:delete" to the roles allowed to perform it.
+type rbacConfig struct {
+	Policy map[string][]string `yaml:"policy"`
+}
+
+// rateLimitConfig holds a token bucket per route group ("read", "write").
+// Groups without an entry are not limited.
+type rateLimitConfig struct {
+	APIKeyHeader string `yaml:"api_key_header"`
+	// APIKeys are the hex SHA-256 digests of the issued API keys
+	APIKeys []string                  `yaml:"api_keys"`
+	Groups  map[string]rateLimitGroup `yaml:"groups"`
+}
+
+// rateLimitGroup allows Burst requests at once, refilled at Rate requests per second
+type rateLimitGroup struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
 }
 
 var appConfig bestiaryConfig
@@ -42,6 +146,13 @@ func GetAppConfig(filepath string) *bestiaryConfig {
 		// Override config entries with environment variables if they are set
 		appConfig.DatabaseUrl = GetEnv("BESTIARY_DATABASE_URL", appConfig.DatabaseUrl)
 		appConfig.Port = GetEnv("BESTIARY_PORT", appConfig.Port)
+		appConfig.Log.Level = GetEnv("BESTIARY_LOG_LEVEL", appConfig.Log.Level)
+		appConfig.Log.Format = GetEnv("BESTIARY_LOG_FORMAT", appConfig.Log.Format)
+		appConfig.Tracing.Exporter = GetEnv("BESTIARY_TRACING_EXPORTER", appConfig.Tracing.Exporter)
+		appConfig.Tracing.Endpoint = GetEnv("BESTIARY_TRACING_ENDPOINT", appConfig.Tracing.Endpoint)
+		appConfig.Auth.JWKSFile = GetEnv("BESTIARY_JWKS_FILE", appConfig.Auth.JWKSFile)
+		appConfig.Auth.JWKSUrl = GetEnv("BESTIARY_JWKS_URL", appConfig.Auth.JWKSUrl)
+		appConfig.Images.Dir = GetEnv("BESTIARY_IMAGES_DIR", appConfig.Images.Dir)
 	})
 
 	return &appConfig
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS beasts_owner_idx;
+
+ALTER TABLE beasts
+    DROP CONSTRAINT IF EXISTS beasts_campaign_visibility,
+    DROP COLUMN IF EXISTS campaign,
+    DROP COLUMN IF EXISTS visibility,
+    DROP COLUMN IF EXISTS owner;
+
+DROP TYPE IF EXISTS beast_visibility;
@@ -0,0 +1,10 @@
+CREATE TYPE beast_visibility AS ENUM ('private', 'campaign', 'public');
+
+-- Existing beasts have no owner and stay public
+ALTER TABLE beasts
+    ADD COLUMN owner TEXT,
+    ADD COLUMN visibility beast_visibility NOT NULL DEFAULT 'public',
+    ADD COLUMN campaign TEXT,
+    ADD CONSTRAINT beasts_campaign_visibility CHECK (visibility <> 'campaign' OR campaign IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS beasts_owner_idx ON beasts (owner);
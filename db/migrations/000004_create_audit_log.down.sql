@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS audit_log_actor_idx;
+DROP INDEX IF EXISTS audit_log_beast_idx;
+
+DROP TABLE IF EXISTS audit_log;
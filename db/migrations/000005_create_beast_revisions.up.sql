@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS beast_revisions (
+    beast_name TEXT NOT NULL,
+    revision INTEGER NOT NULL,
+    data JSONB NOT NULL,
+    author TEXT NOT NULL,
+    request_id TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (beast_name, revision)
+);
+
+-- Existing beasts start with their current state as the first revision
+INSERT INTO beast_revisions (beast_name, revision, data, author)
+SELECT beast_name, 1, jsonb_strip_nulls(jsonb_build_object(
+    'BeastName', beast_name,
+    'Type', type,
+    'CR', cr,
+    'Attributes', attributes,
+    'Description', description,
+    'Owner', owner,
+    'Visibility', visibility,
+    'Campaign', campaign
+)), 'system'
+FROM beasts
+ON CONFLICT DO NOTHING;
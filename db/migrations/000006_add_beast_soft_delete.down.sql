@@ -0,0 +1,9 @@
+DELETE FROM audit_log WHERE action = 'restore';
+ALTER TABLE audit_log DROP CONSTRAINT IF EXISTS audit_log_action_check;
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_action_check CHECK (action IN ('create', 'update', 'delete'));
+
+DROP INDEX IF EXISTS beasts_deleted_at_idx;
+
+-- Beasts still in the trash were deleted
+DELETE FROM beasts WHERE deleted_at IS NOT NULL;
+ALTER TABLE beasts DROP COLUMN IF EXISTS deleted_at;
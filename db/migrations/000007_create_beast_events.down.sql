@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS beast_events_notify ON beast_events;
+DROP FUNCTION IF EXISTS notify_beast_event();
+
+DROP TABLE IF EXISTS beast_events;
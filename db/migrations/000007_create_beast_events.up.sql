@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS beast_events (
+    id BIGSERIAL PRIMARY KEY,
+    beast_name TEXT NOT NULL,
+    action TEXT NOT NULL,
+    data JSONB NOT NULL,
+    -- The beast before an update, so streams know who could see it until then
+    before JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Wake up the API replicas listening for changes. The payload is the event ID; listeners read the
+-- events themselves so payload size limits do not matter.
+CREATE OR REPLACE FUNCTION notify_beast_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('beast_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER beast_events_notify
+    AFTER INSERT ON beast_events
+    FOR EACH ROW EXECUTE FUNCTION notify_beast_event();
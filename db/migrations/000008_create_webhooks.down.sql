@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS beast_events_webhooks ON beast_events;
+DROP FUNCTION IF EXISTS enqueue_webhook_deliveries();
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
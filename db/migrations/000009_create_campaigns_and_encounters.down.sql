@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS encounter_beasts;
+DROP TABLE IF EXISTS encounters;
+DROP TABLE IF EXISTS campaigns;
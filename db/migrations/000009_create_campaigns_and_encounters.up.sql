@@ -0,0 +1,32 @@
+-- Campaigns are identified by the same slug beasts are shared with and tokens list in their campaigns claim
+CREATE TABLE IF NOT EXISTS campaigns (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    owner TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS encounters (
+    id BIGSERIAL PRIMARY KEY,
+    campaign_id TEXT NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    owner TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS encounters_campaign_idx ON encounters (campaign_id);
+
+-- Deleting a beast goes through the trash, where encounters.on_beast_delete decides whether references
+-- block the delete or are removed. Purging a beast from the trash removes any left.
+CREATE TABLE IF NOT EXISTS encounter_beasts (
+    encounter_id BIGINT NOT NULL REFERENCES encounters (id) ON DELETE CASCADE,
+    beast_name TEXT NOT NULL REFERENCES beasts (beast_name) ON DELETE CASCADE,
+    position INT NOT NULL,
+    count INT NOT NULL CHECK (count > 0),
+    PRIMARY KEY (encounter_id, beast_name)
+);
+
+CREATE INDEX IF NOT EXISTS encounter_beasts_beast_idx ON encounter_beasts (beast_name);
@@ -0,0 +1,9 @@
+ALTER TABLE IF EXISTS combat_sessions DROP CONSTRAINT IF EXISTS combat_sessions_current_combatant_fkey;
+DROP TABLE IF EXISTS combatants;
+DROP TABLE IF EXISTS combat_sessions;
+
+ALTER TABLE beasts
+    DROP COLUMN IF EXISTS hit_dice,
+    DROP COLUMN IF EXISTS armor_class;
+
+UPDATE beast_revisions SET data = data - 'ArmorClass' - 'HitDice';
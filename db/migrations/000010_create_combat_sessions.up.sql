@@ -0,0 +1,54 @@
+-- Armor class 0 and empty hit dice mean the stat block does not give them
+ALTER TABLE beasts
+    ADD COLUMN armor_class INT NOT NULL DEFAULT 0 CHECK (armor_class BETWEEN 0 AND 30),
+    ADD COLUMN hit_dice TEXT NOT NULL DEFAULT '';
+
+UPDATE beasts SET armor_class = 13, hit_dice = '7d10+21' WHERE beast_name = 'Owlbear';
+UPDATE beasts SET armor_class = 12, hit_dice = '9d8+18' WHERE beast_name = 'Mimic';
+UPDATE beasts SET armor_class = 10, hit_dice = '20d10+100' WHERE beast_name = 'Elder Brain';
+UPDATE beasts SET armor_class = 15, hit_dice = '13d8+13' WHERE beast_name = 'Mind Flayer';
+UPDATE beasts SET armor_class = 13, hit_dice = '10d10+30' WHERE beast_name = 'Displacer Beast';
+
+-- Earlier revisions predate armor class and hit dice. They take the values given above, so restoring
+-- one does not clear them.
+UPDATE beast_revisions r
+SET data = r.data || jsonb_strip_nulls(jsonb_build_object(
+    'ArmorClass', NULLIF(b.armor_class, 0),
+    'HitDice', NULLIF(b.hit_dice, '')
+))
+FROM beasts b
+WHERE b.beast_name = r.beast_name;
+
+CREATE TABLE IF NOT EXISTS combat_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    round INT NOT NULL DEFAULT 1,
+    current_combatant BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS combat_sessions_owner_idx ON combat_sessions (owner);
+
+-- Combatants copy the stats of the beast they were spawned from, so later edits or deletes of the beast
+-- do not change a running fight. Combatants without a beast are player characters, whose hit points
+-- are only tracked when max_hp is set.
+CREATE TABLE IF NOT EXISTS combatants (
+    id BIGSERIAL PRIMARY KEY,
+    session_id BIGINT NOT NULL REFERENCES combat_sessions (id) ON DELETE CASCADE,
+    beast_name TEXT,
+    name TEXT NOT NULL,
+    initiative INT NOT NULL,
+    dex_modifier INT NOT NULL DEFAULT 0,
+    armor_class INT NOT NULL DEFAULT 0,
+    max_hp INT NOT NULL DEFAULT 0,
+    current_hp INT NOT NULL DEFAULT 0,
+    conditions TEXT[] NOT NULL DEFAULT '{}',
+    CHECK (current_hp BETWEEN 0 AND max_hp)
+);
+
+CREATE INDEX IF NOT EXISTS combatants_session_idx ON combatants (session_id);
+
+ALTER TABLE combat_sessions ADD CONSTRAINT combat_sessions_current_combatant_fkey
+    FOREIGN KEY (current_combatant) REFERENCES combatants (id) ON DELETE SET NULL;
@@ -0,0 +1,4 @@
+UPDATE beasts SET description = replace(description, E'\nBeak. Melee Weapon Attack: +7 to hit, reach 5 ft., one creature. Hit: 10 (1d10 + 5) piercing damage.\nClaws. Melee Weapon Attack: +7 to hit, reach 5 ft., one target. Hit: 14 (2d8 + 5) slashing damage.', '') WHERE beast_name = 'Owlbear';
+UPDATE beasts SET description = replace(description, E'\nPseudopod. Melee Weapon Attack: +5 to hit, reach 5 ft., one target. Hit: 7 (1d8 + 3) bludgeoning damage. If the mimic is in object form, the target is subjected to its Adhesive trait.\nBite. Melee Weapon Attack: +5 to hit, reach 5 ft., one target. Hit: 7 (1d8 + 3) piercing damage plus 4 (1d8) acid damage.', '') WHERE beast_name = 'Mimic';
+UPDATE beasts SET description = replace(description, E'\nTentacles. Melee Weapon Attack: +7 to hit, reach 5 ft., one creature. Hit: 15 (2d10 + 4) psychic damage.', '') WHERE beast_name = 'Mind Flayer';
+UPDATE beasts SET description = replace(description, E'\nTentacle. Melee Weapon Attack: +6 to hit, reach 10 ft., one target. Hit: 7 (1d6 + 4) bludgeoning damage plus 3 (1d6) piercing damage.', '') WHERE beast_name = 'Displacer Beast';
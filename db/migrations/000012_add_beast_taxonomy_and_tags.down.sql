@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS beast_tags;
+DROP TABLE IF EXISTS tags;
+
+UPDATE beasts SET type = type || ' (' || subtype || ')' WHERE subtype <> '';
+
+UPDATE beast_revisions
+SET data = jsonb_set(data, '{Type}', to_jsonb(concat(data->>'Type', ' (', data->>'Subtype', ')')))
+WHERE data->>'Subtype' <> '';
+UPDATE beast_revisions SET data = data - 'Subtype' - 'Size' - 'Alignment' - 'Tags';
+
+ALTER TABLE beasts
+    DROP COLUMN IF EXISTS alignment,
+    DROP COLUMN IF EXISTS size,
+    DROP COLUMN IF EXISTS subtype;
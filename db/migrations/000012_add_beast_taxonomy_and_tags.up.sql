@@ -0,0 +1,70 @@
+-- Type used to carry the subtype in parentheses, as in "Aberration (Mind Flayer)". Empty size and
+-- alignment mean the stat block does not give them.
+ALTER TABLE beasts
+    ADD COLUMN subtype TEXT NOT NULL DEFAULT '',
+    ADD COLUMN size TEXT NOT NULL DEFAULT ''
+        CHECK (size IN ('', 'Tiny', 'Small', 'Medium', 'Large', 'Huge', 'Gargantuan')),
+    ADD COLUMN alignment TEXT NOT NULL DEFAULT '';
+
+UPDATE beasts
+SET subtype = trim(substring(type FROM '\(([^)]*)\)\s*$')),
+    type = trim(substring(type FROM '^[^(]*'))
+WHERE type ~ '\([^)]*\)\s*$';
+
+UPDATE beasts SET size = 'Large', alignment = 'unaligned' WHERE beast_name = 'Owlbear';
+UPDATE beasts SET size = 'Medium', alignment = 'neutral' WHERE beast_name = 'Mimic';
+UPDATE beasts SET size = 'Large', alignment = 'lawful evil' WHERE beast_name = 'Elder Brain';
+UPDATE beasts SET size = 'Medium', alignment = 'lawful evil' WHERE beast_name = 'Mind Flayer';
+UPDATE beasts SET size = 'Large', alignment = 'lawful evil' WHERE beast_name = 'Displacer Beast';
+
+-- Tags are free-form labels such as an environment, a source book or "homebrew". The category groups
+-- them; encounter generation reads the environment ones.
+CREATE TABLE IF NOT EXISTS tags (
+    name TEXT PRIMARY KEY,
+    category TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS beast_tags (
+    beast_name TEXT NOT NULL REFERENCES beasts (beast_name) ON UPDATE CASCADE ON DELETE CASCADE,
+    tag TEXT NOT NULL REFERENCES tags (name) ON UPDATE CASCADE ON DELETE CASCADE,
+    PRIMARY KEY (beast_name, tag)
+);
+
+CREATE INDEX IF NOT EXISTS beast_tags_tag_idx ON beast_tags (tag);
+
+INSERT INTO tags (name, category) VALUES
+('forest', 'environment'),
+('underdark', 'environment'),
+('urban', 'environment')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO beast_tags (beast_name, tag)
+SELECT beast_name, tag FROM (VALUES
+    ('Owlbear', 'forest'),
+    ('Displacer Beast', 'forest'),
+    ('Mimic', 'underdark'),
+    ('Mimic', 'urban'),
+    ('Elder Brain', 'underdark'),
+    ('Mind Flayer', 'underdark')
+) AS seed (beast_name, tag)
+WHERE EXISTS (SELECT 1 FROM beasts WHERE beasts.beast_name = seed.beast_name)
+ON CONFLICT DO NOTHING;
+
+-- Earlier revisions predate the taxonomy and tags. Their type is split the same way, and they take
+-- the size, alignment and tags given above, so restoring one does not clear them.
+UPDATE beast_revisions
+SET data = jsonb_set(
+    jsonb_set(data, '{Type}', to_jsonb(trim(substring(data->>'Type' FROM '^[^(]*')))),
+    '{Subtype}', to_jsonb(trim(substring(data->>'Type' FROM '\(([^)]*)\)\s*$'))))
+WHERE data->>'Type' ~ '\([^)]*\)\s*$';
+
+UPDATE beast_revisions r
+SET data = r.data || jsonb_strip_nulls(jsonb_build_object(
+    'Size', NULLIF(b.size, ''),
+    'Alignment', NULLIF(b.alignment, ''),
+    'Tags', (SELECT jsonb_agg(t.tag ORDER BY t.tag) FROM beast_tags t WHERE t.beast_name = b.beast_name)
+))
+FROM beasts b
+WHERE b.beast_name = r.beast_name;
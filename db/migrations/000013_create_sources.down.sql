@@ -0,0 +1,7 @@
+ALTER TABLE beasts
+    DROP COLUMN IF EXISTS source_page,
+    DROP COLUMN IF EXISTS source;
+
+UPDATE beast_revisions SET data = data - 'Source' - 'SourcePage';
+
+DROP TABLE IF EXISTS sources;
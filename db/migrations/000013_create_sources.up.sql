@@ -0,0 +1,37 @@
+-- Sources are the books and documents beasts come from. The license decides whether a beast may be
+-- published, and the attribution is the notice its license asks for.
+CREATE TABLE IF NOT EXISTS sources (
+    abbreviation TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    license TEXT NOT NULL DEFAULT '',
+    attribution TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE beasts
+    ADD COLUMN source TEXT REFERENCES sources (abbreviation) ON UPDATE CASCADE,
+    ADD COLUMN source_page INT NOT NULL DEFAULT 0 CHECK (source_page >= 0);
+
+CREATE INDEX IF NOT EXISTS beasts_source_idx ON beasts (source);
+
+INSERT INTO sources (abbreviation, title, license, attribution) VALUES
+('SRD', 'System Reference Document 5.1', 'CC-BY-4.0',
+ 'This work includes material taken from the System Reference Document 5.1 ("SRD 5.1") by Wizards of the Coast LLC and available at https://dnd.wizards.com/resources/systems-reference-document. The SRD 5.1 is licensed under the Creative Commons Attribution 4.0 International License available at https://creativecommons.org/licenses/by/4.0/legalcode.'),
+('MM', 'Monster Manual', 'proprietary', ''),
+('VGM', 'Volo''s Guide to Monsters', 'proprietary', '')
+ON CONFLICT (abbreviation) DO NOTHING;
+
+UPDATE beasts SET source = 'SRD' WHERE beast_name IN ('Owlbear', 'Mimic');
+UPDATE beasts SET source = 'MM', source_page = 222 WHERE beast_name = 'Mind Flayer';
+UPDATE beasts SET source = 'MM', source_page = 81 WHERE beast_name = 'Displacer Beast';
+UPDATE beasts SET source = 'VGM', source_page = 173 WHERE beast_name = 'Elder Brain';
+
+-- Earlier revisions predate sources. They take the source given above, so restoring one does not
+-- clear it.
+UPDATE beast_revisions r
+SET data = r.data || jsonb_strip_nulls(jsonb_build_object(
+    'Source', b.source,
+    'SourcePage', NULLIF(b.source_page, 0)
+))
+FROM beasts b
+WHERE b.beast_name = r.beast_name;
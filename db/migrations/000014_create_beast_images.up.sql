@@ -0,0 +1,17 @@
+-- Artwork and virtual tabletop tokens of beasts. The files are kept in the image store under
+-- key and thumbnail_key; the rows go away with their beast.
+CREATE TABLE IF NOT EXISTS beast_images (
+    id BIGSERIAL PRIMARY KEY,
+    beast_name TEXT NOT NULL REFERENCES beasts (beast_name) ON UPDATE CASCADE ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('artwork', 'token')),
+    content_type TEXT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size BIGINT NOT NULL,
+    key TEXT NOT NULL UNIQUE,
+    thumbnail_key TEXT NOT NULL UNIQUE,
+    uploaded_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS beast_images_beast_idx ON beast_images (beast_name);
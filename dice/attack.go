@@ -0,0 +1,76 @@
+package dice
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Attack is an attack written in a stat block, such as
+// "Beak. Melee Weapon Attack: +7 to hit, reach 5 ft., one creature. Hit: 10 (1d10 + 5) piercing damage."
+type Attack struct {
+	Name   string
+	ToHit  int
+	Damage []Damage
+}
+
+// Damage is one kind of damage dealt by an attack on a hit
+type Damage struct {
+	Dice *Expr
+	Type string
+}
+
+// maxDamageDice caps the dice of the damage of an attack. Larger expressions are left for the
+// average written before them, as no stat block needs them.
+const maxDamageDice = 100
+
+var (
+	attackPattern = regexp.MustCompile(`^([^.]+?)\.\s+(?:Melee or Ranged|Melee|Ranged) (?:Weapon|Spell) Attack:\s*([+-]\s*\d+) to hit\b.*?\bHit:\s*(.*)$`)
+	damagePattern = regexp.MustCompile(`(\d+)(?:\s*\(([^)]+)\))?\s+([a-z]+) damage`)
+)
+
+// FindAttacks returns the attacks in a description, one per line. Damage written without dice,
+// such as "1 piercing damage", or with more than 100 dice is the fixed amount written.
+func FindAttacks(description string) []Attack {
+	var attacks []Attack
+	for _, line := range strings.Split(description, "\n") {
+		m := attackPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		toHit, err := strconv.Atoi(strings.ReplaceAll(m[2], " ", ""))
+		if err != nil {
+			continue
+		}
+		attack := Attack{Name: strings.TrimSpace(m[1]), ToHit: toHit}
+		for _, d := range damagePattern.FindAllStringSubmatch(m[3], -1) {
+			expr, err := Parse(d[2])
+			if d[2] == "" || (err == nil && countDice(expr.root) > maxDamageDice) {
+				expr, err = Parse(d[1])
+			}
+			if err != nil {
+				continue
+			}
+			attack.Damage = append(attack.Damage, Damage{Dice: expr, Type: d[3]})
+		}
+		attacks = append(attacks, attack)
+	}
+	return attacks
+}
+
+// FindAttack returns the attack with the given name, ignoring case. An empty name matches the only attack.
+func FindAttack(description, name string) (Attack, bool) {
+	attacks := FindAttacks(description)
+	if name == "" {
+		if len(attacks) == 1 {
+			return attacks[0], true
+		}
+		return Attack{}, false
+	}
+	for _, a := range attacks {
+		if strings.EqualFold(a.Name, name) {
+			return a, true
+		}
+	}
+	return Attack{}, false
+}
@@ -0,0 +1,492 @@
+// Package dice parses and rolls dice expressions such as "2d6+4" or "4d6kh3".
+package dice
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Limits keep expressions cheap to roll
+const (
+	MaxLength = 200  // characters in an expression
+	MaxDice   = 1000 // dice rolled by an expression, each term counted once
+	MaxSides  = 1000 // sides of a die
+)
+
+// Errors returned by Roll
+var (
+	ErrDivisionByZero = errors.New("division by zero")    // a divisor rolled 0
+	ErrOutOfRange     = errors.New("result out of range") // a sum or product went past the range of an int32
+)
+
+// Mode is how d20s are rolled
+type Mode int
+
+const (
+	Normal       Mode = iota
+	Advantage         // roll two d20s and keep the highest
+	Disadvantage      // roll two d20s and keep the lowest
+)
+
+// Expr is a parsed dice expression. It supports NdM dice (N defaults to 1, d% is d100), keeping the
+// highest or lowest K dice with khK and klK (kK is khK), integers, + - * / and parentheses.
+// Division rounds down, as everything in 5e does.
+type Expr struct {
+	root node
+}
+
+// DieRoll is the outcome of one dice term. Kept is set when the term keeps only some of the dice.
+type DieRoll struct {
+	Dice    string `json:"dice"`
+	Results []int  `json:"results"`
+	Kept    []int  `json:"kept,omitempty"`
+}
+
+// Result is the outcome of rolling an expression
+type Result struct {
+	Expression string    `json:"expression"`
+	Total      int       `json:"total"`
+	Rolls      []DieRoll `json:"rolls"`
+}
+
+// Parse parses a dice expression, ignoring whitespace and case
+func Parse(s string) (*Expr, error) {
+	if len(s) > MaxLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", MaxLength)
+	}
+	p := &parser{src: strings.ToLower(strings.Join(strings.Fields(s), ""))}
+	if p.src == "" {
+		return nil, errors.New("empty expression")
+	}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	if n := countDice(root); n > MaxDice {
+		return nil, fmt.Errorf("expression rolls %d dice, expected at most %d", n, MaxDice)
+	}
+	return &Expr{root: root}, nil
+}
+
+// MustParse is like Parse but panics on invalid expressions. It is meant for constants.
+func MustParse(s string) *Expr {
+	e, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the expression in canonical form, such as "1d20+5"
+func (e *Expr) String() string {
+	return e.root.String()
+}
+
+// Roll rolls the expression with rng
+func (e *Expr) Roll(rng *rand.Rand) (Result, error) {
+	r := Result{Expression: e.String(), Rolls: []DieRoll{}}
+	total, err := e.root.roll(rng, &r.Rolls)
+	if err != nil {
+		return Result{}, err
+	}
+	r.Total = total
+	return r, nil
+}
+
+// Average returns the expected value of the expression. It is exact for sums and products
+// and approximate for divisions, which it does not round.
+func (e *Expr) Average() float64 {
+	return e.root.average()
+}
+
+// WithMode returns the expression with every single d20 rolled with advantage or disadvantage
+func (e *Expr) WithMode(m Mode) *Expr {
+	if m == Normal {
+		return e
+	}
+	return &Expr{root: transform(e.root, func(d *diceNode) *diceNode {
+		if d.count != 1 || d.sides != 20 || d.keep != 0 {
+			return d
+		}
+		return &diceNode{count: 2, sides: 20, keep: 1, lowest: m == Disadvantage}
+	})}
+}
+
+// Critical returns the expression with the number of every die doubled, as damage is rolled on a critical hit.
+// It fails if the doubled expression rolls more than MaxDice dice.
+func (e *Expr) Critical() (*Expr, error) {
+	root := transform(e.root, func(d *diceNode) *diceNode {
+		c := *d
+		c.count *= 2
+		if c.keep > 0 {
+			c.keep *= 2
+		}
+		return &c
+	})
+	if n := countDice(root); n > MaxDice {
+		return nil, fmt.Errorf("critical hit rolls %d dice, expected at most %d", n, MaxDice)
+	}
+	return &Expr{root: root}, nil
+}
+
+type node interface {
+	roll(rng *rand.Rand, rolls *[]DieRoll) (int, error)
+	average() float64
+	String() string
+}
+
+type numberNode int
+
+func (n numberNode) roll(*rand.Rand, *[]DieRoll) (int, error) { return int(n), nil }
+func (n numberNode) average() float64                         { return float64(n) }
+func (n numberNode) String() string                           { return strconv.Itoa(int(n)) }
+
+// diceNode rolls count dice, keeping the keep highest (or lowest) when keep is set
+type diceNode struct {
+	count, sides, keep int
+	lowest             bool
+}
+
+func (d *diceNode) String() string {
+	s := fmt.Sprintf("%dd%d", d.count, d.sides)
+	switch {
+	case d.keep > 0 && d.lowest:
+		s += fmt.Sprintf("kl%d", d.keep)
+	case d.keep > 0:
+		s += fmt.Sprintf("kh%d", d.keep)
+	}
+	return s
+}
+
+func (d *diceNode) roll(rng *rand.Rand, rolls *[]DieRoll) (int, error) {
+	r := DieRoll{Dice: d.String(), Results: make([]int, d.count)}
+	for i := range r.Results {
+		r.Results[i] = 1 + rng.IntN(d.sides)
+	}
+
+	kept := r.Results
+	if d.keep > 0 && d.keep < d.count {
+		kept = slices.Clone(r.Results)
+		slices.Sort(kept)
+		if !d.lowest {
+			slices.Reverse(kept)
+		}
+		kept = kept[:d.keep]
+		r.Kept = kept
+	}
+	total := 0
+	for _, v := range kept {
+		total += v
+	}
+	*rolls = append(*rolls, r)
+	return total, nil
+}
+
+// average sums the expected values of the kept dice. When j of the n dice roll at least v, as many of
+// the kept dice do as are among those j: min(j, keep) of the highest, or j-(n-keep) of the lowest. Summing
+// that over v and the binomial distribution of j takes count×sides steps.
+func (d *diceNode) average() float64 {
+	n := d.count
+	if d.keep == 0 || d.keep >= n {
+		return float64(n) * float64(d.sides+1) / 2
+	}
+	kept := func(j int) float64 {
+		if d.lowest {
+			return float64(max(j-(n-d.keep), 0))
+		}
+		return float64(min(j, d.keep))
+	}
+
+	logFactorial := make([]float64, n+1)
+	for i := 1; i <= n; i++ {
+		logFactorial[i] = logFactorial[i-1] + math.Log(float64(i))
+	}
+	// Every die rolls at least 1
+	total := kept(n)
+	for v := 2; v <= d.sides; v++ {
+		p := float64(d.sides-v+1) / float64(d.sides)
+		logP, logQ := math.Log(p), math.Log1p(-p)
+		for j := 1; j <= n; j++ {
+			if w := kept(j); w > 0 {
+				total += w * math.Exp(logFactorial[n]-logFactorial[j]-logFactorial[n-j]+float64(j)*logP+float64(n-j)*logQ)
+			}
+		}
+	}
+	return total
+}
+
+type binaryNode struct {
+	op          byte
+	left, right node
+}
+
+func (b *binaryNode) String() string {
+	return operand(b.left, b.op, false) + string(b.op) + operand(b.right, b.op, true)
+}
+
+// operand parenthesizes n when it binds looser than op, or as tightly on the right of - and /
+func operand(n node, op byte, right bool) string {
+	if inner, ok := n.(*binaryNode); ok {
+		if precedence(inner.op) < precedence(op) || (right && precedence(inner.op) == precedence(op) && (op == '-' || op == '/')) {
+			return "(" + inner.String() + ")"
+		}
+	}
+	return n.String()
+}
+
+func precedence(op byte) int {
+	if op == '*' || op == '/' {
+		return 2
+	}
+	return 1
+}
+
+func (b *binaryNode) roll(rng *rand.Rand, rolls *[]DieRoll) (int, error) {
+	l, err := b.left.roll(rng, rolls)
+	if err != nil {
+		return 0, err
+	}
+	r, err := b.right.roll(rng, rolls)
+	if err != nil {
+		return 0, err
+	}
+	// Operands stay within an int32, so their results fit before being checked
+	var v int
+	switch b.op {
+	case '+':
+		v = l + r
+	case '-':
+		v = l - r
+	case '*':
+		v = l * r
+	}
+	if b.op != '/' {
+		if v > math.MaxInt32 || v < -math.MaxInt32 {
+			return 0, ErrOutOfRange
+		}
+		return v, nil
+	}
+	if r == 0 {
+		return 0, ErrDivisionByZero
+	}
+	q := l / r
+	if (l%r != 0) && ((l < 0) != (r < 0)) {
+		q--
+	}
+	return q, nil
+}
+
+func (b *binaryNode) average() float64 {
+	l, r := b.left.average(), b.right.average()
+	switch b.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	}
+	if r == 0 {
+		return 0
+	}
+	return l / r
+}
+
+type negNode struct{ operand node }
+
+func (n negNode) String() string {
+	if _, ok := n.operand.(*binaryNode); ok {
+		return "-(" + n.operand.String() + ")"
+	}
+	return "-" + n.operand.String()
+}
+
+func (n negNode) roll(rng *rand.Rand, rolls *[]DieRoll) (int, error) {
+	v, err := n.operand.roll(rng, rolls)
+	return -v, err
+}
+
+func (n negNode) average() float64 { return -n.operand.average() }
+
+// transform returns a copy of the tree with every dice node replaced by f
+func transform(n node, f func(*diceNode) *diceNode) node {
+	switch n := n.(type) {
+	case *diceNode:
+		return f(n)
+	case *binaryNode:
+		return &binaryNode{op: n.op, left: transform(n.left, f), right: transform(n.right, f)}
+	case negNode:
+		return negNode{transform(n.operand, f)}
+	}
+	return n
+}
+
+func countDice(n node) int {
+	switch n := n.(type) {
+	case *diceNode:
+		return n.count
+	case *binaryNode:
+		return countDice(n.left) + countDice(n.right)
+	case negNode:
+		return countDice(n.operand)
+	}
+	return 0
+}
+
+// parser is a recursive descent parser over an expression without whitespace
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid expression at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// expr := term (('+' | '-') term)*
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '+' || c == '-'; c = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: c, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term := factor (('*' | '/') factor)*
+func (p *parser) term() (node, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for c := p.peek(); c == '*' || c == '/'; c = p.peek() {
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: c, left: left, right: right}
+	}
+	return left, nil
+}
+
+// factor := '-' factor | '(' expr ')' | number | [number] 'd' (number | '%') [('kh' | 'kl' | 'k') number]
+func (p *parser) factor() (node, error) {
+	switch c := p.peek(); {
+	case c == '-':
+		p.pos++
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{operand}, nil
+	case c == '(':
+		p.pos++
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return inner, nil
+	case c == 'd' || isDigit(c):
+		return p.dice()
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *parser) dice() (node, error) {
+	count, hasCount, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 'd' {
+		return numberNode(count), nil
+	}
+	p.pos++
+	if !hasCount {
+		count = 1
+	}
+
+	var sides int
+	if p.peek() == '%' {
+		p.pos++
+		sides = 100
+	} else if sides, _, err = p.number(); err != nil {
+		return nil, err
+	}
+	if count < 1 || count > MaxDice {
+		return nil, p.errorf("expected 1 to %d dice", MaxDice)
+	}
+	if sides < 2 || sides > MaxSides {
+		return nil, p.errorf("expected dice of 2 to %d sides", MaxSides)
+	}
+	d := &diceNode{count: count, sides: sides}
+
+	if p.peek() == 'k' {
+		p.pos++
+		switch p.peek() {
+		case 'l':
+			d.lowest = true
+			p.pos++
+		case 'h':
+			p.pos++
+		}
+		keep, hasKeep, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		if !hasKeep || keep < 1 || keep > count {
+			return nil, p.errorf("expected to keep 1 to %d dice", count)
+		}
+		d.keep = keep
+	}
+	return d, nil
+}
+
+// number reads an optional non-negative integer
+func (p *parser) number() (int, bool, error) {
+	start := p.pos
+	for isDigit(p.peek()) {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil || n > math.MaxInt32 {
+		return 0, false, p.errorf("number too large")
+	}
+	return n, true, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
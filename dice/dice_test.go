@@ -0,0 +1,146 @@
+package dice
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"2d6+4", "2d6+4"},
+		{"d20 + 5", "1d20+5"},
+		{"4D6kh3", "4d6kh3"},
+		{"4d6k3", "4d6kh3"},
+		{"2d20kl1-1", "2d20kl1-1"},
+		{"d%", "1d100"},
+		{"(1d8+2)*2", "(1d8+2)*2"},
+		{"10-(2-1)", "10-(2-1)"},
+		{"-1d4", "-1d4"},
+		{"3*2d6/2", "3*2d6/2"},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, e.String(), tt.in)
+	}
+
+	for _, s := range []string{"", "2d", "d1", "1d20+", "(1d6", "1d6)", "4d6kh5", "4d6kh", "2x6", "1001d6", "600d6+600d6", "1d1001"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRoll(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 500; i++ {
+		r, err := MustParse("2d6+4").Roll(rng)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, r.Total, 6)
+		assert.LessOrEqual(t, r.Total, 16)
+		require.Len(t, r.Rolls, 1)
+		assert.Equal(t, r.Total-4, r.Rolls[0].Results[0]+r.Rolls[0].Results[1])
+	}
+
+	r, err := MustParse("4d6kh3").Roll(rng)
+	require.NoError(t, err)
+	require.Len(t, r.Rolls[0].Kept, 3)
+	assert.Equal(t, r.Total, r.Rolls[0].Kept[0]+r.Rolls[0].Kept[1]+r.Rolls[0].Kept[2])
+	assert.GreaterOrEqual(t, r.Rolls[0].Kept[0], r.Rolls[0].Kept[2])
+
+	// The same seed gives the same rolls
+	a, _ := MustParse("8d6").Roll(rand.New(rand.NewPCG(7, 7)))
+	b, _ := MustParse("8d6").Roll(rand.New(rand.NewPCG(7, 7)))
+	assert.Equal(t, a, b)
+
+	// Division rounds down
+	for expr, want := range map[string]int{"7/2": 3, "-7/2": -4, "(1+2)*3-1": 8} {
+		r, err := MustParse(expr).Roll(rng)
+		require.NoError(t, err)
+		assert.Equal(t, want, r.Total, expr)
+	}
+
+	_, err = MustParse("1/(1d2-1d2)").Roll(rand.New(rand.NewPCG(1, 1)))
+	for i := 0; err == nil && i < 100; i++ {
+		_, err = MustParse("1/(1d2-1d2)").Roll(rng)
+	}
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+
+	// Sums and products may not overflow
+	_, err = MustParse("2147483647*2147483647*2147483647*2147483647").Roll(rng)
+	assert.ErrorIs(t, err, ErrOutOfRange)
+	_, err = MustParse("2147483647+1000d1000").Roll(rng)
+	assert.ErrorIs(t, err, ErrOutOfRange)
+}
+
+func TestAverage(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"1d10+5", 10.5},
+		{"2d6", 7},
+		{"2d20kh1", 13.825},
+		{"2d20kl1", 7.175},
+		{"4d6kh3", 12.2446},
+	}
+	for _, tt := range tests {
+		assert.InDelta(t, tt.want, MustParse(tt.in).Average(), 0.001, tt.in)
+	}
+
+	// The largest expressions allowed stay cheap
+	start := time.Now()
+	assert.InDelta(t, 1000*500.5-1.5, MustParse("1000d1000kh999").Average(), 1, "1000d1000kh999")
+	assert.InDelta(t, 1.5, MustParse("1000d1000kl1").Average(), 1, "1000d1000kl1")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWithModeAndCritical(t *testing.T) {
+	e := MustParse("1d20+5")
+	assert.Equal(t, "1d20+5", e.WithMode(Normal).String())
+	assert.Equal(t, "2d20kh1+5", e.WithMode(Advantage).String())
+	assert.Equal(t, "2d20kl1+5", e.WithMode(Disadvantage).String())
+	assert.Equal(t, "1d20+5", e.String())
+
+	critical, err := MustParse("1d8+1d6+3").Critical()
+	assert.NoError(t, err)
+	assert.Equal(t, "2d8+2d6+3", critical.String())
+
+	// Doubling the dice may not go past the limit
+	_, err = MustParse("600d6+400d4").Critical()
+	assert.ErrorContains(t, err, "critical hit rolls 2000 dice")
+}
+
+func TestFindAttacks(t *testing.T) {
+	description := "Keen Sight and Smell. The owlbear has advantage on Wisdom (Perception) checks.\n" +
+		"Beak. Melee Weapon Attack: +7 to hit, reach 5 ft., one creature. Hit: 10 (1d10 + 5) piercing damage.\n" +
+		"Bite. Melee Weapon Attack: +5 to hit, reach 5 ft., one target. Hit: 7 (1d8 + 3) piercing damage plus 4 (1d8) acid damage.\n" +
+		"Sting. Melee Weapon Attack: +2 to hit, reach 5 ft., one creature. Hit: 1 piercing damage."
+
+	attacks := FindAttacks(description)
+	require.Len(t, attacks, 3)
+	assert.Equal(t, "Beak", attacks[0].Name)
+	assert.Equal(t, 7, attacks[0].ToHit)
+	require.Len(t, attacks[1].Damage, 2)
+	assert.Equal(t, "1d8+3", attacks[1].Damage[0].Dice.String())
+	assert.Equal(t, "acid", attacks[1].Damage[1].Type)
+	assert.Equal(t, "1", attacks[2].Damage[0].Dice.String())
+
+	attack, ok := FindAttack(description, "bite")
+	assert.True(t, ok)
+	assert.Equal(t, "Bite", attack.Name)
+	_, ok = FindAttack(description, "")
+	assert.False(t, ok)
+	_, ok = FindAttack(description, "Claws")
+	assert.False(t, ok)
+
+	// Damage with too many dice is the amount written
+	attacks = FindAttacks("Slam. Melee Weapon Attack: +9 to hit, reach 5 ft., one target. Hit: 500500 (1000d1000kh999) bludgeoning damage.")
+	require.Len(t, attacks, 1)
+	assert.Equal(t, "500500", attacks[0].Damage[0].Dice.String())
+}
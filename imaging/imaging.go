@@ -0,0 +1,106 @@
+// Package imaging resizes images in pure Go, for thumbnails of uploaded images.
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Thumbnail returns src scaled down to fit in a square of size pixels, keeping its aspect ratio
+// and transparency. Images that already fit are copied as they are. Each pixel of the thumbnail
+// is the average of the pixels of src it covers. Pixels are read from src as they are, so scaling
+// takes no memory beyond the thumbnail.
+func Thumbnail(src image.Image, size int) *image.NRGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := fit(w, h, size)
+
+	// Average premultiplied colors, so transparent pixels do not bleed their color into the edges
+	at := premultiplied(src)
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := span(y, th, h)
+		for x := 0; x < tw; x++ {
+			x0, x1 := span(x, tw, w)
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := at(b.Min.X+sx, b.Min.Y+sy)
+					r, g, bl, a = r+pr, g+pg, bl+pb, a+pa
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			if a == 0 {
+				continue
+			}
+			// Unpremultiply: the color channels are scaled by the average alpha
+			dst.Pix[i] = uint8((r*255 + a/2) / a)
+			dst.Pix[i+1] = uint8((g*255 + a/2) / a)
+			dst.Pix[i+2] = uint8((bl*255 + a/2) / a)
+			dst.Pix[i+3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
+
+// premultiplied returns a function reading the 8-bit premultiplied color of a pixel of src. The image
+// types the standard decoders return are read directly rather than through At, which allocates.
+func premultiplied(src image.Image) func(x, y int) (r, g, b, a int) {
+	switch s := src.(type) {
+	case *image.RGBA:
+		return func(x, y int) (int, int, int, int) {
+			p := s.Pix[s.PixOffset(x, y):]
+			return int(p[0]), int(p[1]), int(p[2]), int(p[3])
+		}
+	case *image.NRGBA:
+		return func(x, y int) (int, int, int, int) {
+			p := s.Pix[s.PixOffset(x, y):]
+			a := uint32(p[3])
+			// As color.NRGBA.RGBA does, in 8 bits
+			scale := func(v uint8) int { return int(uint32(v) * 0x101 * a / 0xff >> 8) }
+			return scale(p[0]), scale(p[1]), scale(p[2]), int(a)
+		}
+	case *image.YCbCr:
+		return func(x, y int) (int, int, int, int) {
+			r, g, b := color.YCbCrToRGB(s.Y[s.YOffset(x, y)], s.Cb[s.COffset(x, y)], s.Cr[s.COffset(x, y)])
+			return int(r), int(g), int(b), 0xff
+		}
+	case *image.Paletted:
+		palette := make([][4]int, len(s.Palette))
+		for i, c := range s.Palette {
+			r, g, b, a := c.RGBA()
+			palette[i] = [4]int{int(r >> 8), int(g >> 8), int(b >> 8), int(a >> 8)}
+		}
+		return func(x, y int) (int, int, int, int) {
+			if i := int(s.Pix[s.PixOffset(x, y)]); i < len(palette) {
+				return palette[i][0], palette[i][1], palette[i][2], palette[i][3]
+			}
+			return 0, 0, 0, 0
+		}
+	}
+	return func(x, y int) (int, int, int, int) {
+		r, g, b, a := src.At(x, y).RGBA()
+		return int(r >> 8), int(g >> 8), int(b >> 8), int(a >> 8)
+	}
+}
+
+// fit returns the dimensions of a w by h image scaled down to fit in a square of size pixels
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	scale := float64(size) / float64(max(w, h))
+	return max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+}
+
+// span returns the source pixels [from, to) covered by pixel i of n pixels scaled from total pixels
+func span(i, n, total int) (int, int) {
+	from := i * total / n
+	to := (i + 1) * total / n
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
@@ -0,0 +1,77 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		w, h, size   int
+		wantW, wantH int
+	}{
+		{1000, 500, 256, 256, 128},
+		{300, 900, 256, 85, 256},
+		{100, 50, 256, 100, 50},
+		{5000, 3, 256, 256, 1},
+	}
+	for _, tt := range tests {
+		thumb := Thumbnail(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), tt.size)
+		assert.Equal(t, image.Rect(0, 0, tt.wantW, tt.wantH), thumb.Bounds(), "%dx%d", tt.w, tt.h)
+	}
+}
+
+func TestThumbnail_Averages(t *testing.T) {
+	// Columns alternate black and white, so each thumbnail pixel covering two of them is mid grey
+	src := image.NewGray(image.Rect(10, 10, 14, 12))
+	for x := 10; x < 14; x += 2 {
+		for y := 10; y < 12; y++ {
+			src.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	thumb := Thumbnail(src, 2)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), thumb.Bounds())
+	assert.Equal(t, color.NRGBA{R: 128, G: 128, B: 128, A: 255}, thumb.NRGBAAt(0, 0))
+
+	// Transparent pixels lower the alpha but do not darken the color
+	token := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	token.SetNRGBA(0, 0, color.NRGBA{R: 200, A: 255})
+	token.SetNRGBA(1, 1, color.NRGBA{R: 200, A: 255})
+	thumb = Thumbnail(token, 1)
+	assert.Equal(t, color.NRGBA{R: 200, A: 128}, thumb.NRGBAAt(0, 0))
+
+	assert.Equal(t, color.NRGBA{}, Thumbnail(image.NewNRGBA(image.Rect(0, 0, 4, 4)), 2).NRGBAAt(1, 1))
+}
+
+func TestThumbnail_ImageTypes(t *testing.T) {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+	ycbcr := image.NewYCbCr(nrgba.Bounds(), image.YCbCrSubsampleRatio420)
+	paletted := image.NewPaletted(nrgba.Bounds(), color.Palette{color.Transparent, color.NRGBA{R: 200, G: 40, B: 90, A: 160}, color.White})
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			nrgba.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 8), G: uint8(y * 12), B: uint8(x * y), A: uint8(255 - x*y)})
+			ycbcr.Y[ycbcr.YOffset(x, y)] = uint8(x * y)
+			ycbcr.Cb[ycbcr.COffset(x, y)], ycbcr.Cr[ycbcr.COffset(x, y)] = uint8(x*8), uint8(y*12)
+			paletted.SetColorIndex(x, y, uint8((x+y)%3))
+		}
+	}
+	rgba := image.NewRGBA(nrgba.Bounds())
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			rgba.Set(x, y, nrgba.At(x, y))
+		}
+	}
+
+	// Images read directly give the same thumbnails as through At, give or take rounding
+	for _, src := range []image.Image{nrgba, rgba, ycbcr, paletted} {
+		want := Thumbnail(struct{ image.Image }{src}, 7)
+		got := Thumbnail(src, 7)
+		assert.Equal(t, want.Bounds(), got.Bounds())
+		for i := range want.Pix {
+			assert.InDelta(t, want.Pix[i], got.Pix[i], 1, "%T", src)
+		}
+	}
+}
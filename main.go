@@ -1,36 +1,211 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/keremenci/bestiary-crud/api"
+	"github.com/keremenci/bestiary-crud/auth"
 	"github.com/keremenci/bestiary-crud/config"
+	"github.com/keremenci/bestiary-crud/logging"
+	"github.com/keremenci/bestiary-crud/metrics"
+	"github.com/keremenci/bestiary-crud/ratelimit"
+	"github.com/keremenci/bestiary-crud/storage"
+	"github.com/keremenci/bestiary-crud/tracing"
 )
 
 func main() {
 
 	// Load config
 	cfg := config.GetAppConfig("config/config.yml")
+
+	// Structured logging, also used for the standard library logger
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal("Invalid log configuration", err)
+	}
+	slog.SetDefault(logger)
+	api.SetLogger(logger)
+
+	// Tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal("Invalid tracing configuration", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Init db connection
 	api.InitializeDB(cfg.DatabaseUrl)
 
-	router := gin.Default()
+	router := gin.New()
+	router.Use(api.RequestID(), api.Tracing(), api.RequestLogger(), api.Recovery(), api.Metrics())
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("Invalid trusted proxies", err)
+	}
+
+	// Rate limits are applied per client within each route group
+	if cfg.RateLimit.APIKeyHeader != "" {
+		api.APIKeyHeader = cfg.RateLimit.APIKeyHeader
+	}
+	api.SetAPIKeys(cfg.RateLimit.APIKeys)
+	limitStore := ratelimit.NewMemoryStore()
+	limit := func(group string) gin.HandlerFunc {
+		g := cfg.RateLimit.Groups[group]
+		return api.RateLimit(limitStore, group, ratelimit.Limit{Rate: g.Rate, Burst: g.Burst})
+	}
+	readLimit, writeLimit := limit("read"), limit("write")
 
 	// Configure CORS to allow all origins TODO: tie this to an env variable
 	router.Use(cors.New(cors.Config{
 		AllowAllOrigins: true,
 		AllowMethods:    []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:    []string{"Origin", "Content-Type", "Accept"},
+		AllowHeaders:    []string{"Origin", "Content-Type", "Accept", "Authorization", api.APIKeyHeader, api.RequestIDHeader, "Last-Event-ID"},
+		ExposeHeaders:   []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", api.RequestIDHeader},
 	}))
 
+	// Roles come from bearer tokens once a JWKS is configured
+	if verifier := newVerifier(cfg.Auth.JWKSFile, cfg.Auth.JWKSUrl, cfg.Auth.JWKSRefresh, auth.Config{
+		Issuer:         cfg.Auth.Issuer,
+		Audience:       cfg.Auth.Audience,
+		ClockSkew:      cfg.Auth.ClockSkew,
+		RolesClaim:     cfg.Auth.RolesClaim,
+		RoleMapping:    cfg.Auth.RoleMapping,
+		CampaignsClaim: cfg.Auth.CampaignsClaim,
+	}); verifier != nil {
+		router.Use(api.Authenticate(verifier))
+	} else if cfg.Auth.LocalAdmin {
+		// Without authentication every caller is anonymous, unless local development asks for an admin
+		slog.Warn("auth.local_admin is set, every request acts as an admin")
+		router.Use(api.AssumePrincipal(&auth.Principal{Subject: "local", Roles: []string{api.RoleAdmin}}))
+	}
+
+	policy, err := api.DefaultPolicy().With(cfg.RBAC.Policy)
+	if err != nil {
+		fatal("Invalid RBAC policy", err)
+	}
+	api.SetPolicy(policy)
+
+	if cfg.Metrics.Path != "" {
+		metrics.Registry.MustRegister(api.BeastCollector())
+		router.GET(cfg.Metrics.Path, gin.WrapH(metrics.Handler()))
+	}
+
+	if cfg.Encounters.OnBeastDelete != "" {
+		if err := api.SetBeastDeletePolicy(cfg.Encounters.OnBeastDelete); err != nil {
+			fatal("Invalid encounters configuration", err)
+		}
+	}
+
+	// Uploaded beast images are kept on the local filesystem
+	if cfg.Images.Dir != "" {
+		store, err := storage.NewLocalStore(cfg.Images.Dir)
+		if err != nil {
+			fatal("Invalid images configuration", err)
+		}
+		api.SetImageStore(store, api.ImageOptions{
+			MaxSize:       int64(max(cfg.Images.MaxSizeMB, 1)) << 20,
+			MaxDimension:  max(cfg.Images.MaxDimension, 1),
+			MaxPixels:     max(cfg.Images.MaxMegapixels, 1) * 1_000_000,
+			ThumbnailSize: max(cfg.Images.ThumbnailSize, 1),
+		})
+	}
+
+	// Deleted beasts are purged once they have been in the trash for the retention period
+	if cfg.Trash.RetentionDays > 0 {
+		go api.PurgeTrashEvery(orDefault(cfg.Trash.PurgeInterval, time.Hour), time.Duration(cfg.Trash.RetentionDays)*24*time.Hour, nil)
+	}
+
+	// Beast changes are sent to the registered webhooks
+	go api.DeliverWebhooksEvery(orDefault(cfg.Webhooks.PollInterval, 5*time.Second), api.WebhookOptions{
+		Client:      &http.Client{Timeout: orDefault(cfg.Webhooks.Timeout, 10*time.Second)},
+		BatchSize:   max(cfg.Webhooks.BatchSize, 1),
+		MaxAttempts: max(cfg.Webhooks.MaxAttempts, 1),
+		BaseDelay:   orDefault(cfg.Webhooks.RetryDelay, 30*time.Second),
+		MaxDelay:    orDefault(cfg.Webhooks.MaxRetryDelay, 6*time.Hour),
+	}, nil)
+
+	// Changes made by any replica are streamed to the clients of this one
+	broker := api.NewEventBroker()
+	go broker.Run(context.Background())
+
 	router.GET("/", api.HealthCheck)
-	router.GET("/beasts", api.ListItems)
-	router.GET("/beasts/:key", api.GetItem)
-	router.POST("/beasts", api.PutItem)
-	router.PUT("/beasts/:key", api.UpdateItem)
-	router.DELETE("/beasts/:key", api.DeleteItem)
+	router.GET("/beasts", readLimit, api.Authorize(api.ActionListBeasts), api.ListItems)
+	router.GET("/beasts/events", readLimit, api.Authorize(api.ActionListBeasts), api.StreamEvents(broker))
+	router.GET("/beasts/:key", readLimit, api.Authorize(api.ActionGetBeast), api.GetItem)
+	router.POST("/beasts", writeLimit, api.Authorize(api.ActionCreateBeast), api.PutItem)
+	router.POST("/beasts/calculate-cr", readLimit, api.Authorize(api.ActionListBeasts), api.CalculateCR)
+	router.PUT("/beasts/:key", writeLimit, api.Authorize(api.ActionUpdateBeast), api.UpdateItem)
+	router.DELETE("/beasts/:key", writeLimit, api.Authorize(api.ActionDeleteBeast), api.DeleteItem)
+	router.POST("/beasts/:key/restore", writeLimit, api.Authorize(api.ActionDeleteBeast), api.RestoreItem)
+	router.GET("/trash", readLimit, api.Authorize(api.ActionDeleteBeast), api.ListTrash)
+	router.GET("/beasts/:key/revisions", readLimit, api.Authorize(api.ActionGetBeast), api.ListRevisions)
+	router.GET("/beasts/:key/revisions/:n", readLimit, api.Authorize(api.ActionGetBeast), api.GetRevision)
+	router.GET("/beasts/:key/diff", readLimit, api.Authorize(api.ActionGetBeast), api.DiffRevisions)
+	router.POST("/beasts/:key/revisions/:n/restore", writeLimit, api.Authorize(api.ActionUpdateBeast), api.RestoreRevision)
+	router.POST("/beasts/:key/roll/hp", readLimit, api.Authorize(api.ActionGetBeast), api.RollHitPoints)
+	router.POST("/beasts/:key/roll/attack", readLimit, api.Authorize(api.ActionGetBeast), api.RollAttack)
+	router.POST("/beasts/:key/scale", readLimit, api.WhenSaving(writeLimit), api.Authorize(api.ActionGetBeast), api.ScaleBeast)
+	router.POST("/beasts/:key/images", writeLimit, api.Authorize(api.ActionUpdateBeast), api.UploadImage)
+	router.DELETE("/beasts/:key/images/:id", writeLimit, api.Authorize(api.ActionUpdateBeast), api.DeleteImage)
+	router.GET("/images/:id", readLimit, api.Authorize(api.ActionGetBeast), api.ServeImage)
+	router.GET("/images/:id/thumbnail", readLimit, api.Authorize(api.ActionGetBeast), api.ServeThumbnail)
+	router.GET("/beasts/:key/export/foundry", readLimit, api.Authorize(api.ActionGetBeast), api.ExportBeastFoundry)
+	router.GET("/beasts/:key/export/roll20", readLimit, api.Authorize(api.ActionGetBeast), api.ExportBeastRoll20)
+	router.POST("/roll", readLimit, api.Authorize(api.ActionListBeasts), api.RollDice)
+	router.POST("/encounters/evaluate", readLimit, api.Authorize(api.ActionListBeasts), api.EvaluateEncounter)
+	router.POST("/encounters/generate", readLimit, api.Authorize(api.ActionListBeasts), api.GenerateEncounter)
+	router.POST("/books", readLimit, api.Authorize(api.ActionListBeasts), api.CreateBook)
+	router.GET("/tags", readLimit, api.Authorize(api.ActionListBeasts), api.ListTags)
+	router.POST("/tags", writeLimit, api.Authorize(api.ActionManageTags), api.CreateTag)
+	router.GET("/tags/:tag", readLimit, api.Authorize(api.ActionListBeasts), api.GetTag)
+	router.PUT("/tags/:tag", writeLimit, api.Authorize(api.ActionManageTags), api.UpdateTag)
+	router.DELETE("/tags/:tag", writeLimit, api.Authorize(api.ActionManageTags), api.DeleteTag)
+	router.GET("/sources", readLimit, api.Authorize(api.ActionListBeasts), api.ListSources)
+	router.POST("/sources", writeLimit, api.Authorize(api.ActionManageSources), api.CreateSource)
+	router.GET("/sources/:source", readLimit, api.Authorize(api.ActionListBeasts), api.GetSource)
+	router.PUT("/sources/:source", writeLimit, api.Authorize(api.ActionManageSources), api.UpdateSource)
+	router.DELETE("/sources/:source", writeLimit, api.Authorize(api.ActionManageSources), api.DeleteSource)
+	router.GET("/export", readLimit, api.Authorize(api.ActionListBeasts), api.ExportBeasts)
+	router.GET("/export/foundry", readLimit, api.Authorize(api.ActionListBeasts), api.ExportFoundry)
+	router.GET("/export/roll20", readLimit, api.Authorize(api.ActionListBeasts), api.ExportRoll20)
+	router.GET("/campaigns", readLimit, api.Authorize(api.ActionReadCampaigns), api.ListCampaigns)
+	router.POST("/campaigns", writeLimit, api.Authorize(api.ActionWriteCampaigns), api.CreateCampaign)
+	router.GET("/campaigns/:campaign", readLimit, api.Authorize(api.ActionReadCampaigns), api.GetCampaign)
+	router.PUT("/campaigns/:campaign", writeLimit, api.Authorize(api.ActionWriteCampaigns), api.UpdateCampaign)
+	router.DELETE("/campaigns/:campaign", writeLimit, api.Authorize(api.ActionWriteCampaigns), api.DeleteCampaign)
+	router.GET("/campaigns/:campaign/encounters", readLimit, api.Authorize(api.ActionReadCampaigns), api.ListCampaignEncounters)
+	router.POST("/campaigns/:campaign/encounters", writeLimit, api.Authorize(api.ActionWriteCampaigns), api.CreateCampaignEncounter)
+	router.GET("/campaigns/:campaign/encounters/:id", readLimit, api.Authorize(api.ActionReadCampaigns), api.GetCampaignEncounter)
+	router.PUT("/campaigns/:campaign/encounters/:id", writeLimit, api.Authorize(api.ActionWriteCampaigns), api.UpdateCampaignEncounter)
+	router.DELETE("/campaigns/:campaign/encounters/:id", writeLimit, api.Authorize(api.ActionWriteCampaigns), api.DeleteCampaignEncounter)
+	router.GET("/combats", readLimit, api.Authorize(api.ActionRunCombats), api.ListCombats)
+	router.POST("/combats", writeLimit, api.Authorize(api.ActionRunCombats), api.CreateCombat)
+	router.GET("/combats/:id", readLimit, api.Authorize(api.ActionRunCombats), api.GetCombat)
+	router.DELETE("/combats/:id", writeLimit, api.Authorize(api.ActionRunCombats), api.DeleteCombat)
+	router.POST("/combats/:id/next", writeLimit, api.Authorize(api.ActionRunCombats), api.NextTurn)
+	router.POST("/combats/:id/combatants", writeLimit, api.Authorize(api.ActionRunCombats), api.AddCombatants)
+	router.DELETE("/combats/:id/combatants/:combatant", writeLimit, api.Authorize(api.ActionRunCombats), api.RemoveCombatant)
+	router.POST("/combats/:id/combatants/:combatant/damage", writeLimit, api.Authorize(api.ActionRunCombats), api.DamageCombatant)
+	router.POST("/combats/:id/combatants/:combatant/heal", writeLimit, api.Authorize(api.ActionRunCombats), api.HealCombatant)
+	router.PUT("/combats/:id/combatants/:combatant/conditions/:condition", writeLimit, api.Authorize(api.ActionRunCombats), api.AddCondition)
+	router.DELETE("/combats/:id/combatants/:combatant/conditions/:condition", writeLimit, api.Authorize(api.ActionRunCombats), api.RemoveCondition)
+	router.GET("/audit", readLimit, api.Authorize(api.ActionReadAudit), api.ListAudit)
+	router.GET("/webhooks", readLimit, api.Authorize(api.ActionManageWebhooks), api.ListWebhooks)
+	router.POST("/webhooks", writeLimit, api.Authorize(api.ActionManageWebhooks), api.CreateWebhook)
+	router.DELETE("/webhooks/:id", writeLimit, api.Authorize(api.ActionManageWebhooks), api.DeleteWebhook)
+	router.GET("/webhooks/:id/deliveries", readLimit, api.Authorize(api.ActionManageWebhooks), api.ListWebhookDeliveries)
 
 	// Use port from config, default to 8080 if not set
 	port := cfg.Port
@@ -39,3 +214,40 @@ func main() {
 	}
 	router.Run(fmt.Sprintf(":%s", port))
 }
+
+// newVerifier builds a token verifier from the JWKS file or URL, or returns nil when neither is configured
+func newVerifier(jwksFile, jwksUrl string, refresh time.Duration, cfg auth.Config) *auth.Verifier {
+	source := jwksFile
+	if source == "" {
+		source = jwksUrl
+	}
+	if source == "" {
+		slog.Warn("No JWKS configured, bearer tokens are not accepted")
+		return nil
+	}
+
+	keys, err := auth.NewKeySet(source, time.Minute)
+	if err != nil {
+		fatal("Unable to load JWKS", err)
+	}
+	if refresh > 0 {
+		go keys.AutoRefresh(refresh, nil, func(err error) {
+			slog.Error("Error refreshing JWKS", "err", err)
+		})
+	}
+	return auth.NewVerifier(keys, cfg)
+}
+
+// orDefault returns d, or def if d is not positive
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// fatal logs the error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
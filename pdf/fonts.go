@@ -0,0 +1,135 @@
+package pdf
+
+import "strings"
+
+// Font is one of the standard Helvetica fonts every PDF reader has, so no font is embedded
+type Font int
+
+const (
+	Regular Font = iota
+	Bold
+	Italic
+	BoldItalic
+)
+
+// baseFonts are the PostScript names of the fonts, in the order of Font
+var baseFonts = []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique"}
+
+// Widths of the printable ASCII characters from space to tilde, in thousandths of the font size,
+// from the Adobe font metrics. The oblique fonts have the widths of the upright ones.
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// winAnsi maps the characters outside of ASCII that WinAnsiEncoding has to their codes and widths.
+// Latin-1 letters keep their code points and are given the width of an average letter.
+var winAnsi = map[rune]struct {
+	Code  byte
+	Width int
+}{
+	'‘': {0x91, 222}, '’': {0x92, 222}, '“': {0x93, 333}, '”': {0x94, 333},
+	'•': {0x95, 350}, '–': {0x96, 556}, '—': {0x97, 1000}, '…': {0x85, 1000}, '×': {0xD7, 584},
+}
+
+// encode converts text to WinAnsiEncoding, replacing the characters it doesn't have with question marks
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 32 && r <= 126:
+			b = append(b, byte(r))
+		case r >= 0xA0 && r <= 0xFF:
+			b = append(b, byte(r))
+		default:
+			if c, ok := winAnsi[r]; ok {
+				b = append(b, c.Code)
+			} else {
+				b = append(b, '?')
+			}
+		}
+	}
+	return b
+}
+
+// Width returns the width of text in points when set in the font at the size
+func Width(font Font, size float64, s string) float64 {
+	widths := &helveticaWidths
+	if font == Bold || font == BoldItalic {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, r := range s {
+		switch {
+		case r >= 32 && r <= 126:
+			total += widths[r-32]
+		case winAnsi[r].Width > 0:
+			total += winAnsi[r].Width
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Wrap breaks text into lines no wider than width, between words, the first line starting indent points in
+// to leave room for a run-in heading. Words wider than a line are broken where they reach its end.
+func Wrap(font Font, size float64, s string, width, indent float64) []string {
+	var lines []string
+	line := ""
+	available := func() float64 {
+		if len(lines) == 0 {
+			return width - indent
+		}
+		return width
+	}
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if Width(font, size, candidate) <= available() {
+			line = candidate
+			continue
+		}
+		if line != "" || (len(lines) == 0 && indent > 0) {
+			lines = append(lines, line)
+		}
+		for Width(font, size, word) > available() {
+			n := fitting(font, size, word, available())
+			lines = append(lines, word[:n])
+			word = word[n:]
+		}
+		line = word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// fitting returns how many bytes of the start of word fit in width, at least one character
+func fitting(font Font, size float64, word string, width float64) int {
+	n := 0
+	for i, r := range word {
+		if i > 0 && Width(font, size, word[:i+len(string(r))]) > width {
+			break
+		}
+		n = i + len(string(r))
+	}
+	return n
+}
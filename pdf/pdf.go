@@ -0,0 +1,150 @@
+// Package pdf writes simple PDF documents of text and lines, set in the standard Helvetica fonts.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// US Letter, in points
+const (
+	PageWidth  = 612
+	PageHeight = 792
+)
+
+// Color is an RGB color with components from 0 to 1
+type Color struct {
+	R, G, B float64
+}
+
+// Black is the color of text unless told otherwise
+var Black = Color{}
+
+// Document is a PDF document being built, page by page
+type Document struct {
+	title string
+	pages []*Page
+}
+
+// Page is a page of a document. Coordinates are in points from the bottom left corner.
+type Page struct {
+	content bytes.Buffer
+}
+
+// New starts a document with the title shown by PDF readers
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// AddPage adds a page at the end of the document and returns it
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the number of pages in the document
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// Page returns the n-th page, counting from 1
+func (d *Document) Page(n int) *Page {
+	return d.pages[n-1]
+}
+
+// Text writes text with its baseline starting at x, y
+func (p *Page) Text(x, y float64, font Font, size float64, c Color, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s rg %s %s Td %s Tj ET\n", font+1, num(size), rgb(c), num(x), num(y), literal(s))
+}
+
+// Line draws a line from x1, y1 to x2, y2
+func (p *Page) Line(x1, y1, x2, y2, width float64, c Color) {
+	fmt.Fprintf(&p.content, "q %s RG %s w %s %s m %s %s l S Q\n", rgb(c), num(width), num(x1), num(y1), num(x2), num(y2))
+}
+
+// Rect fills a rectangle whose bottom left corner is at x, y
+func (p *Page) Rect(x, y, width, height float64, c Color) {
+	fmt.Fprintf(&p.content, "q %s rg %s %s %s %s re f Q\n", rgb(c), num(x), num(y), num(width), num(height))
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func rgb(c Color) string {
+	return num(c.R) + " " + num(c.G) + " " + num(c.B)
+}
+
+// WriteTo writes the document as a PDF file. Page contents are compressed.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	// Objects 1 to 3 are the catalog, the page tree and the document information, followed by
+	// the fonts and then by each page and its content stream
+	firstPage := 4 + len(baseFonts)
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	kids := ""
+	for i := range d.pages {
+		kids += fmt.Sprintf("%d 0 R ", firstPage+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %d %d] >>", kids, len(d.pages), PageWidth, PageHeight), nil)
+	object(fmt.Sprintf("<< /Title %s /Producer (bestiary-crud) >>", literal(d.title)), nil)
+
+	fonts := ""
+	for i, name := range baseFonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name), nil)
+		fonts += fmt.Sprintf("/F%d %d 0 R ", i+1, 4+i)
+	}
+	for i, p := range d.pages {
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(p.content.Bytes()); err != nil {
+			return 0, err
+		}
+		if err := zw.Close(); err != nil {
+			return 0, err
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << %s>> >> /Contents %d 0 R >>", fonts, firstPage+2*i+1), nil)
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>", content.Len()), content.Bytes())
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// literal writes text as a PDF string
+func literal(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, c := range encode(s) {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
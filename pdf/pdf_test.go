@@ -0,0 +1,101 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	startXrefPattern = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+	streamPattern    = regexp.MustCompile(`(?s)<< /Length (\d+) /Filter /FlateDecode >>\nstream\n(.*?)\nendstream`)
+)
+
+// checkStructure checks that the cross-reference table of a PDF file points at its objects
+// and returns the inflated content streams of its pages
+func checkStructure(t *testing.T, data []byte) []string {
+	t.Helper()
+	require.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+	m := startXrefPattern.FindSubmatch(data)
+	require.NotNil(t, m, "startxref")
+	xref, err := strconv.Atoi(string(m[1]))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data[xref:], []byte("xref\n0 ")))
+
+	var size int
+	_, err = fmt.Sscanf(string(data[xref:]), "xref\n0 %d\n", &size)
+	require.NoError(t, err)
+	entries := bytes.Split(data[xref:], []byte("\n"))[2 : 2+size]
+	assert.Equal(t, "0000000000 65535 f ", string(entries[0]))
+	for i, entry := range entries[1:] {
+		offset, err := strconv.Atoi(string(entry[:10]))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+	}
+	assert.Contains(t, string(data), fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>", size))
+
+	var contents []string
+	for _, s := range streamPattern.FindAllSubmatch(data, -1) {
+		length, _ := strconv.Atoi(string(s[1]))
+		require.Len(t, s[2], length)
+		r, err := zlib.NewReader(bytes.NewReader(s[2]))
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		contents = append(contents, string(content))
+	}
+	return contents
+}
+
+func TestDocument(t *testing.T) {
+	doc := New("Volo's (Guide)")
+	first := doc.AddPage()
+	first.Text(72, 700, Bold, 14, Color{R: 0.5}, "Owlbear (Monstrosity)")
+	first.Line(72, 690, 300, 690, 1.5, Black)
+	doc.AddPage().Rect(10, 20, 30, 40, Black)
+	doc.AddPage().Text(72, 700, Italic, 9, Black, `Beholder’s \ eye`)
+	require.Equal(t, 3, doc.Pages())
+
+	var buf bytes.Buffer
+	n, err := doc.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	data := buf.String()
+	contents := checkStructure(t, buf.Bytes())
+	assert.Contains(t, data, "/Count 3")
+	assert.Contains(t, data, `/Title (Volo's \(Guide\))`)
+	assert.Contains(t, data, "/BaseFont /Helvetica-BoldOblique")
+	require.Len(t, contents, 3)
+	assert.Equal(t, "BT /F2 14 Tf 0.5 0 0 rg 72 700 Td (Owlbear \\(Monstrosity\\)) Tj ET\nq 0 0 0 RG 1.5 w 72 690 m 300 690 l S Q\n", contents[0])
+	assert.Equal(t, "q 0 0 0 rg 10 20 30 40 re f Q\n", contents[1])
+	assert.Equal(t, "BT /F3 9 Tf 0 0 0 rg 72 700 Td (Beholder\x92s \\\\ eye) Tj ET\n", contents[2])
+}
+
+func TestWidth(t *testing.T) {
+	assert.InDelta(t, 27.336, Width(Regular, 12, "Hello"), 1e-9)
+	assert.InDelta(t, 29.34, Width(Bold, 12, "Hello"), 1e-9)
+	assert.Equal(t, Width(Regular, 10, "Owlbear"), Width(Italic, 10, "Owlbear"))
+	assert.InDelta(t, 10, Width(Regular, 10, "—"), 1e-9)
+}
+
+func TestWrap(t *testing.T) {
+	text := "The owlbear has advantage on Wisdom (Perception) checks that rely on sight or smell."
+	lines := Wrap(Regular, 10, text, 150, 0)
+	assert.Equal(t, []string{"The owlbear has advantage on", "Wisdom (Perception) checks that", "rely on sight or smell."}, lines)
+	for _, line := range lines {
+		assert.LessOrEqual(t, Width(Regular, 10, line), 150.0)
+	}
+
+	// The first line leaves room for a heading, and words wider than a line are broken
+	assert.Equal(t, []string{"", "Aaaaaaaaaaaaaa", "aaaaaa"}, Wrap(Regular, 10, "Aaaaaaaaaaaaaaaaaaaa", 80, 50))
+	assert.Equal(t, []string{"The", "owlbear"}, Wrap(Regular, 10, "The owlbear", 50, 20))
+	assert.Empty(t, Wrap(Regular, 10, "  ", 50, 0))
+}
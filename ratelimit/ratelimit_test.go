@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 3}
+	ctx := context.Background()
+
+	// The burst is available immediately
+	for want := 2; want >= 0; want-- {
+		res, err := store.Take(ctx, "ip:10.0.0.1", limit)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, want, res.Remaining)
+		assert.Equal(t, 3, res.Limit)
+	}
+
+	res, _ := store.Take(ctx, "ip:10.0.0.1", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, res.Reset)
+
+	// Other keys have their own bucket
+	res, _ = store.Take(ctx, "ip:10.0.0.2", limit)
+	assert.True(t, res.Allowed)
+
+	// Tokens refill at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	res, _ = store.Take(ctx, "ip:10.0.0.1", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// Buckets never exceed the burst
+	now = now.Add(time.Hour)
+	res, _ = store.Take(ctx, "ip:10.0.0.1", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 5}
+
+	store.Take(context.Background(), "ip:10.0.0.1", limit)
+	store.Take(context.Background(), "ip:10.0.0.2", limit)
+	assert.Len(t, store.buckets, 2)
+
+	// Once refilled, idle buckets are dropped on the next sweep
+	now = now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "ip:10.0.0.3", limit)
+	assert.Len(t, store.buckets, 1)
+}
+
+func TestMemoryStore_SweepMixedLimits(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	read, write := Limit{Rate: 0.01, Burst: 100}, Limit{Rate: 1, Burst: 10}
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		store.Take(ctx, "read:ip:10.0.0.1", read)
+	}
+
+	// A sweep started by a request of another limit keeps the partly drained bucket
+	now = now.Add(2 * sweepInterval)
+	store.Take(ctx, "write:ip:10.0.0.1", write)
+	assert.Contains(t, store.buckets, "read:ip:10.0.0.1")
+	res, _ := store.Take(ctx, "read:ip:10.0.0.1", read)
+	assert.Equal(t, 50, res.Remaining)
+}
@@ -0,0 +1,221 @@
+// Package rules holds the 5e rules tables used to build and rate encounters.
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Difficulty ratings of an encounter, from the Dungeon Master's Guide
+type Difficulty string
+
+const (
+	Trivial Difficulty = "trivial"
+	Easy    Difficulty = "easy"
+	Medium  Difficulty = "medium"
+	Hard    Difficulty = "hard"
+	Deadly  Difficulty = "deadly"
+)
+
+// Difficulties lists the ratings from easiest to hardest
+var Difficulties = []Difficulty{Trivial, Easy, Medium, Hard, Deadly}
+
+// ParseDifficulty returns the difficulty with the given name
+func ParseDifficulty(s string) (Difficulty, error) {
+	for _, d := range Difficulties {
+		if string(d) == s {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("unknown difficulty %q", s)
+}
+
+// Party levels and challenge ratings covered by the tables
+const (
+	MinLevel = 1
+	MaxLevel = 20
+	MaxCR    = 30
+)
+
+// fractionalXP holds the XP of the challenge ratings below 1
+var fractionalXP = map[string]int{"0": 10, "1/8": 25, "1/4": 50, "1/2": 100}
+
+// xpByCR holds the XP of challenge ratings 1 to 30, indexed by CR
+var xpByCR = [MaxCR + 1]int{
+	0, 200, 450, 700, 1100, 1800, 2300, 2900, 3900, 5000,
+	5900, 7200, 8400, 10000, 11500, 13000, 15000, 18000, 20000, 22000,
+	25000, 33000, 41000, 50000, 62000, 75000, 90000, 105000, 120000, 135000,
+	155000,
+}
+
+// decimalCR maps the decimal spellings of fractional challenge ratings to their usual form
+var decimalCR = map[string]string{"0.125": "1/8", ".125": "1/8", "0.25": "1/4", ".25": "1/4", "0.5": "1/2", ".5": "1/2"}
+
+// NormalizeCR returns the challenge rating in its usual form ("0", "1/8", "1/4", "1/2" or "1" to "30"),
+// accepting decimals for the fractional ones.
+func NormalizeCR(cr string) (string, error) {
+	cr = strings.TrimSpace(cr)
+	if s, ok := decimalCR[cr]; ok {
+		return s, nil
+	}
+	if _, ok := fractionalXP[cr]; ok {
+		return cr, nil
+	}
+	n, err := strconv.Atoi(cr)
+	if err != nil || n < 1 || n > MaxCR {
+		return "", fmt.Errorf("invalid challenge rating %q", cr)
+	}
+	return strconv.Itoa(n), nil
+}
+
+// CRValue returns the challenge rating as a number, e.g. 0.25 for "1/4"
+func CRValue(cr string) (float64, error) {
+	cr, err := NormalizeCR(cr)
+	if err != nil {
+		return 0, err
+	}
+	switch cr {
+	case "1/8":
+		return 0.125, nil
+	case "1/4":
+		return 0.25, nil
+	case "1/2":
+		return 0.5, nil
+	}
+	return strconv.ParseFloat(cr, 64)
+}
+
+// XPForCR returns the experience points a creature of the challenge rating is worth
+func XPForCR(cr string) (int, error) {
+	cr, err := NormalizeCR(cr)
+	if err != nil {
+		return 0, err
+	}
+	if xp, ok := fractionalXP[cr]; ok {
+		return xp, nil
+	}
+	n, _ := strconv.Atoi(cr)
+	return xpByCR[n], nil
+}
+
+// Thresholds are the adjusted XP at which an encounter becomes easy, medium, hard or deadly
+type Thresholds struct {
+	Easy   int `json:"easy"`
+	Medium int `json:"medium"`
+	Hard   int `json:"hard"`
+	Deadly int `json:"deadly"`
+}
+
+// thresholdsByLevel holds the XP thresholds of a single character, indexed by level
+var thresholdsByLevel = [MaxLevel + 1]Thresholds{
+	{},
+	{25, 50, 75, 100},
+	{50, 100, 150, 200},
+	{75, 150, 225, 400},
+	{125, 250, 375, 500},
+	{250, 500, 750, 1100},
+	{300, 600, 900, 1400},
+	{350, 750, 1100, 1700},
+	{450, 900, 1400, 2100},
+	{550, 1100, 1600, 2400},
+	{600, 1200, 1900, 2800},
+	{800, 1600, 2400, 3600},
+	{1000, 2000, 3000, 4500},
+	{1100, 2200, 3400, 5100},
+	{1250, 2500, 3800, 5700},
+	{1400, 2800, 4300, 6400},
+	{1600, 3200, 4800, 7200},
+	{2000, 3900, 5900, 8800},
+	{2100, 4200, 6300, 9500},
+	{2400, 4900, 7300, 10900},
+	{2800, 5700, 8500, 12700},
+}
+
+// PartyThresholds returns the thresholds of a party, the sum of those of its characters
+func PartyThresholds(levels []int) (Thresholds, error) {
+	if len(levels) == 0 {
+		return Thresholds{}, fmt.Errorf("the party has no characters")
+	}
+	var t Thresholds
+	for _, level := range levels {
+		if level < MinLevel || level > MaxLevel {
+			return Thresholds{}, fmt.Errorf("invalid character level %d, expected %d to %d", level, MinLevel, MaxLevel)
+		}
+		l := thresholdsByLevel[level]
+		t.Easy += l.Easy
+		t.Medium += l.Medium
+		t.Hard += l.Hard
+		t.Deadly += l.Deadly
+	}
+	return t, nil
+}
+
+// Budget returns the adjusted XP an encounter of the difficulty may reach. Trivial encounters stay below easy.
+func (t Thresholds) Budget(d Difficulty) int {
+	switch d {
+	case Easy:
+		return t.Easy
+	case Medium:
+		return t.Medium
+	case Hard:
+		return t.Hard
+	case Deadly:
+		return t.Deadly
+	}
+	return t.Easy - 1
+}
+
+// Rate returns the difficulty of an encounter worth the adjusted XP
+func (t Thresholds) Rate(adjustedXP int) Difficulty {
+	switch {
+	case adjustedXP >= t.Deadly:
+		return Deadly
+	case adjustedXP >= t.Hard:
+		return Hard
+	case adjustedXP >= t.Medium:
+		return Medium
+	case adjustedXP >= t.Easy:
+		return Easy
+	}
+	return Trivial
+}
+
+// multipliers are the encounter multipliers, including the extra steps used to adjust for party size
+var multipliers = []float64{0.5, 1, 1.5, 2, 2.5, 3, 4, 5}
+
+// Multiplier returns the factor applied to the XP of an encounter with the given number of monsters, which
+// are more dangerous together than alone. Parties of fewer than three characters use the next higher
+// multiplier and parties of six or more the next lower one.
+func Multiplier(monsters, partySize int) float64 {
+	if monsters < 1 {
+		return 0
+	}
+	var step int
+	switch {
+	case monsters == 1:
+		step = 1
+	case monsters == 2:
+		step = 2
+	case monsters <= 6:
+		step = 3
+	case monsters <= 10:
+		step = 4
+	case monsters <= 14:
+		step = 5
+	default:
+		step = 6
+	}
+	switch {
+	case partySize < 3:
+		step++
+	case partySize >= 6:
+		step--
+	}
+	return multipliers[step]
+}
+
+// AdjustedXP returns the XP of the monsters multiplied for their number, as compared to the thresholds
+func AdjustedXP(baseXP, monsters, partySize int) int {
+	return int(float64(baseXP) * Multiplier(monsters, partySize))
+}
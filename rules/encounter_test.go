@@ -0,0 +1,80 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXPForCR(t *testing.T) {
+	tests := map[string]int{"0": 10, "1/8": 25, "0.25": 50, " 1/2 ": 100, "1": 200, "3": 700, "14": 11500, "30": 155000}
+	for cr, xp := range tests {
+		got, err := XPForCR(cr)
+		require.NoError(t, err, cr)
+		assert.Equal(t, xp, got, cr)
+	}
+
+	for _, cr := range []string{"", "31", "-1", "1/3", "two"} {
+		_, err := XPForCR(cr)
+		assert.Error(t, err, cr)
+	}
+}
+
+func TestCRValue(t *testing.T) {
+	v, err := CRValue("1/8")
+	require.NoError(t, err)
+	assert.Equal(t, 0.125, v)
+	v, err = CRValue("14")
+	require.NoError(t, err)
+	assert.Equal(t, 14.0, v)
+}
+
+func TestPartyThresholds(t *testing.T) {
+	got, err := PartyThresholds([]int{3, 3, 3, 2})
+	require.NoError(t, err)
+	assert.Equal(t, Thresholds{Easy: 275, Medium: 550, Hard: 825, Deadly: 1400}, got)
+
+	_, err = PartyThresholds(nil)
+	assert.Error(t, err)
+	_, err = PartyThresholds([]int{0})
+	assert.Error(t, err)
+	_, err = PartyThresholds([]int{21})
+	assert.Error(t, err)
+}
+
+func TestMultiplier(t *testing.T) {
+	tests := []struct {
+		monsters, party int
+		want            float64
+	}{
+		{1, 4, 1},
+		{2, 4, 1.5},
+		{3, 4, 2},
+		{6, 4, 2},
+		{7, 4, 2.5},
+		{11, 4, 3},
+		{15, 4, 4},
+		{1, 2, 1.5},
+		{15, 1, 5},
+		{1, 6, 0.5},
+		{3, 7, 1.5},
+		{0, 4, 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Multiplier(tt.monsters, tt.party), "%d monsters, party of %d", tt.monsters, tt.party)
+	}
+}
+
+func TestRate(t *testing.T) {
+	th := Thresholds{Easy: 275, Medium: 550, Hard: 825, Deadly: 1400}
+	assert.Equal(t, Trivial, th.Rate(100))
+	assert.Equal(t, Easy, th.Rate(275))
+	assert.Equal(t, Medium, th.Rate(700))
+	assert.Equal(t, Hard, th.Rate(1399))
+	assert.Equal(t, Deadly, th.Rate(5000))
+
+	for _, d := range Difficulties {
+		assert.Equal(t, d, th.Rate(th.Budget(d)), d)
+	}
+}
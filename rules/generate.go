@@ -0,0 +1,108 @@
+package rules
+
+import (
+	"errors"
+	"math/rand/v2"
+)
+
+// Limits of the encounter search
+const (
+	// generateAttempts is the number of random encounters built before giving up
+	generateAttempts = 200
+	// maxGeneratedMonsters caps the size of generated encounters
+	maxGeneratedMonsters = 20
+	// maxGeneratedKinds caps the number of different beasts in generated encounters
+	maxGeneratedKinds = 3
+)
+
+// ErrNoEncounter is returned by Generate when no encounter of the difficulty can be built from the candidates
+var ErrNoEncounter = errors.New("no encounter of this difficulty can be built from the available beasts")
+
+// Candidate is a beast that may be picked for an encounter
+type Candidate struct {
+	Key string
+	XP  int
+}
+
+// Pick is a beast picked for an encounter, count times
+type Pick struct {
+	Key   string
+	Count int
+}
+
+// Range returns the adjusted XP an encounter of the difficulty falls in, from lo up to but excluding hi.
+// Deadly encounters are capped at half again the deadly threshold, so they stay survivable in principle.
+func (t Thresholds) Range(d Difficulty) (lo, hi int) {
+	switch d {
+	case Trivial:
+		return 1, t.Easy
+	case Easy:
+		return t.Easy, t.Medium
+	case Medium:
+		return t.Medium, t.Hard
+	case Hard:
+		return t.Hard, t.Deadly
+	}
+	return t.Deadly, t.Deadly * 3 / 2
+}
+
+// Generate builds a random encounter of the target difficulty for a party from the candidates.
+// The result only depends on the candidates, their order and the state of rng, so a seeded rng
+// reproduces it.
+//
+// Each attempt picks up to three kinds of beasts and keeps adding a random one that does not push the
+// encounter past the difficulty, stopping at random once it is reached. Attempts that never reach it
+// are discarded.
+func Generate(candidates []Candidate, t Thresholds, partySize int, target Difficulty, rng *rand.Rand) ([]Pick, error) {
+	lo, hi := t.Range(target)
+	for attempt := 0; attempt < generateAttempts; attempt++ {
+		if picks, ok := generateOnce(candidates, lo, hi, partySize, rng); ok {
+			return picks, nil
+		}
+	}
+	return nil, ErrNoEncounter
+}
+
+func generateOnce(candidates []Candidate, lo, hi, partySize int, rng *rand.Rand) ([]Pick, bool) {
+	kinds := 1 + rng.IntN(maxGeneratedKinds)
+	var picks []Pick
+	counts := map[string]int{}
+	baseXP, monsters := 0, 0
+
+	for monsters < maxGeneratedMonsters {
+		// Beasts that fit, limited to those already picked once there are enough kinds
+		var fits []Candidate
+		for _, c := range candidates {
+			if len(picks) >= kinds && counts[c.Key] == 0 {
+				continue
+			}
+			if AdjustedXP(baseXP+c.XP, monsters+1, partySize) < hi {
+				fits = append(fits, c)
+			}
+		}
+		if len(fits) == 0 {
+			break
+		}
+
+		c := fits[rng.IntN(len(fits))]
+		if counts[c.Key] == 0 {
+			picks = append(picks, Pick{Key: c.Key})
+		}
+		counts[c.Key]++
+		baseXP += c.XP
+		monsters++
+
+		if AdjustedXP(baseXP, monsters, partySize) >= lo && rng.IntN(2) == 0 {
+			break
+		}
+	}
+
+	adjusted := AdjustedXP(baseXP, monsters, partySize)
+	if monsters == 0 || adjusted < lo || adjusted >= hi {
+		return nil, false
+	}
+	for i := range picks {
+		picks[i].Count = counts[picks[i].Key]
+	}
+	return picks, true
+}
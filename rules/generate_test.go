@@ -0,0 +1,75 @@
+package rules
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCandidates = []Candidate{
+	{"Rat", 10},
+	{"Goblin", 50},
+	{"Wolf", 50},
+	{"Orc", 100},
+	{"Bugbear", 200},
+	{"Mimic", 450},
+	{"Owlbear", 700},
+	{"Troll", 1800},
+	{"Elder Brain", 11500},
+}
+
+func TestGenerate_HitsDifficulty(t *testing.T) {
+	parties := [][]int{{1, 1}, {3, 3, 3, 2}, {5, 5, 5, 5, 5, 5}, {8, 8, 8}}
+	for _, party := range parties {
+		th, err := PartyThresholds(party)
+		require.NoError(t, err)
+		for _, target := range Difficulties {
+			for seed := uint64(0); seed < 20; seed++ {
+				picks, err := Generate(testCandidates, th, len(party), target, rand.New(rand.NewPCG(seed, seed)))
+				require.NoError(t, err, "party %v, %s, seed %d", party, target, seed)
+
+				xp, monsters := 0, 0
+				for _, p := range picks {
+					assert.Positive(t, p.Count)
+					for _, c := range testCandidates {
+						if c.Key == p.Key {
+							xp += c.XP * p.Count
+						}
+					}
+					monsters += p.Count
+				}
+				assert.LessOrEqual(t, len(picks), maxGeneratedKinds)
+				assert.LessOrEqual(t, monsters, maxGeneratedMonsters)
+				assert.Equal(t, target, th.Rate(AdjustedXP(xp, monsters, len(party))),
+					"party %v, seed %d, picks %v", party, seed, picks)
+			}
+		}
+	}
+}
+
+func TestGenerate_Reproducible(t *testing.T) {
+	th, err := PartyThresholds([]int{5, 5, 5, 5})
+	require.NoError(t, err)
+
+	first, err := Generate(testCandidates, th, 4, Hard, rand.New(rand.NewPCG(42, 42)))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		again, err := Generate(testCandidates, th, 4, Hard, rand.New(rand.NewPCG(42, 42)))
+		require.NoError(t, err)
+		assert.Equal(t, first, again)
+	}
+}
+
+func TestGenerate_NoEncounter(t *testing.T) {
+	th, err := PartyThresholds([]int{1, 1, 1, 1})
+	require.NoError(t, err)
+
+	// A single beast is already deadly for the party
+	_, err = Generate([]Candidate{{"Elder Brain", 11500}}, th, 4, Easy, rand.New(rand.NewPCG(1, 1)))
+	assert.ErrorIs(t, err, ErrNoEncounter)
+
+	_, err = Generate(nil, th, 4, Easy, rand.New(rand.NewPCG(1, 1)))
+	assert.ErrorIs(t, err, ErrNoEncounter)
+}
@@ -0,0 +1,33 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsForCR(t *testing.T) {
+	s, err := StatsForCR("0.5")
+	require.NoError(t, err)
+	assert.Equal(t, MonsterStats{"1/2", 2, 13, 50, 70, 3, 6, 8, 13}, s)
+
+	s, err = StatsForCR("20")
+	require.NoError(t, err)
+	assert.Equal(t, 378.0, s.AverageHP())
+	assert.Equal(t, 131.5, s.AverageDamage())
+
+	_, err = StatsForCR("31")
+	assert.Error(t, err)
+
+	// The table agrees with the proficiency bonus and has no gaps in its ranges
+	for i, s := range monsterStats {
+		pb, err := ProficiencyBonus(s.CR)
+		require.NoError(t, err)
+		assert.Equal(t, pb, s.ProficiencyBonus, s.CR)
+		if i > 0 {
+			assert.Equal(t, monsterStats[i-1].MaxHP+1, s.MinHP, s.CR)
+			assert.Equal(t, monsterStats[i-1].MaxDamage+1, s.MinDamage, s.CR)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package rules
+
+import "fmt"
+
+// Offense holds the statistics that rate how dangerous a creature is, following the
+// Dungeon Master's Guide's guidelines for creating a monster
+type Offense struct {
+	DamagePerRound int
+	AttackBonus    int // used when above 0
+	SaveDC         int // used when there is no attack bonus
+}
+
+// Defense holds the statistics that rate how hard a creature is to defeat
+type Defense struct {
+	HitPoints  int
+	ArmorClass int // not rated when 0
+}
+
+// Rating is a challenge rating worked out from a creature's statistics, with the steps taken
+type Rating struct {
+	CR          string
+	DefensiveCR string
+	OffensiveCR string
+	Steps       []string
+}
+
+// indexFor returns the first row of the table whose range, read by value, reaches n.
+// Values past the table give its last row.
+func indexFor(n int, value func(MonsterStats) int) int {
+	for i, s := range monsterStats {
+		if n <= value(s) {
+			return i
+		}
+	}
+	return len(monsterStats) - 1
+}
+
+// adjust moves a row of the table one step for every two points by which a statistic is above
+// or below the one expected of the row
+func adjust(i, actual, expected int) int {
+	return min(max(i+(actual-expected)/2, 0), len(monsterStats)-1)
+}
+
+// RateChallenge works out the defensive challenge rating from hit points and armor class, the
+// offensive one from damage per round and attack bonus or save DC, and the challenge rating as
+// their average, rounded up.
+func RateChallenge(d Defense, o Offense) Rating {
+	var r Rating
+	step := func(format string, args ...interface{}) {
+		r.Steps = append(r.Steps, fmt.Sprintf(format, args...))
+	}
+
+	def := indexFor(d.HitPoints, func(s MonsterStats) int { return s.MaxHP })
+	step("%d hit points suggest a defensive CR of %s (%d-%d hit points)",
+		d.HitPoints, monsterStats[def].CR, monsterStats[def].MinHP, monsterStats[def].MaxHP)
+	if d.ArmorClass > 0 {
+		expected := monsterStats[def].ArmorClass
+		adjusted := adjust(def, d.ArmorClass, expected)
+		step("AC %d against the expected %d moves it to CR %s", d.ArmorClass, expected, monsterStats[adjusted].CR)
+		def = adjusted
+	} else {
+		step("No armor class, so the defensive CR is not adjusted")
+	}
+
+	off := indexFor(o.DamagePerRound, func(s MonsterStats) int { return s.MaxDamage })
+	step("%d damage per round suggests an offensive CR of %s (%d-%d damage)",
+		o.DamagePerRound, monsterStats[off].CR, monsterStats[off].MinDamage, monsterStats[off].MaxDamage)
+	switch {
+	case o.AttackBonus > 0:
+		expected := monsterStats[off].AttackBonus
+		adjusted := adjust(off, o.AttackBonus, expected)
+		step("Attack bonus %+d against the expected %+d moves it to CR %s", o.AttackBonus, expected, monsterStats[adjusted].CR)
+		off = adjusted
+	case o.SaveDC > 0:
+		expected := monsterStats[off].SaveDC
+		adjusted := adjust(off, o.SaveDC, expected)
+		step("Save DC %d against the expected %d moves it to CR %s", o.SaveDC, expected, monsterStats[adjusted].CR)
+		off = adjusted
+	default:
+		step("No attack bonus or save DC, so the offensive CR is not adjusted")
+	}
+
+	r.DefensiveCR, r.OffensiveCR = monsterStats[def].CR, monsterStats[off].CR
+	r.CR = monsterStats[(def+off+1)/2].CR
+	step("The average of defensive CR %s and offensive CR %s is CR %s", r.DefensiveCR, r.OffensiveCR, r.CR)
+	return r
+}
+
+// CRDistance returns how many rows of the table apart two challenge ratings are
+func CRDistance(a, b string) (int, error) {
+	sa, err := StatsForCR(a)
+	if err != nil {
+		return 0, err
+	}
+	sb, err := StatsForCR(b)
+	if err != nil {
+		return 0, err
+	}
+	var ia, ib int
+	for i, s := range monsterStats {
+		if s.CR == sa.CR {
+			ia = i
+		}
+		if s.CR == sb.CR {
+			ib = i
+		}
+	}
+	if ia > ib {
+		return ia - ib, nil
+	}
+	return ib - ia, nil
+}
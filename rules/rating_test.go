@@ -0,0 +1,54 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateChallenge(t *testing.T) {
+	tests := []struct {
+		name                 string
+		defense              Defense
+		offense              Offense
+		defensive, offensive string
+		cr                   string
+	}{
+		{"Typical", Defense{HitPoints: 150, ArmorClass: 15}, Offense{DamagePerRound: 40, AttackBonus: 6}, "6", "6", "6"},
+		{"HighArmorClass", Defense{HitPoints: 59, ArmorClass: 17}, Offense{DamagePerRound: 24, AttackBonus: 4}, "2", "3", "3"},
+		{"LowAttackBonus", Defense{HitPoints: 59, ArmorClass: 13}, Offense{DamagePerRound: 24, AttackBonus: 1}, "1/2", "2", "1"},
+		{"SaveDC", Defense{HitPoints: 250, ArmorClass: 17}, Offense{DamagePerRound: 80, SaveDC: 21}, "12", "14", "13"},
+		{"Unadjusted", Defense{HitPoints: 3}, Offense{}, "0", "0", "0"},
+		{"OffTheTable", Defense{HitPoints: 1000, ArmorClass: 25}, Offense{DamagePerRound: 400, AttackBonus: 20}, "30", "30", "30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := RateChallenge(tt.defense, tt.offense)
+			assert.Equal(t, tt.defensive, r.DefensiveCR)
+			assert.Equal(t, tt.offensive, r.OffensiveCR)
+			assert.Equal(t, tt.cr, r.CR)
+			assert.Len(t, r.Steps, 5)
+		})
+	}
+
+	r := RateChallenge(Defense{HitPoints: 59, ArmorClass: 17}, Offense{DamagePerRound: 24, AttackBonus: 4})
+	assert.Equal(t, []string{
+		"59 hit points suggest a defensive CR of 1/2 (50-70 hit points)",
+		"AC 17 against the expected 13 moves it to CR 2",
+		"24 damage per round suggests an offensive CR of 3 (21-26 damage)",
+		"Attack bonus +4 against the expected +4 moves it to CR 3",
+		"The average of defensive CR 2 and offensive CR 3 is CR 3",
+	}, r.Steps)
+}
+
+func TestCRDistance(t *testing.T) {
+	n, err := CRDistance("1/2", "3")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = CRDistance("3", "0.5")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	_, err = CRDistance("3", "x")
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// maxScaledDice caps the dice of a scaled hit point or damage roll
+const maxScaledDice = 100
+
+// Scaling adjusts a stat block written for one challenge rating to another, following the
+// Monster Statistics by Challenge Rating table: armor class, attack bonuses and save DCs move
+// by the difference between the two rows, hit points and damage by the ratio of their averages.
+type Scaling struct {
+	From, To MonsterStats
+}
+
+// NewScaling returns the scaling from one challenge rating to another
+func NewScaling(from, to string) (Scaling, error) {
+	f, err := StatsForCR(from)
+	if err != nil {
+		return Scaling{}, err
+	}
+	t, err := StatsForCR(to)
+	if err != nil {
+		return Scaling{}, err
+	}
+	return Scaling{From: f, To: t}, nil
+}
+
+// ArmorClass scales an armor class, keeping it between 1 and 30
+func (s Scaling) ArmorClass(ac int) int {
+	return min(max(ac+s.To.ArmorClass-s.From.ArmorClass, 1), 30)
+}
+
+// AttackBonus scales an attack bonus
+func (s Scaling) AttackBonus(bonus int) int {
+	return bonus + s.To.AttackBonus - s.From.AttackBonus
+}
+
+// SaveDC scales a saving throw DC
+func (s Scaling) SaveDC(dc int) int {
+	return dc + s.To.SaveDC - s.From.SaveDC
+}
+
+// HitDice scales hit dice by changing how many are rolled. A bonus that is the same for
+// each die, such as the CON modifier in 7d10+21, is kept per die; any other bonus is kept as is.
+func (s Scaling) HitDice(hd HitDice) HitDice {
+	perDie, flat := 0, hd.Bonus
+	if hd.Bonus%hd.Count == 0 {
+		perDie, flat = hd.Bonus/hd.Count, 0
+	}
+	each := float64(hd.Die+1)/2 + float64(perDie)
+	if each < 1 {
+		perDie, flat, each = 0, hd.Bonus, float64(hd.Die+1)/2
+	}
+	target := float64(hd.Average()) * s.To.AverageHP() / s.From.AverageHP()
+	count := min(max(int(math.Round((target-float64(flat))/each)), 1), maxScaledDice)
+	return HitDice{Count: count, Die: hd.Die, Bonus: count*perDie + flat}
+}
+
+// damageRatio is how much more damage the target challenge rating deals
+func (s Scaling) damageRatio() float64 {
+	return s.To.AverageDamage() / max(s.From.AverageDamage(), 1)
+}
+
+// Damage scales a damage roll of count dice with the given sides and bonus by changing how many
+// dice are rolled. It returns the new count and the new average, rounded down as in stat blocks.
+func (s Scaling) Damage(count, sides, bonus int) (newCount, average int) {
+	each := float64(sides+1) / 2
+	target := (float64(count)*each + float64(bonus)) * s.damageRatio()
+	newCount = min(max(int(math.Round((target-float64(bonus))/each)), 1), maxScaledDice)
+	return newCount, max(int(float64(newCount)*each)+bonus, 1)
+}
+
+var (
+	toHitPattern  = regexp.MustCompile(`([+-])\s*(\d+) to hit`)
+	saveDCPattern = regexp.MustCompile(`\bDC (\d+)`)
+	damagePattern = regexp.MustCompile(`\d+ \((\d+)d(\d+)(?:\s*([+-])\s*(\d+))?\)`)
+)
+
+// SaveDCs returns the save DCs written in a description, such as "DC 13", in order
+func SaveDCs(description string) []int {
+	var dcs []int
+	for _, m := range saveDCPattern.FindAllStringSubmatch(description, -1) {
+		dc, _ := strconv.Atoi(m[1])
+		dcs = append(dcs, dc)
+	}
+	return dcs
+}
+
+// Description scales the attack bonuses ("+7 to hit"), save DCs ("DC 13") and damage written
+// with its dice ("10 (1d10 + 5)") in a description
+func (s Scaling) Description(description string) string {
+	description = toHitPattern.ReplaceAllStringFunc(description, func(m string) string {
+		sub := toHitPattern.FindStringSubmatch(m)
+		bonus, _ := strconv.Atoi(sub[2])
+		if sub[1] == "-" {
+			bonus = -bonus
+		}
+		return fmt.Sprintf("%+d to hit", s.AttackBonus(bonus))
+	})
+	description = saveDCPattern.ReplaceAllStringFunc(description, func(m string) string {
+		dc, _ := strconv.Atoi(saveDCPattern.FindStringSubmatch(m)[1])
+		return fmt.Sprintf("DC %d", s.SaveDC(dc))
+	})
+	return damagePattern.ReplaceAllStringFunc(description, func(m string) string {
+		sub := damagePattern.FindStringSubmatch(m)
+		count, _ := strconv.Atoi(sub[1])
+		sides, _ := strconv.Atoi(sub[2])
+		bonus, _ := strconv.Atoi(sub[4])
+		if sub[3] == "-" {
+			bonus = -bonus
+		}
+		count, average := s.Damage(count, sides, bonus)
+		switch {
+		case bonus > 0:
+			return fmt.Sprintf("%d (%dd%d + %d)", average, count, sides, bonus)
+		case bonus < 0:
+			return fmt.Sprintf("%d (%dd%d - %d)", average, count, sides, -bonus)
+		}
+		return fmt.Sprintf("%d (%dd%d)", average, count, sides)
+	})
+}
@@ -0,0 +1,44 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaling(t *testing.T) {
+	s, err := NewScaling("3", "6")
+	require.NoError(t, err)
+
+	assert.Equal(t, 15, s.ArmorClass(13))
+	assert.Equal(t, 30, s.ArmorClass(30))
+	assert.Equal(t, 9, s.AttackBonus(7))
+	assert.Equal(t, 15, s.SaveDC(13))
+	assert.Equal(t, "10d10+30", s.HitDice(HitDice{Count: 7, Die: 10, Bonus: 21}).String())
+	assert.Equal(t, "11d8-2", s.HitDice(HitDice{Count: 8, Die: 8, Bonus: -2}).String())
+
+	count, average := s.Damage(2, 8, 5)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, 23, average)
+
+	description := "Beak. Melee Weapon Attack: +7 to hit, reach 5 ft., one creature. Hit: 10 (1d10 + 5) piercing damage.\n" +
+		"Spores. Each creature within 10 feet must succeed on a DC 13 Constitution saving throw or take 7 (2d6) poison damage."
+	assert.Equal(t, "Beak. Melee Weapon Attack: +9 to hit, reach 5 ft., one creature. Hit: 16 (2d10 + 5) piercing damage.\n"+
+		"Spores. Each creature within 10 feet must succeed on a DC 15 Constitution saving throw or take 14 (4d6) poison damage.",
+		s.Description(description))
+
+	// Scaling down keeps at least one die
+	down, err := NewScaling("14", "1/8")
+	require.NoError(t, err)
+	assert.Equal(t, "2d10+10", down.HitDice(HitDice{Count: 20, Die: 10, Bonus: 100}).String())
+	assert.Equal(t, "+4 to hit. Hit: 4 (1d6 + 1) bludgeoning damage.", down.Description("+9 to hit. Hit: 8 (2d6 + 1) bludgeoning damage."))
+
+	_, err = NewScaling("3", "31")
+	assert.Error(t, err)
+}
+
+func TestSaveDCs(t *testing.T) {
+	assert.Equal(t, []int{13, 15}, SaveDCs("must succeed on a DC 13 Constitution saving throw or a DC 15 Wisdom one"))
+	assert.Empty(t, SaveDCs("Beak. Melee Weapon Attack: +7 to hit"))
+}
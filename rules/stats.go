@@ -0,0 +1,129 @@
+package rules
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HitDice are the dice rolled for a creature's hit points, such as 7d10+21
+type HitDice struct {
+	Count int
+	Die   int
+	Bonus int
+}
+
+var hitDicePattern = regexp.MustCompile(`^(\d+)\s*d\s*(\d+)\s*(?:([+-])\s*(\d+))?$`)
+
+// validHitDie reports whether creatures use the die for hit points: d4 (Tiny) to d20 (Gargantuan)
+func validHitDie(die int) bool {
+	switch die {
+	case 4, 6, 8, 10, 12, 20:
+		return true
+	}
+	return false
+}
+
+// ParseHitDice parses hit dice written as "7d10+21", "7d10 - 2" or "7d10"
+func ParseHitDice(s string) (HitDice, error) {
+	m := hitDicePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return HitDice{}, fmt.Errorf("invalid hit dice %q, expected e.g. 7d10+21", s)
+	}
+	var hd HitDice
+	hd.Count, _ = strconv.Atoi(m[1])
+	hd.Die, _ = strconv.Atoi(m[2])
+	if m[4] != "" {
+		hd.Bonus, _ = strconv.Atoi(m[4])
+		if m[3] == "-" {
+			hd.Bonus = -hd.Bonus
+		}
+	}
+	if hd.Count < 1 || hd.Count > 100 || !validHitDie(hd.Die) {
+		return HitDice{}, fmt.Errorf("invalid hit dice %q, expected 1 to 100 d4, d6, d8, d10, d12 or d20", s)
+	}
+	return hd, nil
+}
+
+// String returns the hit dice in their usual form
+func (hd HitDice) String() string {
+	switch {
+	case hd.Bonus > 0:
+		return fmt.Sprintf("%dd%d+%d", hd.Count, hd.Die, hd.Bonus)
+	case hd.Bonus < 0:
+		return fmt.Sprintf("%dd%d-%d", hd.Count, hd.Die, -hd.Bonus)
+	}
+	return fmt.Sprintf("%dd%d", hd.Count, hd.Die)
+}
+
+// Average returns the average hit points, rounded down as in stat blocks. It is at least 1.
+func (hd HitDice) Average() int {
+	return max(hd.Count*(hd.Die+1)/2+hd.Bonus, 1)
+}
+
+// Roll rolls the hit points. A creature always has at least 1 hit point.
+func (hd HitDice) Roll(rng *rand.Rand) int {
+	total := hd.Bonus
+	for i := 0; i < hd.Count; i++ {
+		total += 1 + rng.IntN(hd.Die)
+	}
+	return max(total, 1)
+}
+
+// ProficiencyBonus returns the proficiency bonus of a creature of the challenge rating:
+// +2 up to CR 4, then one more every four CRs up to +9 at CR 29 and 30
+func ProficiencyBonus(cr string) (int, error) {
+	v, err := CRValue(cr)
+	if err != nil {
+		return 0, err
+	}
+	if v < 1 {
+		return 2, nil
+	}
+	return 2 + (int(v)-1)/4, nil
+}
+
+// Abilities in stat block order
+var Abilities = []string{"STR", "DEX", "CON", "INT", "WIS", "CHA"}
+
+var abilityScorePattern = regexp.MustCompile(`^(\d+)`)
+
+// ParseAbilityScore reads the score from an ability as written in Attributes, such as "12 (+1)" or "12"
+func ParseAbilityScore(s string) (int, error) {
+	m := abilityScorePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid ability score %q", s)
+	}
+	score, _ := strconv.Atoi(m[1])
+	if score < 1 || score > 30 {
+		return 0, fmt.Errorf("invalid ability score %q, expected 1 to 30", s)
+	}
+	return score, nil
+}
+
+// AbilityModifier returns the modifier for an ability score
+func AbilityModifier(score int) int {
+	// Round down for odd scores below 10 as well
+	if score < 10 {
+		return (score - 11) / 2
+	}
+	return (score - 10) / 2
+}
+
+// Conditions a creature can suffer from, from the Player's Handbook
+var Conditions = []string{
+	"blinded", "charmed", "deafened", "exhaustion", "frightened", "grappled", "incapacitated", "invisible",
+	"paralyzed", "petrified", "poisoned", "prone", "restrained", "stunned", "unconscious",
+}
+
+// IsCondition reports whether name is one of the Conditions
+func IsCondition(name string) bool {
+	for _, c := range Conditions {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
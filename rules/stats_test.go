@@ -0,0 +1,100 @@
+package rules
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHitDice(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    HitDice
+		str     string
+		average int
+	}{
+		{"7d10+21", HitDice{7, 10, 21}, "7d10+21", 59},
+		{"9d8 + 18", HitDice{9, 8, 18}, "9d8+18", 58},
+		{"2d6-4", HitDice{2, 6, -4}, "2d6-4", 3},
+		{"1D4", HitDice{1, 4, 0}, "1d4", 2},
+		{"1d4-5", HitDice{1, 4, -5}, "1d4-5", 1},
+	}
+	for _, tt := range tests {
+		hd, err := ParseHitDice(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, hd, tt.in)
+		assert.Equal(t, tt.str, hd.String(), tt.in)
+		assert.Equal(t, tt.average, hd.Average(), tt.in)
+	}
+
+	for _, s := range []string{"", "d8", "7d7", "0d8", "7d10+", "seven d ten"} {
+		_, err := ParseHitDice(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestHitDice_Roll(t *testing.T) {
+	hd := HitDice{7, 10, 21}
+	rng := rand.New(rand.NewPCG(1, 1))
+	for i := 0; i < 1000; i++ {
+		hp := hd.Roll(rng)
+		assert.GreaterOrEqual(t, hp, 28)
+		assert.LessOrEqual(t, hp, 91)
+	}
+	assert.Equal(t, 1, HitDice{1, 4, -10}.Roll(rng))
+}
+
+func TestAbilities(t *testing.T) {
+	for s, want := range map[string]int{"12 (+1)": 12, "8": 8, " 30 (+10)": 30} {
+		score, err := ParseAbilityScore(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, score, s)
+	}
+	for _, s := range []string{"", "(+1)", "0", "31"} {
+		_, err := ParseAbilityScore(s)
+		assert.Error(t, err, s)
+	}
+
+	modifiers := map[int]int{1: -5, 3: -4, 8: -1, 9: -1, 10: 0, 11: 0, 12: 1, 17: 3, 20: 5, 30: 10}
+	for score, want := range modifiers {
+		assert.Equal(t, want, AbilityModifier(score), score)
+	}
+}
+
+func TestIsCondition(t *testing.T) {
+	assert.True(t, IsCondition("prone"))
+	assert.False(t, IsCondition("sleepy"))
+}
+
+func TestChallengeRatingTable(t *testing.T) {
+	tests := []struct {
+		cr          string
+		proficiency int
+		xp          int
+	}{
+		{"0", 2, 10}, {"1/8", 2, 25}, {"1/4", 2, 50}, {"1/2", 2, 100},
+		{"1", 2, 200}, {"2", 2, 450}, {"3", 2, 700}, {"4", 2, 1100},
+		{"5", 3, 1800}, {"6", 3, 2300}, {"7", 3, 2900}, {"8", 3, 3900},
+		{"9", 4, 5000}, {"10", 4, 5900}, {"11", 4, 7200}, {"12", 4, 8400},
+		{"13", 5, 10000}, {"14", 5, 11500}, {"15", 5, 13000}, {"16", 5, 15000},
+		{"17", 6, 18000}, {"18", 6, 20000}, {"19", 6, 22000}, {"20", 6, 25000},
+		{"21", 7, 33000}, {"22", 7, 41000}, {"23", 7, 50000}, {"24", 7, 62000},
+		{"25", 8, 75000}, {"26", 8, 90000}, {"27", 8, 105000}, {"28", 8, 120000},
+		{"29", 9, 135000}, {"30", 9, 155000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cr, func(t *testing.T) {
+			pb, err := ProficiencyBonus(tt.cr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.proficiency, pb)
+			xp, err := XPForCR(tt.cr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.xp, xp)
+		})
+	}
+
+	_, err := ProficiencyBonus("31")
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "images"))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(ctx, "beasts/owlbear.png", strings.NewReader("first")))
+	require.NoError(t, store.Put(ctx, "beasts/owlbear.png", strings.NewReader("second")))
+
+	f, err := store.Open(ctx, "beasts/owlbear.png")
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "images", "beasts"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, store.Delete(ctx, "beasts/owlbear.png"))
+	require.NoError(t, store.Delete(ctx, "beasts/owlbear.png"))
+	_, err = store.Open(ctx, "beasts/owlbear.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalStore_InvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "../secret", "beasts/../../secret", "/etc/passwd", "beasts//owlbear.png", ".hidden", `beasts\owlbear.png`} {
+		assert.Error(t, store.Put(ctx, key, strings.NewReader("x")), key)
+		_, err := store.Open(ctx, key)
+		assert.Error(t, err, key)
+		assert.Error(t, store.Delete(ctx, key), key)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/keremenci/bestiary-crud/api"
+	"github.com/keremenci/bestiary-crud/auth"
 	"github.com/keremenci/bestiary-crud/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,12 +19,73 @@ func setupRouter() *gin.Engine {
 	api.InitializeDB(config.GetAppConfig("../config/config.yml").DatabaseUrl)
 
 	router := gin.Default()
+	router.Use(api.AssumePrincipal(&auth.Principal{Subject: "integration", Roles: []string{api.RoleAdmin}}))
 	router.GET("/", api.HealthCheck)
-	router.GET("/beasts", api.ListItems)
-	router.GET("/beasts/:key", api.GetItem)
-	router.POST("/beasts", api.PutItem)
-	router.PUT("/beasts/:key", api.UpdateItem)
-	router.DELETE("/beasts/:key", api.DeleteItem)
+	router.GET("/beasts", api.Authorize(api.ActionListBeasts), api.ListItems)
+	router.GET("/beasts/events", api.Authorize(api.ActionListBeasts), api.StreamEvents(api.NewEventBroker()))
+	router.GET("/beasts/:key", api.Authorize(api.ActionGetBeast), api.GetItem)
+	router.POST("/beasts", api.Authorize(api.ActionCreateBeast), api.PutItem)
+	router.POST("/beasts/calculate-cr", api.Authorize(api.ActionListBeasts), api.CalculateCR)
+	router.PUT("/beasts/:key", api.Authorize(api.ActionUpdateBeast), api.UpdateItem)
+	router.DELETE("/beasts/:key", api.Authorize(api.ActionDeleteBeast), api.DeleteItem)
+	router.POST("/beasts/:key/restore", api.Authorize(api.ActionDeleteBeast), api.RestoreItem)
+	router.GET("/trash", api.Authorize(api.ActionDeleteBeast), api.ListTrash)
+	router.GET("/beasts/:key/revisions", api.Authorize(api.ActionGetBeast), api.ListRevisions)
+	router.GET("/beasts/:key/revisions/:n", api.Authorize(api.ActionGetBeast), api.GetRevision)
+	router.GET("/beasts/:key/diff", api.Authorize(api.ActionGetBeast), api.DiffRevisions)
+	router.POST("/beasts/:key/revisions/:n/restore", api.Authorize(api.ActionUpdateBeast), api.RestoreRevision)
+	router.POST("/beasts/:key/roll/hp", api.Authorize(api.ActionGetBeast), api.RollHitPoints)
+	router.POST("/beasts/:key/roll/attack", api.Authorize(api.ActionGetBeast), api.RollAttack)
+	router.POST("/beasts/:key/scale", api.Authorize(api.ActionGetBeast), api.ScaleBeast)
+	router.POST("/beasts/:key/images", api.Authorize(api.ActionUpdateBeast), api.UploadImage)
+	router.DELETE("/beasts/:key/images/:id", api.Authorize(api.ActionUpdateBeast), api.DeleteImage)
+	router.GET("/images/:id", api.Authorize(api.ActionGetBeast), api.ServeImage)
+	router.GET("/images/:id/thumbnail", api.Authorize(api.ActionGetBeast), api.ServeThumbnail)
+	router.GET("/beasts/:key/export/foundry", api.Authorize(api.ActionGetBeast), api.ExportBeastFoundry)
+	router.GET("/beasts/:key/export/roll20", api.Authorize(api.ActionGetBeast), api.ExportBeastRoll20)
+	router.POST("/roll", api.Authorize(api.ActionListBeasts), api.RollDice)
+	router.POST("/encounters/evaluate", api.Authorize(api.ActionListBeasts), api.EvaluateEncounter)
+	router.POST("/encounters/generate", api.Authorize(api.ActionListBeasts), api.GenerateEncounter)
+	router.POST("/books", api.Authorize(api.ActionListBeasts), api.CreateBook)
+	router.GET("/tags", api.Authorize(api.ActionListBeasts), api.ListTags)
+	router.POST("/tags", api.Authorize(api.ActionManageTags), api.CreateTag)
+	router.GET("/tags/:tag", api.Authorize(api.ActionListBeasts), api.GetTag)
+	router.PUT("/tags/:tag", api.Authorize(api.ActionManageTags), api.UpdateTag)
+	router.DELETE("/tags/:tag", api.Authorize(api.ActionManageTags), api.DeleteTag)
+	router.GET("/sources", api.Authorize(api.ActionListBeasts), api.ListSources)
+	router.POST("/sources", api.Authorize(api.ActionManageSources), api.CreateSource)
+	router.GET("/sources/:source", api.Authorize(api.ActionListBeasts), api.GetSource)
+	router.PUT("/sources/:source", api.Authorize(api.ActionManageSources), api.UpdateSource)
+	router.DELETE("/sources/:source", api.Authorize(api.ActionManageSources), api.DeleteSource)
+	router.GET("/export", api.Authorize(api.ActionListBeasts), api.ExportBeasts)
+	router.GET("/export/foundry", api.Authorize(api.ActionListBeasts), api.ExportFoundry)
+	router.GET("/export/roll20", api.Authorize(api.ActionListBeasts), api.ExportRoll20)
+	router.GET("/campaigns", api.Authorize(api.ActionReadCampaigns), api.ListCampaigns)
+	router.POST("/campaigns", api.Authorize(api.ActionWriteCampaigns), api.CreateCampaign)
+	router.GET("/campaigns/:campaign", api.Authorize(api.ActionReadCampaigns), api.GetCampaign)
+	router.PUT("/campaigns/:campaign", api.Authorize(api.ActionWriteCampaigns), api.UpdateCampaign)
+	router.DELETE("/campaigns/:campaign", api.Authorize(api.ActionWriteCampaigns), api.DeleteCampaign)
+	router.GET("/campaigns/:campaign/encounters", api.Authorize(api.ActionReadCampaigns), api.ListCampaignEncounters)
+	router.POST("/campaigns/:campaign/encounters", api.Authorize(api.ActionWriteCampaigns), api.CreateCampaignEncounter)
+	router.GET("/campaigns/:campaign/encounters/:id", api.Authorize(api.ActionReadCampaigns), api.GetCampaignEncounter)
+	router.PUT("/campaigns/:campaign/encounters/:id", api.Authorize(api.ActionWriteCampaigns), api.UpdateCampaignEncounter)
+	router.DELETE("/campaigns/:campaign/encounters/:id", api.Authorize(api.ActionWriteCampaigns), api.DeleteCampaignEncounter)
+	router.GET("/combats", api.Authorize(api.ActionRunCombats), api.ListCombats)
+	router.POST("/combats", api.Authorize(api.ActionRunCombats), api.CreateCombat)
+	router.GET("/combats/:id", api.Authorize(api.ActionRunCombats), api.GetCombat)
+	router.DELETE("/combats/:id", api.Authorize(api.ActionRunCombats), api.DeleteCombat)
+	router.POST("/combats/:id/next", api.Authorize(api.ActionRunCombats), api.NextTurn)
+	router.POST("/combats/:id/combatants", api.Authorize(api.ActionRunCombats), api.AddCombatants)
+	router.DELETE("/combats/:id/combatants/:combatant", api.Authorize(api.ActionRunCombats), api.RemoveCombatant)
+	router.POST("/combats/:id/combatants/:combatant/damage", api.Authorize(api.ActionRunCombats), api.DamageCombatant)
+	router.POST("/combats/:id/combatants/:combatant/heal", api.Authorize(api.ActionRunCombats), api.HealCombatant)
+	router.PUT("/combats/:id/combatants/:combatant/conditions/:condition", api.Authorize(api.ActionRunCombats), api.AddCondition)
+	router.DELETE("/combats/:id/combatants/:combatant/conditions/:condition", api.Authorize(api.ActionRunCombats), api.RemoveCondition)
+	router.GET("/audit", api.Authorize(api.ActionReadAudit), api.ListAudit)
+	router.GET("/webhooks", api.Authorize(api.ActionManageWebhooks), api.ListWebhooks)
+	router.POST("/webhooks", api.Authorize(api.ActionManageWebhooks), api.CreateWebhook)
+	router.DELETE("/webhooks/:id", api.Authorize(api.ActionManageWebhooks), api.DeleteWebhook)
+	router.GET("/webhooks/:id/deliveries", api.Authorize(api.ActionManageWebhooks), api.ListWebhookDeliveries)
 
 	return router
 }
@@ -116,4 +178,31 @@ func TestIntegration(t *testing.T) {
 		}
 		assert.Equal(t, "Beast deleted successfully", response["message"])
 	})
+
+	t.Run("RestoreSeededRevision", func(t *testing.T) {
+		// The first revision of a built-in beast was seeded before it had a size, tags or a source
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/beasts/Elder%20Brain/revisions/1/restore", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/beasts/Elder%20Brain", nil)
+		router.ServeHTTP(w, req)
+
+		var response api.Beast
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		assert.Equal(t, "Aberration", response.Type)
+		assert.Equal(t, "Mind Flayer", response.Subtype)
+		assert.Equal(t, "Large", response.Size)
+		assert.Equal(t, 10, response.ArmorClass)
+		assert.Equal(t, "20d10+100", response.HitDice)
+		assert.Equal(t, []string{"underdark"}, response.Tags)
+		assert.Equal(t, "VGM", response.Source)
+		assert.Equal(t, 173, response.SourcePage)
+	})
 }
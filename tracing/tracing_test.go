@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+	// The W3C propagator is installed even when spans are not exported
+	assert.Contains(t, otel.GetTextMapPropagator().Fields(), "traceparent")
+
+	shutdown, err = Setup(context.Background(), Config{Exporter: "otlp", Endpoint: "localhost:4318", Insecure: true})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), Config{Exporter: "zipkin"})
+	assert.EqualError(t, err, `unknown trace exporter "zipkin"`)
+}
+
+func TestNewProvider(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(exporter, Config{ServiceName: "bestiary-test"})
+
+	_, span := provider.Tracer("test").Start(context.Background(), "GET /beasts")
+	span.End()
+	require.NoError(t, provider.ForceFlush(context.Background()))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /beasts", spans[0].Name)
+	assert.Contains(t, spans[0].Resource.String(), "service.name=bestiary-test")
+}
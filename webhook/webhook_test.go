@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"action":"update"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign("s3cret", now, body)
+
+	assert.Regexp(t, `^t=1700000000,v1=[0-9a-f]{64}$`, header)
+	assert.NoError(t, Verify("s3cret", header, body, now.Add(time.Minute), 5*time.Minute))
+	assert.ErrorIs(t, Verify("other", header, body, now, 0), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("s3cret", header, []byte(`{"action":"delete"}`), now, 0), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("s3cret", header, body, now.Add(time.Hour), 5*time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("s3cret", "garbage", body, now, 0), ErrInvalidSignature)
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 30*time.Second, time.Hour
+	assert.Equal(t, 30*time.Second, Backoff(1, base, max))
+	assert.Equal(t, time.Minute, Backoff(2, base, max))
+	assert.Equal(t, 4*time.Minute, Backoff(4, base, max))
+	assert.Equal(t, time.Hour, Backoff(20, base, max))
+
+	// A base above the cap is capped from the first retry
+	assert.Equal(t, time.Hour, Backoff(1, 2*time.Hour, max))
+}
+
+func TestSend(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	status := http.StatusNoContent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	d := Delivery{ID: 7, URL: receiver.URL, Secret: "s3cret", Event: "create", Body: []byte(`{"beast_name":"Owlbear"}`)}
+	code, err := Send(context.Background(), receiver.Client(), d)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, "create", got.Header.Get(EventHeader))
+	assert.Equal(t, "7", got.Header.Get(DeliveryHeader))
+	assert.Equal(t, d.Body, gotBody)
+	assert.NoError(t, Verify("s3cret", got.Header.Get(SignatureHeader), gotBody, time.Now(), time.Minute))
+
+	status = http.StatusServiceUnavailable
+	code, err = Send(context.Background(), receiver.Client(), d)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}